@@ -0,0 +1,209 @@
+// Package actionsync pulls the CodeQL Action and its CodeQL bundles from GitHub.com into a local cache, and pushes them from the cache to a GitHub Enterprise instance. It is for Go programs that embed the sync instead of running the command line tool.
+//
+// Messages are logged with logrus as they are by the command line tool. Progress is reported to the Events handler of the options, and shown by the Progress reporter if one is set.
+package actionsync
+
+import (
+	"context"
+	usererrors "errors"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/pull"
+	"github.com/github/codeql-action-sync/internal/push"
+)
+
+const errorCacheDirRequired = "A cache directory is required."
+
+// Errors returned by Pull, Push, Check and Rollback match one of these with `errors.Is` if they are in one of the categories that the command line tool has a distinct exit code for. Use Category to also categorize errors from the GitHub API, Git and the network by their cause.
+var ErrAuth = errorcategory.ErrAuth
+var ErrPermission = errorcategory.ErrPermission
+var ErrCacheInvalid = errorcategory.ErrCacheInvalid
+var ErrCacheLocked = errorcategory.ErrCacheLocked
+var ErrNetwork = errorcategory.ErrNetwork
+var ErrConflict = errorcategory.ErrConflict
+var ErrRateLimited = errorcategory.ErrRateLimited
+
+// Category returns which of ErrAuth, ErrPermission, ErrCacheInvalid, ErrCacheLocked, ErrNetwork, ErrConflict or ErrRateLimited an error is in, or nil if it is in none of them.
+func Category(err error) error {
+	return errorcategory.Of(err)
+}
+
+// PullOptions configures a pull. The fields match the arguments of the `pull` command.
+type PullOptions struct {
+	// CacheDir is the directory to cache the Action in. It is required.
+	CacheDir string
+	// SourceToken is normally only needed for GitHub Enterprise sources, or to avoid API rate limits.
+	SourceToken string
+	// SourceEnterpriseURL is the URL of a GitHub Enterprise instance to pull from instead of GitHub.com.
+	SourceEnterpriseURL string
+	// SourceRepository defaults to `github/codeql-action`.
+	SourceRepository string
+	// MaxRateLimitWait is how long to wait for a GitHub API rate limit to reset before giving up. If zero, there is no wait.
+	MaxRateLimitWait time.Duration
+	// RetryPolicy defaults to DefaultRetryPolicy if its MaxAttempts is zero.
+	RetryPolicy RetryPolicy
+	// Pins maps branches and tags to the earlier upstream version they should be synced at, e.g. `v3` to `v3.24.10`.
+	Pins map[string]string
+	// TrustedKeys are files of PGP or SSH public keys that the synced branches and tags must be signed by.
+	TrustedKeys        []string
+	StrictSignatures   bool
+	ManifestSigningKey string
+	Attestations       bool
+	SBOM               bool
+	// ChangelogFormat is `markdown`, `html`, or empty to not write a changelog.
+	ChangelogFormat string
+	Events          EventHandler
+	Progress        *ProgressReporter
+}
+
+// PushOptions configures a push. The fields match the arguments of the `push` command.
+type PushOptions struct {
+	// CacheDir is the directory that the Action was cached in by Pull. It is required.
+	CacheDir       string
+	DestinationURL string
+	// DestinationType is one of `ghes`, `ghae`, `ghe.com` or `github.com`, or `auto` or empty to detect it.
+	DestinationType  string
+	DestinationToken string
+	// DestinationRepository defaults to `github/codeql-action`.
+	DestinationRepository string
+	// ActionsAdminUser defaults to `actions-admin`.
+	ActionsAdminUser string
+	Force            bool
+	PushSSH          bool
+	// MaxRateLimitWait is how long to wait for a GitHub API rate limit to reset before giving up. If zero, there is no wait.
+	MaxRateLimitWait time.Duration
+	// RetryPolicy defaults to DefaultRetryPolicy if its MaxAttempts is zero.
+	RetryPolicy RetryPolicy
+	// IncompatibleReferences is `warn` (the default), `refuse` or `skip`.
+	IncompatibleReferences string
+	// DriftedReferences is `warn` (the default), `refuse`, `skip` or `backup`.
+	DriftedReferences  string
+	RepositorySettings RepositorySettings
+	ProtectRefs        bool
+	// ManifestKeys are files of PGP or SSH public keys that the cache manifest must be signed by, if it is to be verified.
+	ManifestKeys        []string
+	AttestationSettings AttestationSettings
+	UploadSBOM          bool
+	Events              EventHandler
+	Progress            *ProgressReporter
+	// StateDir is where the state of the destination before each push is recorded for Rollback. It defaults to a `push-state` directory next to CacheDir.
+	StateDir string
+}
+
+func (options PullOptions) internal() (pull.Options, error) {
+	if options.CacheDir == "" {
+		return pull.Options{}, usererrors.New(errorCacheDirRequired)
+	}
+	return pull.Options{
+		CacheDirectory:      cachedirectory.NewCacheDirectory(options.CacheDir),
+		SourceToken:         options.SourceToken,
+		SourceEnterpriseURL: options.SourceEnterpriseURL,
+		SourceRepository:    options.SourceRepository,
+		MaxRateLimitWait:    options.MaxRateLimitWait,
+		RetryPolicy:         options.RetryPolicy.internal(),
+		Pins:                options.Pins,
+		TrustedKeys:         options.TrustedKeys,
+		StrictSignatures:    options.StrictSignatures,
+		ManifestSigningKey:  options.ManifestSigningKey,
+		Attestations:        options.Attestations,
+		SBOM:                options.SBOM,
+		ChangelogFormat:     options.ChangelogFormat,
+		Events:              options.Events.internal(),
+		Progress:            options.Progress.internal(),
+	}, nil
+}
+
+func (options PushOptions) internal() (push.Options, error) {
+	if options.CacheDir == "" {
+		return push.Options{}, usererrors.New(errorCacheDirRequired)
+	}
+	destinationRepository := options.DestinationRepository
+	if destinationRepository == "" {
+		destinationRepository = "github/codeql-action"
+	}
+	actionsAdminUser := options.ActionsAdminUser
+	if actionsAdminUser == "" {
+		actionsAdminUser = "actions-admin"
+	}
+	return push.Options{
+		CacheDirectory:         cachedirectory.NewCacheDirectory(options.CacheDir),
+		DestinationURL:         options.DestinationURL,
+		DestinationType:        options.DestinationType,
+		DestinationToken:       options.DestinationToken,
+		DestinationRepository:  destinationRepository,
+		ActionsAdminUser:       actionsAdminUser,
+		Force:                  options.Force,
+		PushSSH:                options.PushSSH,
+		MaxRateLimitWait:       options.MaxRateLimitWait,
+		RetryPolicy:            options.RetryPolicy.internal(),
+		IncompatibleReferences: options.IncompatibleReferences,
+		DriftedReferences:      options.DriftedReferences,
+		RepositorySettings:     push.RepositorySettings(options.RepositorySettings),
+		ProtectRefs:            options.ProtectRefs,
+		ManifestKeys:           options.ManifestKeys,
+		AttestationSettings:    push.AttestationSettings(options.AttestationSettings),
+		UploadSBOM:             options.UploadSBOM,
+		Events:                 options.Events.internal(),
+		Progress:               options.Progress.internal(),
+		StateDirectory:         options.StateDir,
+	}, nil
+}
+
+// Pull updates the cache from the source, and returns the branches and tags and CodeQL bundles that are now in it.
+func Pull(ctx context.Context, options PullOptions) (*PullResult, error) {
+	pullOptions, err := options.internal()
+	if err != nil {
+		return nil, err
+	}
+	result, err := pull.Pull(ctx, pullOptions)
+	if err != nil {
+		return nil, err
+	}
+	pullResult := PullResult(*result)
+	return &pullResult, nil
+}
+
+// Push updates the destination from the cache, and returns what changed.
+func Push(ctx context.Context, options PushOptions) (*PushResult, error) {
+	pushOptions, err := options.internal()
+	if err != nil {
+		return nil, err
+	}
+	result, err := push.Push(ctx, pushOptions)
+	if err != nil {
+		return nil, err
+	}
+	return newPushResult(result), nil
+}
+
+// Check reports whether the destination is ready for a push, without changing anything.
+func Check(ctx context.Context, options PushOptions) error {
+	pushOptions, err := options.internal()
+	if err != nil {
+		return err
+	}
+	return push.Check(ctx, pushOptions)
+}
+
+// Rollback returns the destination to its state before the last push from the cache.
+func Rollback(ctx context.Context, options PushOptions) error {
+	pushOptions, err := options.internal()
+	if err != nil {
+		return err
+	}
+	return push.Rollback(ctx, pushOptions)
+}
+
+// Inspect reads a cache directory without changing it, so it can be used while a pull is in progress.
+func Inspect(cacheDir string) (*CacheStatus, error) {
+	if cacheDir == "" {
+		return nil, usererrors.New(errorCacheDirRequired)
+	}
+	status, err := pull.InspectCache(cachedirectory.NewCacheDirectory(cacheDir))
+	if err != nil {
+		return nil, err
+	}
+	return newCacheStatus(status), nil
+}
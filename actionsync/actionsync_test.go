@@ -0,0 +1,119 @@
+package actionsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/event"
+	"github.com/github/codeql-action-sync/internal/pull"
+	"github.com/github/codeql-action-sync/internal/push"
+	"github.com/github/codeql-action-sync/internal/retry"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullOptionsDefaultRetryPolicy(t *testing.T) {
+	pullOptions, err := PullOptions{CacheDir: "cache"}.internal()
+	require.NoError(t, err)
+	require.Equal(t, retry.DefaultPolicy(), pullOptions.RetryPolicy)
+
+	retryPolicy := DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = 2
+	retryPolicy.InitialBackoff = time.Millisecond
+	pullOptions, err = PullOptions{CacheDir: "cache", RetryPolicy: retryPolicy}.internal()
+	require.NoError(t, err)
+	require.Equal(t, 2, pullOptions.RetryPolicy.MaxAttempts)
+	require.Equal(t, time.Millisecond, pullOptions.RetryPolicy.InitialBackoff)
+}
+
+func TestPushOptionsDefaults(t *testing.T) {
+	pushOptions, err := PushOptions{CacheDir: "cache", DestinationURL: "https://ghes.example.com"}.internal()
+	require.NoError(t, err)
+	require.Equal(t, "github/codeql-action", pushOptions.DestinationRepository)
+	require.Equal(t, "actions-admin", pushOptions.ActionsAdminUser)
+	require.Equal(t, retry.DefaultPolicy(), pushOptions.RetryPolicy)
+	require.Nil(t, pushOptions.Events)
+	require.Nil(t, pushOptions.Progress)
+
+	pushOptions, err = PushOptions{CacheDir: "cache", DestinationRepository: "my-organization/codeql-action", ActionsAdminUser: "ghost"}.internal()
+	require.NoError(t, err)
+	require.Equal(t, "my-organization/codeql-action", pushOptions.DestinationRepository)
+	require.Equal(t, "ghost", pushOptions.ActionsAdminUser)
+}
+
+func TestPushOptionsConversion(t *testing.T) {
+	events := []Event{}
+	progressReporter, err := NewProgressReporter("silent")
+	require.NoError(t, err)
+	pushOptions, err := PushOptions{
+		CacheDir:            "cache",
+		RepositorySettings:  RepositorySettings{Visibility: "internal", Topics: []string{"codeql"}},
+		AttestationSettings: AttestationSettings{Policy: "verify", Repository: "github/codeql-action"},
+		Events: func(event Event) {
+			events = append(events, event)
+		},
+		Progress: progressReporter,
+	}.internal()
+	require.NoError(t, err)
+	require.Equal(t, push.RepositorySettings{Visibility: "internal", Topics: []string{"codeql"}}, pushOptions.RepositorySettings)
+	require.Equal(t, push.AttestationSettings{Policy: "verify", Repository: "github/codeql-action"}, pushOptions.AttestationSettings)
+	require.NotNil(t, pushOptions.Progress)
+	pushOptions.Events.Emit(event.Event{Type: event.AssetFinished, Release: "codeql-bundle-20200630", Asset: "codeql-bundle.tar.gz", Status: "uploaded"})
+	require.Equal(t, []Event{{Type: EventAssetFinished, Release: "codeql-bundle-20200630", Asset: "codeql-bundle.tar.gz", Status: "uploaded"}}, events)
+}
+
+func TestNewPushResult(t *testing.T) {
+	result := newPushResult(&push.Result{
+		BundleVersions:    []string{"codeql-bundle-20200630"},
+		NewBundleVersions: []string{},
+		MovedReferences:   []push.MovedReference{{Reference: "refs/heads/main", From: "a", To: "b"}},
+	})
+	require.Equal(t, &PushResult{
+		BundleVersions:    []string{"codeql-bundle-20200630"},
+		NewBundleVersions: []string{},
+		MovedReferences:   []MovedReference{{Reference: "refs/heads/main", From: "a", To: "b"}},
+	}, result)
+}
+
+func TestNewCacheStatus(t *testing.T) {
+	startedAt := time.Date(2020, 6, 30, 12, 0, 0, 0, time.UTC)
+	status := newCacheStatus(&pull.CacheStatus{
+		Path:       "cache",
+		Version:    "1.0.0",
+		Compatible: true,
+		Lock:       &cachedirectory.LockInfo{User: "user", PID: 42, StartedAt: startedAt},
+		References: []pull.ReferenceStatus{{Name: "refs/heads/main", SHA: "a", BundleVersion: "codeql-bundle-20200630", BundleComplete: true}},
+		Releases:   []pull.ReleaseStatus{{Tag: "codeql-bundle-20200630", Assets: []pull.AssetStatus{{Name: "codeql-bundle.tar.gz", Size: 6, ExpectedSize: 6, Complete: true}}, Complete: true}},
+		DiskUsage:  6,
+	})
+	require.Equal(t, &CacheStatus{
+		Path:       "cache",
+		Version:    "1.0.0",
+		Compatible: true,
+		Lock:       &LockInfo{User: "user", PID: 42, StartedAt: startedAt},
+		References: []ReferenceStatus{{Name: "refs/heads/main", SHA: "a", BundleVersion: "codeql-bundle-20200630", BundleComplete: true}},
+		Releases:   []ReleaseStatus{{Tag: "codeql-bundle-20200630", Assets: []AssetStatus{{Name: "codeql-bundle.tar.gz", Size: 6, ExpectedSize: 6, Complete: true}}, Complete: true}},
+		DiskUsage:  6,
+	}, status)
+	require.Nil(t, newCacheStatus(&pull.CacheStatus{}).Lock)
+}
+
+func TestCacheDirRequired(t *testing.T) {
+	_, err := Pull(context.Background(), PullOptions{})
+	require.EqualError(t, err, errorCacheDirRequired)
+	_, err = Push(context.Background(), PushOptions{})
+	require.EqualError(t, err, errorCacheDirRequired)
+	err = Check(context.Background(), PushOptions{})
+	require.EqualError(t, err, errorCacheDirRequired)
+	err = Rollback(context.Background(), PushOptions{})
+	require.EqualError(t, err, errorCacheDirRequired)
+}
+
+func TestCategory(t *testing.T) {
+	pushOptions := PushOptions{CacheDir: test.CreateTemporaryDirectory(t)}
+	_, err := Push(context.Background(), pushOptions)
+	require.ErrorIs(t, err, ErrCacheInvalid)
+	require.Equal(t, ErrCacheInvalid, Category(err))
+}
@@ -0,0 +1,236 @@
+package actionsync
+
+import (
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/event"
+	"github.com/github/codeql-action-sync/internal/progress"
+	"github.com/github/codeql-action-sync/internal/pull"
+	"github.com/github/codeql-action-sync/internal/push"
+	"github.com/github/codeql-action-sync/internal/retry"
+)
+
+// RetryPolicy controls how network operations that fail with a transient error are retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction by which each backoff is randomly varied, e.g. `0.2` for up to 20% either way.
+	Jitter               float64
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy returns the retry policy that the command line tool uses by default.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy(retry.DefaultPolicy())
+}
+
+func (retryPolicy RetryPolicy) internal() retry.Policy {
+	if retryPolicy.MaxAttempts == 0 {
+		return retry.DefaultPolicy()
+	}
+	return retry.Policy(retryPolicy)
+}
+
+// Event is something that happened during a pull or push, such as a phase starting or an asset being transferred.
+type Event struct {
+	Type string `json:"type"`
+	// Phase is set for phase and Git progress events, and is one of `pullGit`, `pullReleases`, `pushGit` or `pushReleases`.
+	Phase   string `json:"phase,omitempty"`
+	Release string `json:"release,omitempty"`
+	Asset   string `json:"asset,omitempty"`
+	// Status is set when an asset is finished, and is one of `downloaded`, `cached`, `uploaded` or `existing`.
+	Status string `json:"status,omitempty"`
+	// Bytes and Total are set for asset events, and are the number of bytes transferred so far and the size of the asset.
+	Bytes int64 `json:"bytes,omitempty"`
+	Total int64 `json:"total,omitempty"`
+	// Message is set for Git progress events, and is a line of progress reported by the Git server.
+	Message string `json:"message,omitempty"`
+}
+
+const EventPhaseStarted = event.PhaseStarted
+const EventPhaseFinished = event.PhaseFinished
+const EventAssetStarted = event.AssetStarted
+const EventAssetProgress = event.AssetProgress
+const EventAssetFinished = event.AssetFinished
+const EventGitProgress = event.GitProgress
+
+// EventHandler is called synchronously with each event, so it should return quickly.
+type EventHandler func(Event)
+
+func (handler EventHandler) internal() event.Handler {
+	if handler == nil {
+		return nil
+	}
+	return func(e event.Event) {
+		handler(Event(e))
+	}
+}
+
+// ProgressReporter shows the progress of a pull or push to a person. Pulls and pushes report nothing if it is not set.
+type ProgressReporter struct {
+	reporter progress.Reporter
+}
+
+// NewProgressReporter returns the reporter for one of the modes of the `--progress` argument: `tty`, `plain`, `json`, `silent` or `auto`.
+func NewProgressReporter(mode string) (*ProgressReporter, error) {
+	reporter, err := progress.New(mode)
+	if err != nil {
+		return nil, err
+	}
+	return &ProgressReporter{reporter: reporter}, nil
+}
+
+func (progressReporter *ProgressReporter) internal() progress.Reporter {
+	if progressReporter == nil {
+		return nil
+	}
+	return progressReporter.reporter
+}
+
+type RepositorySettings struct {
+	// Visibility is `public`, `internal` or `private`, or empty to leave it unchanged.
+	Visibility  string
+	Description string
+	Topics      []string
+	// ActionsAccess is `none`, `organization` or `enterprise`, or empty to leave it unchanged.
+	ActionsAccess string
+}
+
+type AttestationSettings struct {
+	// Policy is `verify`, `warn` or `skip` (the default).
+	Policy string
+	// TrustedRoot is the path of a Sigstore trusted root file to use instead of the one bundled with the sync tool.
+	TrustedRoot string
+	// Repository is the repository whose GitHub Actions workflows are trusted to attest to the CodeQL bundles. It defaults to `github/codeql-action`.
+	Repository string
+	// SignerWorkflow is the workflow that must have signed the attestations, e.g. `github/codeql-action/.github/workflows/release.yml`. Any workflow in the repository is accepted if it is empty.
+	SignerWorkflow string
+}
+
+// PullResult describes what is in the cache after a pull.
+type PullResult struct {
+	// BundleVersions are the CodeQL bundles that the synced branches and tags use.
+	BundleVersions []string `json:"bundle_versions"`
+	// References maps each synced branch and tag to the commit it is at in the cache, after pins are applied.
+	References map[string]string `json:"references"`
+}
+
+// MovedReference is a branch or tag that a push created or moved. From is empty if it was created.
+type MovedReference struct {
+	Reference string `json:"ref"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+}
+
+// PushResult describes what a push changed on the destination.
+type PushResult struct {
+	BundleVersions    []string         `json:"bundle_versions"`
+	NewBundleVersions []string         `json:"new_bundle_versions"`
+	MovedReferences   []MovedReference `json:"moved_references"`
+}
+
+func newPushResult(result *push.Result) *PushResult {
+	movedReferences := []MovedReference{}
+	for _, movedReference := range result.MovedReferences {
+		movedReferences = append(movedReferences, MovedReference(movedReference))
+	}
+	return &PushResult{
+		BundleVersions:    result.BundleVersions,
+		NewBundleVersions: result.NewBundleVersions,
+		MovedReferences:   movedReferences,
+	}
+}
+
+// LockInfo describes the pull that locked a cache directory.
+type LockInfo struct {
+	Hostname  string    `json:"hostname,omitempty"`
+	User      string    `json:"user,omitempty"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// InterruptedAt is set if the pull was stopped before it finished.
+	InterruptedAt *time.Time `json:"interrupted_at,omitempty"`
+}
+
+type ReferenceStatus struct {
+	Name       string    `json:"name"`
+	SHA        string    `json:"sha"`
+	CommitDate time.Time `json:"commit_date"`
+	// Pin is set if the reference was pinned to an earlier upstream version.
+	Pin           string `json:"pin,omitempty"`
+	BundleVersion string `json:"bundle_version"`
+	// BundleComplete is whether every asset of the bundle the reference needs is in the cache.
+	BundleComplete bool `json:"bundle_complete"`
+}
+
+type AssetStatus struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	ExpectedSize int64  `json:"expected_size"`
+	// PartialSize is how much of an asset that is not complete has been downloaded so far.
+	PartialSize int64 `json:"partial_size,omitempty"`
+	Complete    bool  `json:"complete"`
+}
+
+type ReleaseStatus struct {
+	Tag string `json:"tag"`
+	// Missing is set if a reference needs the release, but it has not been pulled at all.
+	Missing  bool          `json:"missing,omitempty"`
+	Assets   []AssetStatus `json:"assets"`
+	Complete bool          `json:"complete"`
+	// Unused is set if no reference needs the release any more, so the next pull will not update it.
+	Unused bool `json:"unused,omitempty"`
+}
+
+// CacheStatus describes the references, releases and lock of a cache directory, as the `status` command shows them.
+type CacheStatus struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// Compatible is whether the cache was created by this version of the sync tool, which it must be to be pushed.
+	Compatible bool `json:"compatible"`
+	// Lock is set if the cache directory is locked by a pull.
+	Lock       *LockInfo         `json:"lock"`
+	References []ReferenceStatus `json:"references"`
+	Releases   []ReleaseStatus   `json:"releases"`
+	DiskUsage  int64             `json:"disk_usage"`
+}
+
+func newCacheStatus(status *pull.CacheStatus) *CacheStatus {
+	var lock *LockInfo
+	if status.Lock != nil {
+		lock = newLockInfo(*status.Lock)
+	}
+	references := []ReferenceStatus{}
+	for _, reference := range status.References {
+		references = append(references, ReferenceStatus(reference))
+	}
+	releases := []ReleaseStatus{}
+	for _, release := range status.Releases {
+		assets := []AssetStatus{}
+		for _, asset := range release.Assets {
+			assets = append(assets, AssetStatus(asset))
+		}
+		releases = append(releases, ReleaseStatus{
+			Tag:      release.Tag,
+			Missing:  release.Missing,
+			Assets:   assets,
+			Complete: release.Complete,
+			Unused:   release.Unused,
+		})
+	}
+	return &CacheStatus{
+		Path:       status.Path,
+		Version:    status.Version,
+		Compatible: status.Compatible,
+		Lock:       lock,
+		References: references,
+		Releases:   releases,
+		DiskUsage:  status.DiskUsage,
+	}
+}
+
+func newLockInfo(lockInfo cachedirectory.LockInfo) *LockInfo {
+	publicLockInfo := LockInfo(lockInfo)
+	return &publicLockInfo
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/github/codeql-action-sync/internal/push"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the destination token has the access required to push the CodeQL Action to a GitHub Enterprise Server installation.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version.LogVersion()
+		return push.Check(cmd.Context(), checkFlags.options())
+	},
+}
+
+type checkFlagFields struct {
+	destinationFlagFields
+	actionsAdminUser string
+	force            bool
+}
+
+var checkFlags = checkFlagFields{}
+
+func (f *checkFlagFields) Init(cmd *cobra.Command) {
+	f.destinationFlagFields.Init(cmd)
+	cmd.Flags().StringVar(&f.actionsAdminUser, "actions-admin-user", "actions-admin", "The name of the Actions admin user.")
+	cmd.Flags().BoolVar(&f.force, "force", false, "Check as if the existing repository will be replaced even if it was not created by the sync tool.")
+}
+
+func (f *checkFlagFields) options() push.Options {
+	options := f.destinationFlagFields.options()
+	options.ActionsAdminUser = f.actionsAdminUser
+	options.Force = f.force
+	return options
+}
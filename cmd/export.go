@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/transfer"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the local cache as numbered volumes of a fixed size for transfer.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version.LogVersion()
+		cacheDirectory := cachedirectory.NewCacheDirectory(rootFlags.cacheDir)
+		volumeSize, err := transfer.ParseVolumeSize(exportFlags.volumeSize)
+		if err != nil {
+			return err
+		}
+		return transfer.Export(cacheDirectory, exportFlags.outputDirectory, volumeSize)
+	},
+}
+
+type exportFlagFields struct {
+	outputDirectory string
+	volumeSize      string
+}
+
+var exportFlags = exportFlagFields{}
+
+func (f *exportFlagFields) Init(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.outputDirectory, "output-dir", "", "The directory to write the volumes and their index to.")
+	cmd.MarkFlagRequired("output-dir")
+	cmd.Flags().StringVar(&f.volumeSize, "volume-size", "4G", "The maximum size of each volume, e.g. 4G (4,000,000,000 bytes) or 2GiB.")
+}
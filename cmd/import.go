@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/transfer"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Verify and reassemble volumes created by `export` into the local cache.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version.LogVersion()
+		cacheDirectory := cachedirectory.NewCacheDirectory(rootFlags.cacheDir)
+		return transfer.Import(cacheDirectory, importFlags.inputDirectory)
+	},
+}
+
+type importFlagFields struct {
+	inputDirectory string
+}
+
+var importFlags = importFlagFields{}
+
+func (f *importFlagFields) Init(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.inputDirectory, "input-dir", "", "The directory containing the volumes and their index.")
+	cmd.MarkFlagRequired("input-dir")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/metrics"
 	"github.com/github/codeql-action-sync/internal/pull"
 	"github.com/github/codeql-action-sync/internal/version"
 	"github.com/spf13/cobra"
@@ -12,20 +13,59 @@ var pullCmd = &cobra.Command{
 	Short: "Pull the CodeQL Action from GitHub to a local cache.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		version.LogVersion()
-		cacheDirectory := cachedirectory.NewCacheDirectory(rootFlags.cacheDir)
-		return pull.Pull(cmd.Context(), cacheDirectory, pullFlags.sourceToken, pullFlags.sourceURL)
+		_, err := pull.Pull(cmd.Context(), pullFlags.options())
+		metrics.RecordOutcome(metrics.OperationPull, err)
+		return err
 	},
 }
 
 type pullFlagFields struct {
-	sourceToken string
-	sourceURL   string
+	sourceToken         string
+	sourceURL           string
+	sourceEnterpriseURL string
+	sourceRepository    string
+	pins                map[string]string
+	trustedKeys         []string
+	strictSignatures    bool
+	manifestSigningKey  string
+	attestations        bool
+	sbom                bool
+	changelogFormat     string
 }
 
 var pullFlags = pullFlagFields{}
 
 func (f *pullFlagFields) Init(cmd *cobra.Command) {
-	cmd.Flags().StringVar(&f.sourceToken, "source-token", "", "A token to access the API of GitHub.com. This is normally not required, but can be provided if you have issues with API rate limiting.")
-	cmd.Flags().StringVar(&f.sourceURL, "source-url", "", "Use a custom Git URL for fetching the Action repository contents from. The CodeQL bundles will still be fetched from GitHub.com.")
+	cmd.Flags().StringVar(&f.sourceToken, "source-token", "", "A token to access the API of GitHub.com, or of the GitHub Enterprise instance if --source-enterprise-url is set. This is normally not required for GitHub.com, but can be provided if you have issues with API rate limiting.")
+	cmd.Flags().StringVar(&f.sourceURL, "source-url", "", "Use a custom Git URL for fetching the Action repository contents from. The CodeQL bundles will still be fetched from GitHub.com or --source-enterprise-url.")
 	cmd.Flags().MarkHidden("source-url")
+	cmd.Flags().StringVar(&f.sourceEnterpriseURL, "source-enterprise-url", "", "The URL of a GitHub Enterprise instance to pull the Action and CodeQL bundles from instead of GitHub.com.")
+	cmd.Flags().StringVar(&f.sourceRepository, "source-repository", "github/codeql-action", "The name of the repository to pull the Action and CodeQL bundles from.")
+	cmd.Flags().StringToStringVar(&f.pins, "pin", nil, "Pin a branch or tag to an earlier upstream version instead of syncing its latest version, e.g. `v3=v3.24.10` or `main=<commit SHA>`. Can be repeated.")
+	cmd.Flags().StringSliceVar(&f.trustedKeys, "trusted-keys", nil, "Files containing the PGP or SSH public keys that commits and tags in the source repository are trusted to be signed by. If provided, the signatures on the synced branches and tags are verified.")
+	cmd.Flags().StringVar(&f.manifestSigningKey, "manifest-signing-key", "", "A PGP or SSH (e.g. ed25519) private key to sign a manifest of the cache contents with, so that `push` can check the cache has not been tampered with.")
+	cmd.Flags().BoolVar(&f.attestations, "attestations", false, "Download the build provenance attestations of the CodeQL bundles so that `push` can verify them with `--attestation-policy`.")
+	cmd.Flags().BoolVar(&f.sbom, "sbom", false, "Generate a CycloneDX SBOM for each cached CodeQL bundle, describing its assets and the Action commits that use it.")
+	cmd.Flags().StringVar(&f.changelogFormat, "changelog", "", "Write a changelog of how the Action's branches and tags changed since the last pull to the cache directory, as markdown or html.")
+	cmd.Flags().BoolVar(&f.strictSignatures, "strict-signatures", false, "Remove branches and tags without a valid signature from a trusted key from the cache, and fail if any of them are synced branches or tags.")
+}
+
+func (f *pullFlagFields) options() pull.Options {
+	return pull.Options{
+		CacheDirectory:      cachedirectory.NewCacheDirectory(rootFlags.cacheDir),
+		SourceToken:         f.sourceToken,
+		SourceURL:           f.sourceURL,
+		SourceEnterpriseURL: f.sourceEnterpriseURL,
+		SourceRepository:    f.sourceRepository,
+		MaxRateLimitWait:    rootFlags.maxRateLimitWait,
+		RetryPolicy:         rootFlags.retryPolicy,
+		Progress:            rootFlags.progress,
+		Pins:                f.pins,
+		TrustedKeys:         f.trustedKeys,
+		StrictSignatures:    f.strictSignatures,
+		ManifestSigningKey:  f.manifestSigningKey,
+		Attestations:        f.attestations,
+		SBOM:                f.sbom,
+		ChangelogFormat:     f.changelogFormat,
+	}
 }
@@ -3,8 +3,10 @@ package cmd
 import (
 	"os"
 
+	"github.com/github/codeql-action-sync/internal/attestation"
 	"github.com/github/codeql-action-sync/internal/cachedirectory"
 	"github.com/github/codeql-action-sync/internal/environment"
+	"github.com/github/codeql-action-sync/internal/metrics"
 	"github.com/github/codeql-action-sync/internal/push"
 	"github.com/github/codeql-action-sync/internal/version"
 	"github.com/spf13/cobra"
@@ -15,26 +17,24 @@ var pushCmd = &cobra.Command{
 	Short: "Push the CodeQL Action from the local cache to a GitHub Enterprise Server installation.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		version.LogVersion()
-		cacheDirectory := cachedirectory.NewCacheDirectory(rootFlags.cacheDir)
-		return push.Push(cmd.Context(), cacheDirectory, pushFlags.destinationURL, pushFlags.destinationToken, pushFlags.destinationRepository, pushFlags.actionsAdminUser, pushFlags.force, pushFlags.pushSSH, pushFlags.gitURL)
+		_, err := push.Push(cmd.Context(), pushFlags.options())
+		metrics.RecordOutcome(metrics.OperationPush, err)
+		return err
 	},
 }
 
-type pushFlagFields struct {
+// destinationFlagFields are the flags needed to reach the destination repository, shared by every command that connects to it.
+type destinationFlagFields struct {
 	destinationURL        string
+	destinationType       string
 	destinationToken      string
 	destinationRepository string
-	actionsAdminUser      string
-	force                 bool
-	pushSSH               bool
-	gitURL                string
 }
 
-var pushFlags = pushFlagFields{}
-
-func (f *pushFlagFields) Init(cmd *cobra.Command) {
-	cmd.Flags().StringVar(&f.destinationURL, "destination-url", "", "The URL of the GitHub Enterprise instance to push to.")
+func (f *destinationFlagFields) Init(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.destinationURL, "destination-url", "", "The URL of the GitHub Enterprise instance to push to (e.g. `https://github.example.com`, `https://octocorp.ghe.com` or `https://github.com`).")
 	cmd.MarkFlagRequired("destination-url")
+	cmd.Flags().StringVar(&f.destinationType, "destination-type", push.DestinationTypeAuto, "The type of the destination: `ghes` (GitHub Enterprise Server), `ghae` (GitHub AE), `ghe.com` (GitHub Enterprise Cloud with data residency) or `github.com`. By default this is detected automatically.")
 	cmd.Flags().StringVar(&f.destinationToken, "destination-token", "", "A token to access the API on the GitHub Enterprise instance (can also be provided by setting the "+environment.DestinationToken+" environment variable).")
 	if f.destinationToken == "" {
 		f.destinationToken = os.Getenv(environment.DestinationToken)
@@ -43,9 +43,101 @@ func (f *pushFlagFields) Init(cmd *cobra.Command) {
 		}
 	}
 	cmd.Flags().StringVar(&f.destinationRepository, "destination-repository", "github/codeql-action", "The name of the repository to create on GitHub Enterprise.")
+}
+
+func (f *destinationFlagFields) options() push.Options {
+	return push.Options{
+		CacheDirectory:        cachedirectory.NewCacheDirectory(rootFlags.cacheDir),
+		DestinationURL:        f.destinationURL,
+		DestinationType:       f.destinationType,
+		DestinationToken:      f.destinationToken,
+		DestinationRepository: f.destinationRepository,
+		MaxRateLimitWait:      rootFlags.maxRateLimitWait,
+		RetryPolicy:           rootFlags.retryPolicy,
+		Progress:              rootFlags.progress,
+	}
+}
+
+const stateDirUsage = "The path to a local directory to record the state of the destination repository in before each push, so that it can be rolled back. It is kept outside the cache directory, which may be replaced between pushes. By default it is a push-state directory next to the cache directory."
+
+type pushFlagFields struct {
+	destinationFlagFields
+	actionsAdminUser       string
+	stateDir               string
+	force                  bool
+	pushSSH                bool
+	gitURL                 string
+	incompatibleReferences string
+	driftedReferences      string
+	repositoryVisibility   string
+	repositoryDescription  string
+	repositoryTopics       []string
+	actionsAccess          string
+	protectRefs            bool
+	manifestKeys           []string
+	attestationPolicy      string
+	attestationTrustedRoot string
+	attestationRepository  string
+	attestationSigner      string
+	uploadSBOM             bool
+}
+
+var pushFlags = pushFlagFields{}
+
+func (f *pushFlagFields) Init(cmd *cobra.Command) {
+	f.destinationFlagFields.Init(cmd)
 	cmd.Flags().StringVar(&f.actionsAdminUser, "actions-admin-user", "actions-admin", "The name of the Actions admin user.")
+	cmd.Flags().StringVar(&f.stateDir, "state-dir", "", stateDirUsage)
 	cmd.Flags().BoolVar(&f.force, "force", false, "Replace the existing repository even if it was not created by the sync tool.")
 	cmd.Flags().BoolVar(&f.pushSSH, "push-ssh", false, "Push Git contents over SSH rather than HTTPS. To use this option you must have SSH access to your GitHub Enterprise instance configured.")
 	cmd.Flags().StringVar(&f.gitURL, "git-url", "", "Use a custom Git URL for pushing the Action repository contents to.")
 	cmd.Flags().MarkHidden("git-url")
+	cmd.Flags().StringVar(&f.incompatibleReferences, "incompatible-refs", push.IncompatibleReferencesWarn, "What to do with versions of the CodeQL Action that the destination GitHub Enterprise Server version cannot run, or CodeQL bundles its runners may not be able to extract: `warn`, `refuse` to push anything, or `skip` those versions.")
+	cmd.Flags().StringVar(&f.driftedReferences, "drifted-refs", push.DriftedReferencesWarn, "What to do with references on the destination that have commits which are not in the upstream CodeQL Action: `warn` and overwrite them, `refuse` to push anything, `skip` those references, or `backup` them under `refs/sync-backup/` before overwriting them.")
+	cmd.Flags().StringVar(&f.repositoryVisibility, "repository-visibility", "", "The visibility of the destination repository: `public`, `internal` or `private`. By default it is `public` on GitHub Enterprise Server and `internal` elsewhere.")
+	cmd.Flags().StringVar(&f.repositoryDescription, "repository-description", "", "A description to set on the destination repository.")
+	cmd.Flags().StringSliceVar(&f.repositoryTopics, "repository-topics", nil, "A comma-separated list of topics to set on the destination repository.")
+	cmd.Flags().StringSliceVar(&f.manifestKeys, "manifest-verification-keys", nil, "Files containing the PGP or SSH public keys that the cache manifest must be signed by. If provided, nothing is pushed unless the manifest signature is valid and the cache contents match it.")
+	cmd.Flags().StringVar(&f.attestationPolicy, "attestation-policy", attestation.PolicySkip, "Whether to check the build provenance attestations of the CodeQL bundles (downloaded by `pull --attestations`) before pushing: `skip`, `warn` if they cannot be verified, or `verify` and refuse to push anything unless they are all valid.")
+	cmd.Flags().StringVar(&f.attestationTrustedRoot, "attestation-trusted-root", "", "A Sigstore trusted root file (e.g. from `gh attestation trusted-root`) to verify attestations against, instead of the one bundled with the sync tool.")
+	cmd.Flags().StringVar(&f.attestationRepository, "attestation-repository", "github/codeql-action", "The repository whose GitHub Actions workflows are trusted to attest to the CodeQL bundles.")
+	cmd.Flags().StringVar(&f.attestationSigner, "attestation-signer-workflow", "", "The workflow that must have signed the attestations, e.g. github/codeql-action/.github/workflows/release.yml. If not provided, any workflow run in the attestation repository is trusted.")
+	cmd.Flags().BoolVar(&f.uploadSBOM, "upload-sbom", false, "Upload the SBOM of each CodeQL bundle (generated by `pull --sbom`) as an extra asset of its release.")
+	cmd.Flags().BoolVar(&f.protectRefs, "protect-refs", false, "Protect the `main` branch and `v*` branches and tags on the destination so that only repository administrators (such as the identity used by the sync tool) can change them.")
+	cmd.Flags().StringVar(&f.actionsAccess, "actions-access", "", "Which repositories can use the Action when the destination repository is not public: `none`, `organization` or `enterprise`.")
+}
+
+func (f *pushFlagFields) options() push.Options {
+	options := f.destinationFlagFields.options()
+	options.ActionsAdminUser = f.actionsAdminUser
+	options.Force = f.force
+	options.PushSSH = f.pushSSH
+	options.GitURL = f.gitURL
+	options.IncompatibleReferences = f.incompatibleReferences
+	options.DriftedReferences = f.driftedReferences
+	options.RepositorySettings = f.repositorySettings()
+	options.ProtectRefs = f.protectRefs
+	options.ManifestKeys = f.manifestKeys
+	options.AttestationSettings = f.attestationSettings()
+	options.UploadSBOM = f.uploadSBOM
+	options.StateDirectory = f.stateDir
+	return options
+}
+
+func (f *pushFlagFields) attestationSettings() push.AttestationSettings {
+	return push.AttestationSettings{
+		Policy:         f.attestationPolicy,
+		TrustedRoot:    f.attestationTrustedRoot,
+		Repository:     f.attestationRepository,
+		SignerWorkflow: f.attestationSigner,
+	}
+}
+
+func (f *pushFlagFields) repositorySettings() push.RepositorySettings {
+	return push.RepositorySettings{
+		Visibility:    f.repositoryVisibility,
+		Description:   f.repositoryDescription,
+		Topics:        f.repositoryTopics,
+		ActionsAccess: f.actionsAccess,
+	}
 }
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/github/codeql-action-sync/internal/push"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back the destination repository to its state before the last push.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version.LogVersion()
+		return push.Rollback(cmd.Context(), rollbackFlags.options())
+	},
+}
+
+type rollbackFlagFields struct {
+	destinationFlagFields
+	actionsAdminUser string
+	stateDir         string
+}
+
+var rollbackFlags = rollbackFlagFields{}
+
+func (f *rollbackFlagFields) Init(cmd *cobra.Command) {
+	f.destinationFlagFields.Init(cmd)
+	cmd.Flags().StringVar(&f.actionsAdminUser, "actions-admin-user", "actions-admin", "The name of the Actions admin user.")
+	cmd.Flags().StringVar(&f.stateDir, "state-dir", "", stateDirUsage)
+}
+
+func (f *rollbackFlagFields) options() push.Options {
+	options := f.destinationFlagFields.options()
+	options.ActionsAdminUser = f.actionsAdminUser
+	options.StateDirectory = f.stateDir
+	return options
+}
@@ -7,11 +7,19 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/github/codeql-action-sync/internal/progress"
+	"github.com/github/codeql-action-sync/internal/retry"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+const pushgatewayJob = "codeql-action-sync"
+const pushgatewayTimeout = 30 * time.Second
+
 var rootCmd = &cobra.Command{
 	Use:           "codeql-action-sync",
 	Short:         "A tool for syncing the CodeQL Action from GitHub.com to GitHub Enterprise Server.",
@@ -20,8 +28,13 @@ var rootCmd = &cobra.Command{
 }
 
 type rootFlagFields struct {
-	cacheDir string
-	insecure bool
+	cacheDir         string
+	insecure         bool
+	maxRateLimitWait time.Duration
+	retryPolicy      retry.Policy
+	pushgatewayURL   string
+	progressMode     string
+	progress         progress.Reporter
 }
 
 var rootFlags = rootFlagFields{}
@@ -38,10 +51,22 @@ func (f *rootFlagFields) Init(cmd *cobra.Command) error {
 
 	cmd.PersistentFlags().StringVar(&f.cacheDir, "cache-dir", defaultCacheDir, "The path to a local directory to cache the Action in.")
 	cmd.PersistentFlags().BoolVar(&f.insecure, "insecure", false, "Allow insecure server connections when using TLS")
-	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+	cmd.PersistentFlags().DurationVar(&f.maxRateLimitWait, "max-rate-limit-wait", time.Hour, "The maximum time to wait for a GitHub API rate limit to reset before giving up.")
+	defaultRetryPolicy := retry.DefaultPolicy()
+	cmd.PersistentFlags().IntVar(&f.retryPolicy.MaxAttempts, "retry-max-attempts", defaultRetryPolicy.MaxAttempts, "The maximum number of attempts for each network operation before giving up.")
+	cmd.PersistentFlags().DurationVar(&f.retryPolicy.InitialBackoff, "retry-initial-backoff", defaultRetryPolicy.InitialBackoff, "How long to wait before retrying a failed network operation for the first time. The wait doubles after each subsequent failure.")
+	cmd.PersistentFlags().DurationVar(&f.retryPolicy.MaxBackoff, "retry-max-backoff", defaultRetryPolicy.MaxBackoff, "The maximum time to wait between retries of a failed network operation.")
+	cmd.PersistentFlags().Float64Var(&f.retryPolicy.Jitter, "retry-jitter", defaultRetryPolicy.Jitter, "The fraction by which each wait between retries is randomly varied.")
+	cmd.PersistentFlags().IntSliceVar(&f.retryPolicy.RetryableStatusCodes, "retry-status-codes", defaultRetryPolicy.RetryableStatusCodes, "The HTTP status codes for which a failed network operation will be retried.")
+	cmd.PersistentFlags().StringVar(&f.pushgatewayURL, "metrics-pushgateway", "", "The URL of a Prometheus Pushgateway to push metrics to when the command finishes, e.g. http://pushgateway:9091.")
+	cmd.PersistentFlags().StringVar(&f.progressMode, "progress", progress.ModeAuto, "How to report the progress of downloads, uploads and Git operations: tty (redraw it in place), plain (write a line every few seconds), json (write every event as JSON to standard output), silent, or auto (tty if standard error is a terminal, plain otherwise).")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
 		if f.insecure {
 			http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 		}
+		var err error
+		f.progress, err = progress.New(f.progressMode)
+		return err
 	}
 
 	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
@@ -72,6 +97,39 @@ func Execute(ctx context.Context) error {
 	rootCmd.AddCommand(syncCmd)
 	pullFlags.Init(syncCmd)
 	pushFlags.Init(syncCmd)
-
-	return rootCmd.ExecuteContext(ctx)
+	notifyFlags.Init(syncCmd)
+
+	rootCmd.AddCommand(serveCmd)
+	pullFlags.Init(serveCmd)
+	pushFlags.Init(serveCmd)
+	serveFlags.Init(serveCmd)
+	notifyFlags.Init(serveCmd)
+
+	rootCmd.AddCommand(checkCmd)
+	checkFlags.Init(checkCmd)
+
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackFlags.Init(rollbackCmd)
+
+	rootCmd.AddCommand(exportCmd)
+	exportFlags.Init(exportCmd)
+
+	rootCmd.AddCommand(importCmd)
+	importFlags.Init(importCmd)
+
+	rootCmd.AddCommand(statusCmd)
+	statusFlags.Init(statusCmd)
+
+	executedCmd, err := rootCmd.ExecuteContextC(ctx)
+	if rootFlags.pushgatewayURL != "" {
+		// The command's context may already have been cancelled, but the metrics are still worth pushing.
+		pushContext, cancel := context.WithTimeout(context.Background(), pushgatewayTimeout)
+		defer cancel()
+		// Each command pushes to its own group, so that e.g. a `push` does not replace the metrics of the last `pull`.
+		pushErr := metrics.Push(pushContext, rootFlags.pushgatewayURL, pushgatewayJob, map[string]string{"command": executedCmd.Name()})
+		if pushErr != nil {
+			log.Warn(pushErr.Error())
+		}
+	}
+	return err
 }
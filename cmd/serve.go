@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	usererrors "errors"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/daemon"
+	"github.com/github/codeql-action-sync/internal/pull"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/spf13/cobra"
+)
+
+const errorIntervalAndSchedule = "Only one of `--interval` and `--schedule` can be provided."
+const errorInvalidInterval = "The interval must be positive."
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Sync the CodeQL Action repeatedly on a schedule in a long-running process.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version.LogVersion()
+		err := notifyFlags.load()
+		if err != nil {
+			return err
+		}
+		var schedule daemon.Schedule
+		if serveFlags.schedule != "" {
+			if cmd.Flags().Changed("interval") {
+				return usererrors.New(errorIntervalAndSchedule)
+			}
+			schedule, err = daemon.ParseCronSchedule(serveFlags.schedule)
+			if err != nil {
+				return err
+			}
+		} else {
+			if serveFlags.interval <= 0 {
+				return usererrors.New(errorInvalidInterval)
+			}
+			schedule = daemon.NewIntervalSchedule(serveFlags.interval)
+		}
+		fingerprint := func(ctx context.Context) (string, error) {
+			return pull.Fingerprint(ctx, pullFlags.options())
+		}
+		return daemon.New(schedule, runSync, fingerprint).Serve(cmd.Context(), serveFlags.listen)
+	},
+}
+
+type serveFlagFields struct {
+	interval time.Duration
+	schedule string
+	listen   string
+}
+
+var serveFlags = serveFlagFields{}
+
+func (f *serveFlagFields) Init(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&f.interval, "interval", 6*time.Hour, "How long to wait between syncs.")
+	cmd.Flags().StringVar(&f.schedule, "schedule", "", "A cron expression (e.g. \"0 2 * * *\" for 2am every day) in the local time zone to sync on, instead of a fixed interval.")
+	cmd.Flags().StringVar(&f.listen, "listen", "", "An address (e.g. `:8080`) to serve the `/healthz`, `/status` and `/metrics` endpoints on.")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/pull"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show what is in the local cache, and whether it is complete enough to push.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := pull.ValidateStatusFormat(statusFlags.format)
+		if err != nil {
+			return err
+		}
+		cacheDirectory := cachedirectory.NewCacheDirectory(rootFlags.cacheDir)
+		status, err := pull.InspectCache(cacheDirectory)
+		if err != nil {
+			return err
+		}
+		return status.Write(os.Stdout, statusFlags.format)
+	},
+}
+
+type statusFlagFields struct {
+	format string
+}
+
+var statusFlags = statusFlagFields{}
+
+func (f *statusFlagFields) Init(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.format, "format", pull.StatusFormatTable, "The format to print the status in, either table or json.")
+}
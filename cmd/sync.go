@@ -1,10 +1,18 @@
 package cmd
 
 import (
-	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/github/codeql-action-sync/internal/notify"
 	"github.com/github/codeql-action-sync/internal/pull"
 	"github.com/github/codeql-action-sync/internal/push"
 	"github.com/github/codeql-action-sync/internal/version"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -13,15 +21,69 @@ var syncCmd = &cobra.Command{
 	Short: "Sync the CodeQL Action from GitHub to a GitHub Enterprise Server installation.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		version.LogVersion()
-		cacheDirectory := cachedirectory.NewCacheDirectory(rootFlags.cacheDir)
-		err := pull.Pull(cmd.Context(), cacheDirectory, pullFlags.sourceToken, pullFlags.sourceURL)
+		err := notifyFlags.load()
 		if err != nil {
 			return err
 		}
-		err = push.Push(cmd.Context(), cacheDirectory, pushFlags.destinationURL, pushFlags.destinationToken, pushFlags.destinationRepository, pushFlags.actionsAdminUser, pushFlags.force, pushFlags.pushSSH, pushFlags.gitURL)
-		if err != nil {
-			return err
-		}
-		return nil
+		return runSync(cmd.Context())
 	},
 }
+
+type notifyFlagFields struct {
+	webhookURL      string
+	webhookTemplate string
+	webhookOn       string
+
+	payloadTemplate *template.Template
+}
+
+var notifyFlags = notifyFlagFields{}
+
+func (f *notifyFlagFields) Init(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.webhookURL, "webhook-url", "", "A URL to post a JSON notification to after each sync, e.g. a Slack or Microsoft Teams incoming webhook.")
+	cmd.Flags().StringVar(&f.webhookTemplate, "webhook-template", notify.TemplateRaw, "The format of the webhook notification: raw, slack, teams, or the path to a file containing a Go template that renders the notification as JSON.")
+	cmd.Flags().StringVar(&f.webhookOn, "webhook-on", notify.OnAlways, "When to send a webhook notification: always, failure (only when a sync fails) or change (when a sync fails or changes the destination).")
+}
+
+func (f *notifyFlagFields) load() error {
+	if f.webhookURL == "" {
+		return nil
+	}
+	err := notify.ValidateOn(f.webhookOn)
+	if err != nil {
+		return err
+	}
+	f.payloadTemplate, err = notify.LoadTemplate(f.webhookTemplate)
+	return err
+}
+
+func (f *notifyFlagFields) send(ctx context.Context, outcome notify.Outcome) {
+	if f.webhookURL == "" || !outcome.ShouldSend(f.webhookOn) {
+		return
+	}
+	err := notify.Send(ctx, f.webhookURL, f.payloadTemplate, outcome)
+	if err != nil {
+		log.Warn(err.Error())
+	}
+}
+
+func runSync(ctx context.Context) error {
+	startedAt := time.Now()
+	result, err := pullAndPush(ctx)
+	notifyFlags.send(ctx, notify.NewOutcome(pullFlags.sourceRepository, fmt.Sprintf("%s/%s", strings.TrimRight(pushFlags.destinationURL, "/"), pushFlags.destinationRepository), startedAt, result, err))
+	return err
+}
+
+func pullAndPush(ctx context.Context) (*push.Result, error) {
+	_, err := pull.Pull(ctx, pullFlags.options())
+	metrics.RecordOutcome(metrics.OperationPull, err)
+	if err != nil {
+		return nil, err
+	}
+	result, err := push.Push(ctx, pushFlags.options())
+	metrics.RecordOutcome(metrics.OperationPush, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
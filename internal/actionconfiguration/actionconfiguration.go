@@ -3,9 +3,13 @@ package actionconfiguration
 import (
 	"encoding/json"
 
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/pkg/errors"
 )
 
+// DefaultConfigurationPath is where the Action keeps its default configuration, which names the CodeQL bundle it uses.
+const DefaultConfigurationPath = "src/defaults.json"
+
 const errorBundleVersionNotSet = "The property \"bundleVersion\" was not set in the Action default configuration."
 
 type ActionConfiguration struct {
@@ -23,3 +27,23 @@ func Parse(contents string) (*ActionConfiguration, error) {
 	}
 	return &result, nil
 }
+
+// BundleVersion returns the CodeQL bundle used by the Action at a commit, or an empty string if the commit has no default configuration.
+func BundleVersion(commit *object.Commit) (string, error) {
+	file, err := commit.File(DefaultConfigurationPath)
+	if err == object.ErrFileNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Error loading %s from commit %s.", DefaultConfigurationPath, commit.Hash)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return "", errors.Wrapf(err, "Error reading %s from commit %s.", DefaultConfigurationPath, commit.Hash)
+	}
+	configuration, err := Parse(content)
+	if err != nil {
+		return "", err
+	}
+	return configuration.BundleVersion, nil
+}
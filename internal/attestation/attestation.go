@@ -0,0 +1,590 @@
+package attestation
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	usererrors "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const PolicySkip = "skip"
+const PolicyWarn = "warn"
+const PolicyVerify = "verify"
+
+const errorInvalidPolicy = "The attestation policy %s is not valid. It should be one of `skip`, `warn` or `verify`."
+
+const inTotoPayloadType = "application/vnd.in-toto+json"
+const slsaProvenancePredicateTypePrefix = "https://slsa.dev/provenance/"
+const githubActionsIssuer = "https://token.actions.githubusercontent.com"
+
+// The Sigstore public-good trusted root, in the JSON Lines form output by `gh attestation trusted-root`. It is refreshed in a reviewed commit when Sigstore rotates its keys.
+//
+//go:embed trusted_root.jsonl
+var bundledTrustedRoot []byte
+
+var ErrNoAttestations = usererrors.New("there are no attestations for it")
+
+// Fulcio certificate extensions (see https://github.com/sigstore/fulcio/blob/main/docs/oid-info.md).
+var oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+var oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+var oidBuildSignerURI = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 9}
+var oidSourceRepositoryURI = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case PolicySkip, PolicyWarn, PolicyVerify:
+		return nil
+	default:
+		return fmt.Errorf(errorInvalidPolicy, policy)
+	}
+}
+
+// protoInt64 is an integer that may be encoded as a string, as Protobuf JSON does for 64-bit integers.
+type protoInt64 int64
+
+func (value *protoInt64) UnmarshalJSON(data []byte) error {
+	parsed, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*value = protoInt64(parsed)
+	return nil
+}
+
+type validity struct {
+	Start *time.Time `json:"start"`
+	End   *time.Time `json:"end"`
+}
+
+func (validity validity) contains(instant time.Time) bool {
+	return (validity.Start == nil || !instant.Before(*validity.Start)) && (validity.End == nil || !instant.After(*validity.End))
+}
+
+type rawBytes struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// TrustedRoot is the subset of a Sigstore trusted root (as output by `gh attestation trusted-root`) needed to verify attestations offline.
+type TrustedRoot struct {
+	Tlogs []struct {
+		PublicKey struct {
+			RawBytes []byte   `json:"rawBytes"`
+			ValidFor validity `json:"validFor"`
+		} `json:"publicKey"`
+		LogID struct {
+			KeyID []byte `json:"keyId"`
+		} `json:"logId"`
+	} `json:"tlogs"`
+	CertificateAuthorities []struct {
+		CertChain struct {
+			Certificates []rawBytes `json:"certificates"`
+		} `json:"certChain"`
+		ValidFor validity `json:"validFor"`
+	} `json:"certificateAuthorities"`
+}
+
+type tlogEntry struct {
+	LogIndex protoInt64 `json:"logIndex"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	IntegratedTime   protoInt64 `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex   protoInt64 `json:"logIndex"`
+		RootHash   []byte     `json:"rootHash"`
+		TreeSize   protoInt64 `json:"treeSize"`
+		Hashes     [][]byte   `json:"hashes"`
+		Checkpoint struct {
+			Envelope string `json:"envelope"`
+		} `json:"checkpoint"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+type sigstoreBundle struct {
+	VerificationMaterial struct {
+		Certificate          *rawBytes `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []rawBytes `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []tlogEntry `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	DSSEEnvelope *struct {
+		Payload     []byte `json:"payload"`
+		PayloadType string `json:"payloadType"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	} `json:"dsseEnvelope"`
+}
+
+type inTotoStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+}
+
+// Verifier checks Sigstore attestation bundles offline against a trusted root. Only bundles with a signed entry timestamp from a transparency log are supported; bundles that rely on RFC 3161 timestamps instead are rejected.
+type Verifier struct {
+	trustedRoots   []TrustedRoot
+	repository     string
+	signerWorkflow string
+}
+
+// LoadTrustedRoot reads a Sigstore trusted root file. The file may contain a single trusted root, or several in JSON Lines format.
+func LoadTrustedRoot(path string) ([]TrustedRoot, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading attestation trusted root.")
+	}
+	return parseTrustedRoot(content, path)
+}
+
+// BundledTrustedRoot returns the Sigstore public-good trusted root that is bundled with the sync tool.
+func BundledTrustedRoot() ([]TrustedRoot, error) {
+	return parseTrustedRoot(bundledTrustedRoot, "bundled with the sync tool")
+}
+
+func parseTrustedRoot(content []byte, source string) ([]TrustedRoot, error) {
+	trustedRoots := []TrustedRoot{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for {
+		trustedRoot := TrustedRoot{}
+		err := decoder.Decode(&trustedRoot)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error parsing attestation trusted root.")
+		}
+		trustedRoots = append(trustedRoots, trustedRoot)
+	}
+	if len(trustedRoots) == 0 {
+		return nil, fmt.Errorf("The attestation trusted root %s is empty.", source)
+	}
+	return trustedRoots, nil
+}
+
+// NewVerifier creates a verifier that accepts attestations made by GitHub Actions workflows run in the given repository, e.g. `github/codeql-action`. If signerWorkflow is not empty, the attestations must also have been signed by that workflow, given in the same `OWNER/REPO/PATH/TO/WORKFLOW.yml` form as `gh attestation verify --signer-workflow`.
+func NewVerifier(trustedRoots []TrustedRoot, repository string, signerWorkflow string) *Verifier {
+	return &Verifier{trustedRoots: trustedRoots, repository: repository, signerWorkflow: signerWorkflow}
+}
+
+func preAuthenticationEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func checkSignature(publicKey interface{}, message []byte, signature []byte) error {
+	switch publicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+			return usererrors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(publicKey, message, signature) {
+			return usererrors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+func (verifier *Verifier) verifyCertificate(leaf *x509.Certificate, intermediates []*x509.Certificate, signedAt time.Time) error {
+	var lastErr error = usererrors.New("no certificate authorities are trusted")
+	for _, trustedRoot := range verifier.trustedRoots {
+		for _, certificateAuthority := range trustedRoot.CertificateAuthorities {
+			if !certificateAuthority.ValidFor.contains(signedAt) || len(certificateAuthority.CertChain.Certificates) == 0 {
+				continue
+			}
+			roots := x509.NewCertPool()
+			intermediatePool := x509.NewCertPool()
+			for _, intermediate := range intermediates {
+				intermediatePool.AddCert(intermediate)
+			}
+			certificates := certificateAuthority.CertChain.Certificates
+			for index, certificateBytes := range certificates {
+				certificate, err := x509.ParseCertificate(certificateBytes.RawBytes)
+				if err != nil {
+					return errors.Wrap(err, "invalid certificate in trusted root")
+				}
+				if index == len(certificates)-1 {
+					roots.AddCert(certificate)
+				} else {
+					intermediatePool.AddCert(certificate)
+				}
+			}
+			_, err := leaf.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediatePool,
+				CurrentTime:   signedAt,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+			})
+			if err == nil {
+				return nil
+			}
+			lastErr = err
+		}
+	}
+	return errors.Wrap(lastErr, "the signing certificate is not trusted")
+}
+
+func certificateExtension(certificate *x509.Certificate, oid asn1.ObjectIdentifier, derEncoded bool) string {
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oid) {
+			continue
+		}
+		if !derEncoded {
+			return string(extension.Value)
+		}
+		var value string
+		_, err := asn1.UnmarshalWithParams(extension.Value, &value, "utf8")
+		if err == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+func (verifier *Verifier) verifyIdentity(leaf *x509.Certificate) error {
+	issuer := certificateExtension(leaf, oidIssuerV2, true)
+	if issuer == "" {
+		issuer = certificateExtension(leaf, oidIssuerV1, false)
+	}
+	if issuer != githubActionsIssuer {
+		return fmt.Errorf("it was not signed by a GitHub Actions workflow (the issuer is %q)", issuer)
+	}
+	// The signer is the workflow file that requested the certificate, which is also the subject of the certificate. It may be a reusable workflow in another repository.
+	signerURI := certificateExtension(leaf, oidBuildSignerURI, true)
+	if signerURI == "" && len(leaf.URIs) != 0 {
+		signerURI = leaf.URIs[0].String()
+	}
+	expectedRepositoryURI := "https://github.com/" + verifier.repository
+	repositoryURI := certificateExtension(leaf, oidSourceRepositoryURI, true)
+	if repositoryURI == "" {
+		// Older certificates do not record the source repository separately, but the signer is always in it.
+		if strings.HasPrefix(strings.ToLower(signerURI), strings.ToLower(expectedRepositoryURI+"/")) {
+			repositoryURI = expectedRepositoryURI
+		} else {
+			repositoryURI = signerURI
+		}
+	}
+	// Repository names on GitHub are not case sensitive.
+	if !strings.EqualFold(repositoryURI, expectedRepositoryURI) {
+		return fmt.Errorf("it was signed by a workflow run in %s, not %s", repositoryURI, expectedRepositoryURI)
+	}
+	if verifier.signerWorkflow != "" && !strings.HasPrefix(strings.ToLower(signerURI), strings.ToLower("https://github.com/"+verifier.signerWorkflow+"@")) {
+		return fmt.Errorf("it was signed by the workflow %s, not https://github.com/%s", signerURI, verifier.signerWorkflow)
+	}
+	return nil
+}
+
+func (verifier *Verifier) verifyTransparencyLogEntry(entry tlogEntry, payload []byte) error {
+	if entry.InclusionPromise == nil {
+		return usererrors.New("its transparency log entry has no signed entry timestamp")
+	}
+	integratedTime := time.Unix(int64(entry.IntegratedTime), 0)
+	for _, trustedRoot := range verifier.trustedRoots {
+		for _, tlog := range trustedRoot.Tlogs {
+			if !bytes.Equal(tlog.LogID.KeyID, entry.LogID.KeyID) {
+				continue
+			}
+			if !tlog.PublicKey.ValidFor.contains(integratedTime) {
+				return usererrors.New("its transparency log key was not valid at the time it was logged")
+			}
+			publicKey, err := x509.ParsePKIXPublicKey(tlog.PublicKey.RawBytes)
+			if err != nil {
+				return errors.Wrap(err, "invalid transparency log key in trusted root")
+			}
+			// The signed entry timestamp is a signature over the canonical JSON form of these fields, which json.Marshal produces for a map.
+			signedEntry, err := json.Marshal(map[string]interface{}{
+				"body":           base64.StdEncoding.EncodeToString(entry.CanonicalizedBody),
+				"integratedTime": int64(entry.IntegratedTime),
+				"logID":          hex.EncodeToString(entry.LogID.KeyID),
+				"logIndex":       int64(entry.LogIndex),
+			})
+			if err != nil {
+				return err
+			}
+			err = checkSignature(publicKey, signedEntry, entry.InclusionPromise.SignedEntryTimestamp)
+			if err != nil {
+				return errors.Wrap(err, "its signed entry timestamp is not valid")
+			}
+			err = verifyInclusionProof(entry, publicKey)
+			if err != nil {
+				return err
+			}
+			return verifyEntryBody(entry.CanonicalizedBody, payload)
+		}
+	}
+	return usererrors.New("it was logged in a transparency log that is not trusted")
+}
+
+func hashChildren(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{1})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
+
+// rootFromInclusionProof works out the root hash of a Merkle tree from the hash of a leaf and its inclusion proof, as described in RFC 9162 section 2.1.3.2.
+func rootFromInclusionProof(index int64, treeSize int64, leafHash []byte, proof [][]byte) ([]byte, error) {
+	if index < 0 || index >= treeSize {
+		return nil, fmt.Errorf("leaf index %d is outside a tree of size %d", index, treeSize)
+	}
+	fn, sn := index, treeSize-1
+	root := leafHash
+	for _, hash := range proof {
+		if sn == 0 {
+			return nil, usererrors.New("the proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			root = hashChildren(hash, root)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			root = hashChildren(root, hash)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, usererrors.New("the proof is too short")
+	}
+	return root, nil
+}
+
+// verifyCheckpoint checks that a checkpoint (a signed note, see https://github.com/transparency-dev/formats/blob/main/log/README.md) is signed by the transparency log and commits to the given tree.
+func verifyCheckpoint(envelope string, publicKey interface{}, treeSize int64, rootHash []byte) error {
+	separator := strings.Index(envelope, "\n\n")
+	if separator == -1 {
+		return usererrors.New("its checkpoint is not a signed note")
+	}
+	body := envelope[:separator+1]
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) < 3 || lines[1] != strconv.FormatInt(treeSize, 10) || lines[2] != base64.StdEncoding.EncodeToString(rootHash) {
+		return usererrors.New("its checkpoint is for a different tree than its inclusion proof")
+	}
+	for _, signatureLine := range strings.Split(envelope[separator+2:], "\n") {
+		if !strings.HasPrefix(signatureLine, "\u2014 ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(signatureLine, "\u2014 "))
+		if len(fields) != 2 {
+			continue
+		}
+		// The signature is prefixed by a four byte hint of which key made it.
+		signature, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(signature) <= 4 {
+			continue
+		}
+		if checkSignature(publicKey, []byte(body), signature[4:]) == nil {
+			return nil
+		}
+	}
+	return usererrors.New("its checkpoint is not signed by the transparency log")
+}
+
+// verifyInclusionProof checks that a transparency log entry is included in the log's Merkle tree, as committed to by a checkpoint that the log signed.
+func verifyInclusionProof(entry tlogEntry, publicKey interface{}) error {
+	proof := entry.InclusionProof
+	if proof == nil {
+		return usererrors.New("its transparency log entry has no inclusion proof")
+	}
+	leafHash := sha256.Sum256(append([]byte{0}, entry.CanonicalizedBody...))
+	root, err := rootFromInclusionProof(int64(proof.LogIndex), int64(proof.TreeSize), leafHash[:], proof.Hashes)
+	if err != nil {
+		return errors.Wrap(err, "its inclusion proof is not valid")
+	}
+	if !bytes.Equal(root, proof.RootHash) {
+		return usererrors.New("its inclusion proof does not match the root hash of the transparency log")
+	}
+	return verifyCheckpoint(proof.Checkpoint.Envelope, publicKey, int64(proof.TreeSize), proof.RootHash)
+}
+
+// verifyEntryBody checks that a transparency log entry is for this attestation.
+func verifyEntryBody(canonicalizedBody []byte, payload []byte) error {
+	body := struct {
+		Spec struct {
+			PayloadHash *struct {
+				Value string `json:"value"`
+			} `json:"payloadHash"`
+			Content *struct {
+				PayloadHash *struct {
+					Value string `json:"value"`
+				} `json:"payloadHash"`
+			} `json:"content"`
+		} `json:"spec"`
+	}{}
+	err := json.Unmarshal(canonicalizedBody, &body)
+	if err != nil {
+		return errors.Wrap(err, "its transparency log entry could not be parsed")
+	}
+	payloadHash := sha256.Sum256(payload)
+	loggedHash := ""
+	if body.Spec.PayloadHash != nil {
+		loggedHash = body.Spec.PayloadHash.Value
+	} else if body.Spec.Content != nil && body.Spec.Content.PayloadHash != nil {
+		loggedHash = body.Spec.Content.PayloadHash.Value
+	}
+	if loggedHash != hex.EncodeToString(payloadHash[:]) {
+		return usererrors.New("its transparency log entry is for a different attestation")
+	}
+	return nil
+}
+
+// VerifyBundle checks that a Sigstore bundle is a valid SLSA provenance attestation for the given SHA-256 digest. It checks the signing certificate and identity, the envelope signature, and each transparency log entry's signed entry timestamp, inclusion proof and checkpoint against the trusted root. It does not support bundles timestamped by a timestamp authority, does not check certificate revocation or transparency log consistency over time, and relies on the trusted root being up to date, since it never contacts Sigstore.
+func (verifier *Verifier) VerifyBundle(bundleJSON []byte, digest string) error {
+	bundle := sigstoreBundle{}
+	err := json.Unmarshal(bundleJSON, &bundle)
+	if err != nil {
+		return errors.Wrap(err, "it could not be parsed")
+	}
+	if bundle.DSSEEnvelope == nil || len(bundle.DSSEEnvelope.Signatures) == 0 {
+		return usererrors.New("it is not a signed DSSE envelope")
+	}
+	// A Sigstore bundle has a single signing certificate, so its envelope must have exactly one signature.
+	if len(bundle.DSSEEnvelope.Signatures) != 1 {
+		return fmt.Errorf("its envelope has %d signatures, but only one is expected", len(bundle.DSSEEnvelope.Signatures))
+	}
+	if len(bundle.VerificationMaterial.TlogEntries) == 0 {
+		return usererrors.New("it has no transparency log entries, and timestamp authorities are not supported")
+	}
+
+	certificates := []rawBytes{}
+	if bundle.VerificationMaterial.Certificate != nil {
+		certificates = append(certificates, *bundle.VerificationMaterial.Certificate)
+	} else if bundle.VerificationMaterial.X509CertificateChain != nil {
+		certificates = bundle.VerificationMaterial.X509CertificateChain.Certificates
+	}
+	if len(certificates) == 0 {
+		return usererrors.New("it has no signing certificate")
+	}
+	leaf, err := x509.ParseCertificate(certificates[0].RawBytes)
+	if err != nil {
+		return errors.Wrap(err, "its signing certificate could not be parsed")
+	}
+	intermediates := []*x509.Certificate{}
+	for _, certificate := range certificates[1:] {
+		intermediate, err := x509.ParseCertificate(certificate.RawBytes)
+		if err != nil {
+			return errors.Wrap(err, "its certificate chain could not be parsed")
+		}
+		intermediates = append(intermediates, intermediate)
+	}
+
+	envelope := bundle.DSSEEnvelope
+	for _, entry := range bundle.VerificationMaterial.TlogEntries {
+		err := verifier.verifyTransparencyLogEntry(entry, envelope.Payload)
+		if err != nil {
+			return err
+		}
+	}
+	// Fulcio certificates are only valid for a few minutes, so they are checked at the time the transparency log recorded the signature.
+	signedAt := time.Unix(int64(bundle.VerificationMaterial.TlogEntries[0].IntegratedTime), 0)
+	err = verifier.verifyCertificate(leaf, intermediates, signedAt)
+	if err != nil {
+		return err
+	}
+	err = verifier.verifyIdentity(leaf)
+	if err != nil {
+		return err
+	}
+	err = checkSignature(leaf.PublicKey, preAuthenticationEncoding(envelope.PayloadType, envelope.Payload), envelope.Signatures[0].Sig)
+	if err != nil {
+		return errors.Wrap(err, "its signature is not valid")
+	}
+
+	if envelope.PayloadType != inTotoPayloadType {
+		return fmt.Errorf("it has an unexpected payload type %s", envelope.PayloadType)
+	}
+	statement := inTotoStatement{}
+	err = json.Unmarshal(envelope.Payload, &statement)
+	if err != nil {
+		return errors.Wrap(err, "its statement could not be parsed")
+	}
+	if !strings.HasPrefix(statement.PredicateType, slsaProvenancePredicateTypePrefix) {
+		return fmt.Errorf("it is not a SLSA provenance attestation (the predicate type is %s)", statement.PredicateType)
+	}
+	for _, subject := range statement.Subject {
+		if subject.Digest["sha256"] == digest {
+			return nil
+		}
+	}
+	return usererrors.New("it is for a different file")
+}
+
+// DigestFile returns the hex-encoded SHA-256 digest of a file.
+func DigestFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Error opening file to digest.")
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading file to digest.")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyFile checks that at least one of the attestations in a JSON Lines file (as downloaded by `gh attestation download`) is valid for a file.
+func (verifier *Verifier) VerifyFile(attestationsPath string, path string) error {
+	attestationsFile, err := os.Open(attestationsPath)
+	if os.IsNotExist(err) {
+		return ErrNoAttestations
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error opening attestations.")
+	}
+	defer attestationsFile.Close()
+	digest, err := DigestFile(path)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(attestationsFile)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	var lastErr error = ErrNoAttestations
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lastErr = verifier.VerifyBundle(line, digest)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "Error reading attestations.")
+	}
+	return lastErr
+}
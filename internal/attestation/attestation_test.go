@@ -0,0 +1,390 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthority struct {
+	t               *testing.T
+	caKey           *ecdsa.PrivateKey
+	caCertificate   *x509.Certificate
+	rekorKey        *ecdsa.PrivateKey
+	rekorKeyID      []byte
+	integratedTime  time.Time
+	trustedRootJSON []byte
+}
+
+func newTestAuthority(t *testing.T) *testAuthority {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Fulcio"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caCertificateBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCertificate, err := x509.ParseCertificate(caCertificateBytes)
+	require.NoError(t, err)
+
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rekorPublicKey, err := x509.MarshalPKIXPublicKey(&rekorKey.PublicKey)
+	require.NoError(t, err)
+	rekorKeyID := sha256.Sum256(rekorPublicKey)
+
+	trustedRootJSON, err := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		"tlogs": []interface{}{map[string]interface{}{
+			"baseUrl":   "https://rekor.example.com",
+			"publicKey": map[string]interface{}{"rawBytes": rekorPublicKey, "validFor": map[string]interface{}{"start": now.Add(-time.Hour)}},
+			"logId":     map[string]interface{}{"keyId": rekorKeyID[:]},
+		}},
+		"certificateAuthorities": []interface{}{map[string]interface{}{
+			"certChain": map[string]interface{}{"certificates": []interface{}{map[string]interface{}{"rawBytes": caCertificateBytes}}},
+			"validFor":  map[string]interface{}{"start": now.Add(-time.Hour)},
+		}},
+	})
+	require.NoError(t, err)
+
+	return &testAuthority{
+		t:               t,
+		caKey:           caKey,
+		caCertificate:   caCertificate,
+		rekorKey:        rekorKey,
+		rekorKeyID:      rekorKeyID[:],
+		integratedTime:  now,
+		trustedRootJSON: trustedRootJSON,
+	}
+}
+
+func utf8Extension(t *testing.T, value string) []byte {
+	encoded, err := asn1.MarshalWithParams(value, "utf8")
+	require.NoError(t, err)
+	return encoded
+}
+
+func (authority *testAuthority) bundle(digest string, repository string, predicateType string) []byte {
+	t := authority.t
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	workflowURI, err := url.Parse("https://github.com/" + repository + "/.github/workflows/release.yml@refs/heads/main")
+	require.NoError(t, err)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    authority.integratedTime.Add(-time.Minute),
+		NotAfter:     authority.integratedTime.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{workflowURI},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuerV2, Value: utf8Extension(t, githubActionsIssuer)},
+			{Id: oidSourceRepositoryURI, Value: utf8Extension(t, "https://github.com/"+repository)},
+		},
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, leafTemplate, authority.caCertificate, &leafKey.PublicKey, authority.caKey)
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       []interface{}{map[string]interface{}{"name": "codeql-bundle.tar.gz", "digest": map[string]string{"sha256": digest}}},
+		"predicateType": predicateType,
+		"predicate":     map[string]interface{}{},
+	})
+	require.NoError(t, err)
+	paeDigest := sha256.Sum256(preAuthenticationEncoding(inTotoPayloadType, payload))
+	signature, err := ecdsa.SignASN1(rand.Reader, leafKey, paeDigest[:])
+	require.NoError(t, err)
+
+	payloadHash := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec":       map[string]interface{}{"payloadHash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])}},
+	})
+	require.NoError(t, err)
+	signedEntry, err := json.Marshal(map[string]interface{}{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": authority.integratedTime.Unix(),
+		"logID":          hex.EncodeToString(authority.rekorKeyID),
+		"logIndex":       42,
+	})
+	require.NoError(t, err)
+	signedEntryDigest := sha256.Sum256(signedEntry)
+	signedEntryTimestamp, err := ecdsa.SignASN1(rand.Reader, authority.rekorKey, signedEntryDigest[:])
+	require.NoError(t, err)
+
+	// The entry is the last of three in the log, so its inclusion proof is the hash of the subtree of the other two.
+	leafHash := func(leaf []byte) []byte {
+		hash := sha256.Sum256(append([]byte{0}, leaf...))
+		return hash[:]
+	}
+	otherEntries := hashChildren(leafHash([]byte("first entry")), leafHash([]byte("second entry")))
+	rootHash := hashChildren(otherEntries, leafHash(body))
+	checkpointBody := fmt.Sprintf("rekor.example.com - 1\n3\n%s\n", base64.StdEncoding.EncodeToString(rootHash))
+	checkpointDigest := sha256.Sum256([]byte(checkpointBody))
+	checkpointSignature, err := ecdsa.SignASN1(rand.Reader, authority.rekorKey, checkpointDigest[:])
+	require.NoError(t, err)
+	checkpoint := fmt.Sprintf("%s\n\u2014 rekor.example.com %s\n", checkpointBody, base64.StdEncoding.EncodeToString(append(authority.rekorKeyID[:4], checkpointSignature...)))
+
+	bundle, err := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{
+			"certificate": map[string]interface{}{"rawBytes": leafBytes},
+			"tlogEntries": []interface{}{map[string]interface{}{
+				"logIndex":         "42",
+				"logId":            map[string]interface{}{"keyId": authority.rekorKeyID},
+				"kindVersion":      map[string]string{"kind": "dsse", "version": "0.0.1"},
+				"integratedTime":   strconv.FormatInt(authority.integratedTime.Unix(), 10),
+				"inclusionPromise": map[string]interface{}{"signedEntryTimestamp": signedEntryTimestamp},
+				"inclusionProof": map[string]interface{}{
+					"logIndex":   "2",
+					"rootHash":   rootHash,
+					"treeSize":   "3",
+					"hashes":     [][]byte{otherEntries},
+					"checkpoint": map[string]string{"envelope": checkpoint},
+				},
+				"canonicalizedBody": body,
+			}},
+		},
+		"dsseEnvelope": map[string]interface{}{
+			"payload":     payload,
+			"payloadType": inTotoPayloadType,
+			"signatures":  []interface{}{map[string]interface{}{"sig": signature}},
+		},
+	})
+	require.NoError(t, err)
+	return bundle
+}
+
+func (authority *testAuthority) verifier(t *testing.T) *Verifier {
+	trustedRootPath := filepath.Join(test.CreateTemporaryDirectory(t), "trusted_root.jsonl")
+	require.NoError(t, ioutil.WriteFile(trustedRootPath, authority.trustedRootJSON, 0644))
+	trustedRoots, err := LoadTrustedRoot(trustedRootPath)
+	require.NoError(t, err)
+	return NewVerifier(trustedRoots, "github/codeql-action", "")
+}
+
+const testDigest = "6f1c7b3b1b1d3e0e4bd2f0c1d2b6ab37e1d1c92f5c1d3f4a6b8e9d0c1b2a3f4e"
+
+func TestVerifyValidBundle(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	require.NoError(t, verifier.VerifyBundle(authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1"), testDigest))
+}
+
+func TestVerifyBundleForDifferentFile(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	err := verifier.VerifyBundle(authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1"), "0000")
+	require.EqualError(t, err, "it is for a different file")
+}
+
+func TestVerifyBundleFromUntrustedRepository(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	err := verifier.VerifyBundle(authority.bundle(testDigest, "attacker/codeql-action", "https://slsa.dev/provenance/v1"), testDigest)
+	require.EqualError(t, err, "it was signed by a workflow run in https://github.com/attacker/codeql-action, not https://github.com/github/codeql-action")
+}
+
+func TestVerifyBundleFromOtherRepositoryOfSameOwner(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	err := verifier.VerifyBundle(authority.bundle(testDigest, "github/some-other-repository", "https://slsa.dev/provenance/v1"), testDigest)
+	require.EqualError(t, err, "it was signed by a workflow run in https://github.com/github/some-other-repository, not https://github.com/github/codeql-action")
+}
+
+func TestVerifyBundleFromOtherSignerWorkflow(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	bundle := authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1")
+	verifier.signerWorkflow = "github/codeql-action/.github/workflows/release.yml"
+	require.NoError(t, verifier.VerifyBundle(bundle, testDigest))
+	verifier.signerWorkflow = "github/codeql-action/.github/workflows/bundle.yml"
+	err := verifier.VerifyBundle(bundle, testDigest)
+	require.EqualError(t, err, "it was signed by the workflow https://github.com/github/codeql-action/.github/workflows/release.yml@refs/heads/main, not https://github.com/github/codeql-action/.github/workflows/bundle.yml")
+}
+
+func TestVerifyBundleWithOtherPredicate(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	err := verifier.VerifyBundle(authority.bundle(testDigest, "github/codeql-action", "https://spdx.dev/Document/v2.3"), testDigest)
+	require.EqualError(t, err, "it is not a SLSA provenance attestation (the predicate type is https://spdx.dev/Document/v2.3)")
+}
+
+func TestVerifyBundleFromUntrustedAuthority(t *testing.T) {
+	authority := newTestAuthority(t)
+	otherAuthority := newTestAuthority(t)
+	verifier := otherAuthority.verifier(t)
+	err := verifier.VerifyBundle(authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1"), testDigest)
+	require.EqualError(t, err, "it was logged in a transparency log that is not trusted")
+}
+
+func TestVerifyTamperedBundle(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	bundle := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1"), &bundle))
+	bundle["dsseEnvelope"].(map[string]interface{})["payload"] = base64.StdEncoding.EncodeToString([]byte(`{"predicateType":"https://slsa.dev/provenance/v1","subject":[{"digest":{"sha256":"0000"}}]}`))
+	tampered, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	err = verifier.VerifyBundle(tampered, "0000")
+	require.EqualError(t, err, "its transparency log entry is for a different attestation")
+}
+
+func modifyBundle(t *testing.T, bundleJSON []byte, modify func(bundle map[string]interface{})) []byte {
+	bundle := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(bundleJSON, &bundle))
+	modify(bundle)
+	modified, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	return modified
+}
+
+func inclusionProof(bundle map[string]interface{}) map[string]interface{} {
+	tlogEntry := bundle["verificationMaterial"].(map[string]interface{})["tlogEntries"].([]interface{})[0].(map[string]interface{})
+	return tlogEntry["inclusionProof"].(map[string]interface{})
+}
+
+func TestVerifyBundleWithInvalidInclusionProof(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	bundle := authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1")
+
+	withoutProof := modifyBundle(t, bundle, func(bundle map[string]interface{}) {
+		tlogEntry := bundle["verificationMaterial"].(map[string]interface{})["tlogEntries"].([]interface{})[0].(map[string]interface{})
+		delete(tlogEntry, "inclusionProof")
+	})
+	require.EqualError(t, verifier.VerifyBundle(withoutProof, testDigest), "its transparency log entry has no inclusion proof")
+
+	wrongHash := modifyBundle(t, bundle, func(bundle map[string]interface{}) {
+		otherHash := sha256.Sum256([]byte("not in the log"))
+		inclusionProof(bundle)["hashes"] = [][]byte{otherHash[:]}
+	})
+	require.EqualError(t, verifier.VerifyBundle(wrongHash, testDigest), "its inclusion proof does not match the root hash of the transparency log")
+
+	wrongIndex := modifyBundle(t, bundle, func(bundle map[string]interface{}) {
+		inclusionProof(bundle)["logIndex"] = "1"
+	})
+	require.EqualError(t, verifier.VerifyBundle(wrongIndex, testDigest), "its inclusion proof is not valid: the proof is too short")
+
+	// A checkpoint signed by another log does not prove that this log includes the entry.
+	otherCheckpoint := modifyBundle(t, bundle, func(bundle map[string]interface{}) {
+		otherBundle := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(newTestAuthority(t).bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1"), &otherBundle))
+		inclusionProof(bundle)["checkpoint"] = inclusionProof(otherBundle)["checkpoint"]
+	})
+	require.Error(t, verifier.VerifyBundle(otherCheckpoint, testDigest))
+}
+
+func TestVerifyBundleWithSeveralSignatures(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	bundle := modifyBundle(t, authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1"), func(bundle map[string]interface{}) {
+		envelope := bundle["dsseEnvelope"].(map[string]interface{})
+		envelope["signatures"] = append(envelope["signatures"].([]interface{}), envelope["signatures"].([]interface{})[0])
+	})
+	require.EqualError(t, verifier.VerifyBundle(bundle, testDigest), "its envelope has 2 signatures, but only one is expected")
+}
+
+func TestRootFromInclusionProof(t *testing.T) {
+	leaves := [][]byte{}
+	for index := 0; index < 7; index++ {
+		hash := sha256.Sum256([]byte{0, byte(index)})
+		leaves = append(leaves, hash[:])
+	}
+	// The tree of seven leaves is ((0 1) (2 3)) ((4 5) 6).
+	node01 := hashChildren(leaves[0], leaves[1])
+	node23 := hashChildren(leaves[2], leaves[3])
+	node45 := hashChildren(leaves[4], leaves[5])
+	node0123 := hashChildren(node01, node23)
+	node456 := hashChildren(node45, leaves[6])
+	root := hashChildren(node0123, node456)
+
+	for index, proof := range map[int64][][]byte{
+		0: {leaves[1], node23, node456},
+		3: {leaves[2], node01, node456},
+		5: {leaves[4], leaves[6], node0123},
+		6: {node45, node0123},
+	} {
+		computedRoot, err := rootFromInclusionProof(index, 7, leaves[index], proof)
+		require.NoError(t, err)
+		require.Equal(t, root, computedRoot, "leaf %d", index)
+	}
+	_, err := rootFromInclusionProof(6, 7, leaves[6], [][]byte{node45})
+	require.EqualError(t, err, "the proof is too short")
+	_, err = rootFromInclusionProof(7, 7, leaves[6], [][]byte{})
+	require.EqualError(t, err, "leaf index 7 is outside a tree of size 7")
+}
+
+func TestVerifyFile(t *testing.T) {
+	authority := newTestAuthority(t)
+	verifier := authority.verifier(t)
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	assetPath := filepath.Join(temporaryDirectory, "codeql-bundle.tar.gz")
+	require.NoError(t, ioutil.WriteFile(assetPath, []byte("Not really a bundle."), 0644))
+	digest, err := DigestFile(assetPath)
+	require.NoError(t, err)
+	attestationsPath := filepath.Join(temporaryDirectory, "codeql-bundle.tar.gz.jsonl")
+
+	require.Equal(t, ErrNoAttestations, verifier.VerifyFile(attestationsPath, assetPath))
+
+	otherBundle := authority.bundle(testDigest, "github/codeql-action", "https://slsa.dev/provenance/v1")
+	require.NoError(t, ioutil.WriteFile(attestationsPath, append(otherBundle, '\n'), 0644))
+	require.EqualError(t, verifier.VerifyFile(attestationsPath, assetPath), "it is for a different file")
+
+	bundle := authority.bundle(digest, "github/codeql-action", "https://slsa.dev/provenance/v1")
+	require.NoError(t, ioutil.WriteFile(attestationsPath, append(append(otherBundle, '\n'), append(bundle, '\n')...), 0644))
+	require.NoError(t, verifier.VerifyFile(attestationsPath, assetPath))
+}
+
+func TestValidatePolicy(t *testing.T) {
+	require.NoError(t, ValidatePolicy(PolicyVerify))
+	require.EqualError(t, ValidatePolicy("maybe"), "The attestation policy maybe is not valid. It should be one of `skip`, `warn` or `verify`.")
+}
+
+func TestBundledTrustedRoot(t *testing.T) {
+	trustedRoots, err := BundledTrustedRoot()
+	require.NoError(t, err)
+	require.Len(t, trustedRoots, 1)
+	require.NotEmpty(t, trustedRoots[0].Tlogs)
+	for _, tlog := range trustedRoots[0].Tlogs {
+		_, err := x509.ParsePKIXPublicKey(tlog.PublicKey.RawBytes)
+		require.NoError(t, err)
+		keyID := sha256.Sum256(tlog.PublicKey.RawBytes)
+		require.Equal(t, keyID[:], tlog.LogID.KeyID)
+	}
+	require.NotEmpty(t, trustedRoots[0].CertificateAuthorities)
+	for _, certificateAuthority := range trustedRoots[0].CertificateAuthorities {
+		require.NotEmpty(t, certificateAuthority.CertChain.Certificates)
+		for _, certificate := range certificateAuthority.CertChain.Certificates {
+			_, err := x509.ParseCertificate(certificate.RawBytes)
+			require.NoError(t, err)
+		}
+	}
+}
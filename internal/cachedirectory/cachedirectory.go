@@ -1,12 +1,17 @@
 package cachedirectory
 
 import (
+	"encoding/json"
 	usererrors "errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
+	"time"
 
+	"github.com/github/codeql-action-sync/internal/errorcategory"
 	"github.com/pkg/errors"
 )
 
@@ -15,6 +20,7 @@ const errorNotACacheOrEmpty = "The cache directory you have selected is not empt
 const errorCacheParentDoesNotExist = "Cannot create cache directory because its parent, does not exist."
 const errorPushNonCache = "The cache directory you have provided does not appear to be valid. Please check it exists and that you have run the `pull` command to populate it."
 const errorCacheLocked = "The cache directory is locked, likely due to a `pull` command being interrupted. Please run `pull` again to ensure all required data is downloaded."
+const errorCacheInterrupted = "The cache directory is locked because a `pull` command was interrupted at %s. Please run `pull` again, and it will resume from where it stopped."
 
 type CacheDirectory struct {
 	path string
@@ -26,6 +32,10 @@ func NewCacheDirectory(path string) CacheDirectory {
 	}
 }
 
+func (cacheDirectory *CacheDirectory) Path() string {
+	return cacheDirectory.path
+}
+
 func isAccessibleDirectory(path string) (bool, error) {
 	_, err := os.Stat(path)
 
@@ -119,22 +129,59 @@ func (cacheDirectory *CacheDirectory) CheckOrCreateVersionFile(pull bool, versio
 			}
 			return nil
 		}
-		return usererrors.New(errorNotACacheOrEmpty)
+		return errorcategory.New(errorcategory.ErrCacheInvalid, errorNotACacheOrEmpty)
 	}
 
 	if cacheVersionFileExists {
-		return usererrors.New(errorCacheWrongVersion)
+		return errorcategory.New(errorcategory.ErrCacheInvalid, errorCacheWrongVersion)
+	}
+	return errorcategory.New(errorcategory.ErrCacheInvalid, errorPushNonCache)
+}
+
+// ReadVersion returns the version of the sync tool that created the cache directory, or an empty string if it was not created by the sync tool.
+func (cacheDirectory *CacheDirectory) ReadVersion() (string, error) {
+	cacheVersionBytes, err := ioutil.ReadFile(cacheDirectory.versionFilePath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Could not read version file from cache directory.")
+	}
+	return string(cacheVersionBytes), nil
+}
+
+// LockInfo is recorded in the lock, to say which `pull` command holds it.
+type LockInfo struct {
+	Hostname  string    `json:"hostname,omitempty"`
+	User      string    `json:"user,omitempty"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// InterruptedAt is set if the pull was stopped before it finished.
+	InterruptedAt *time.Time `json:"interrupted_at,omitempty"`
+}
+
+func (cacheDirectory *CacheDirectory) writeLock(lockInfo LockInfo) error {
+	lockJSON, err := json.MarshalIndent(lockInfo, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error converting lock to JSON.")
 	}
-	return usererrors.New(errorPushNonCache)
+	return ioutil.WriteFile(cacheDirectory.lockFilePath(), lockJSON, 0644)
 }
 
 func (cacheDirectory *CacheDirectory) Lock() error {
-	file, err := os.Create(cacheDirectory.lockFilePath())
+	lockInfo := LockInfo{
+		PID:       os.Getpid(),
+		StartedAt: time.Now().UTC(),
+	}
+	lockInfo.Hostname, _ = os.Hostname()
+	if currentUser, err := user.Current(); err == nil {
+		lockInfo.User = currentUser.Username
+	}
+	// If the cache directory is already locked, it's not really a huge issue since the purpose of the lock is mostly to check whether a `pull` operation was interrupted before pushing.
+	err := cacheDirectory.writeLock(lockInfo)
 	if err != nil {
 		return errors.Wrap(err, "Error locking cache directory.")
 	}
-	defer file.Close()
-	// If the cache directory is already locked, it's not really a huge issue since the purpose of the lock is mostly to check whether a `pull` operation was interrupted before pushing.
 	return nil
 }
 
@@ -146,15 +193,46 @@ func (cacheDirectory *CacheDirectory) Unlock() error {
 	return nil
 }
 
+// ReadLock returns nil if the cache directory is not locked. A lock that cannot be parsed is reported as held by an unknown pull.
+func (cacheDirectory *CacheDirectory) ReadLock() (*LockInfo, error) {
+	lockJSON, err := ioutil.ReadFile(cacheDirectory.lockFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error checking if cache directory is locked.")
+	}
+	lockInfo := LockInfo{}
+	if json.Unmarshal(lockJSON, &lockInfo) != nil {
+		return &LockInfo{}, nil
+	}
+	return &lockInfo, nil
+}
+
+// MarkInterrupted records in the lock when the pull holding it was interrupted, so that it can be reported. It does nothing if the cache directory is not locked.
+func (cacheDirectory *CacheDirectory) MarkInterrupted(interruptedAt time.Time) error {
+	lockInfo, err := cacheDirectory.ReadLock()
+	if err != nil || lockInfo == nil {
+		return err
+	}
+	interruptedAt = interruptedAt.UTC()
+	lockInfo.InterruptedAt = &interruptedAt
+	err = cacheDirectory.writeLock(*lockInfo)
+	if err != nil {
+		return errors.Wrap(err, "Error marking cache directory as interrupted.")
+	}
+	return nil
+}
+
 func (cacheDirectory *CacheDirectory) CheckLock() error {
-	_, err := os.Stat(cacheDirectory.lockFilePath())
-	if err == nil {
-		return usererrors.New(errorCacheLocked)
+	lockInfo, err := cacheDirectory.ReadLock()
+	if err != nil || lockInfo == nil {
+		return err
 	}
-	if os.IsNotExist(err) {
-		return nil
+	if lockInfo.InterruptedAt != nil {
+		return errorcategory.Errorf(errorcategory.ErrCacheLocked, errorCacheInterrupted, lockInfo.InterruptedAt.Format(time.RFC3339))
 	}
-	return errors.Wrap(err, "Error checking if cache directory is locked.")
+	return errorcategory.New(errorcategory.ErrCacheLocked, errorCacheLocked)
 }
 
 func (cacheDirectory *CacheDirectory) versionFilePath() string {
@@ -185,6 +263,44 @@ func (cacheDirectory *CacheDirectory) AssetPath(release string, assetName string
 	return path.Join(cacheDirectory.AssetsPath(release), assetName)
 }
 
+// PartialDownloadsPath holds assets that are still being downloaded, so that interrupted downloads can be resumed. It is kept out of the releases directory so that partial assets are never pushed.
+func (cacheDirectory *CacheDirectory) PartialDownloadsPath() string {
+	return path.Join(cacheDirectory.path, "partial-downloads")
+}
+
+// PartialAssetPath includes the ID of the asset, so that a download is never resumed from a different upload of an asset with the same name.
+func (cacheDirectory *CacheDirectory) PartialAssetPath(release string, assetID int64, assetName string) string {
+	return path.Join(cacheDirectory.PartialDownloadsPath(), release, fmt.Sprintf("%d-%s", assetID, assetName))
+}
+
 func (cacheDirectory *CacheDirectory) MetadataPath(release string) string {
 	return path.Join(cacheDirectory.ReleasePath(release), "metadata.json")
 }
+
+func (cacheDirectory *CacheDirectory) ManifestPath() string {
+	return path.Join(cacheDirectory.path, "manifest.json")
+}
+
+func (cacheDirectory *CacheDirectory) ManifestSignaturePath() string {
+	return cacheDirectory.ManifestPath() + ".sig"
+}
+
+func (cacheDirectory *CacheDirectory) PinsPath() string {
+	return path.Join(cacheDirectory.path, "pins.json")
+}
+
+func (cacheDirectory *CacheDirectory) AttestationsPath(release string) string {
+	return path.Join(cacheDirectory.ReleasePath(release), "attestations")
+}
+
+func (cacheDirectory *CacheDirectory) AttestationPath(release string, assetName string) string {
+	return path.Join(cacheDirectory.AttestationsPath(release), assetName+".jsonl")
+}
+
+func (cacheDirectory *CacheDirectory) SBOMPath(release string) string {
+	return path.Join(cacheDirectory.ReleasePath(release), "sbom.cdx.json")
+}
+
+func (cacheDirectory *CacheDirectory) ChangelogPath(extension string) string {
+	return path.Join(cacheDirectory.path, "changelog"+extension)
+}
@@ -1,11 +1,14 @@
 package cachedirectory
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"testing"
+	"time"
 
+	"github.com/github/codeql-action-sync/internal/errorcategory"
 	"github.com/github/codeql-action-sync/test"
 	"github.com/stretchr/testify/require"
 )
@@ -105,9 +108,47 @@ func TestLocking(t *testing.T) {
 	temporaryDirectory := test.CreateTemporaryDirectory(t)
 	cacheDirectory := NewCacheDirectory(path.Join(temporaryDirectory, "cache"))
 	require.NoError(t, cacheDirectory.CheckOrCreateVersionFile(true, aVersion))
+	lockInfo, err := cacheDirectory.ReadLock()
+	require.NoError(t, err)
+	require.Nil(t, lockInfo)
 	require.NoError(t, cacheDirectory.Lock())
 	require.NoError(t, cacheDirectory.Lock())
+	lockInfo, err = cacheDirectory.ReadLock()
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), lockInfo.PID)
+	require.WithinDuration(t, time.Now(), lockInfo.StartedAt, time.Minute)
+	require.Nil(t, lockInfo.InterruptedAt)
 	require.EqualError(t, cacheDirectory.CheckLock(), errorCacheLocked)
+	require.ErrorIs(t, cacheDirectory.CheckLock(), errorcategory.ErrCacheLocked)
 	require.NoError(t, cacheDirectory.Unlock())
 	require.NoError(t, cacheDirectory.CheckLock())
 }
+
+func TestMarkInterrupted(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	cacheDirectory := NewCacheDirectory(path.Join(temporaryDirectory, "cache"))
+	require.NoError(t, cacheDirectory.CheckOrCreateVersionFile(true, aVersion))
+	interruptedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	// Marking an unlocked cache directory does not lock it.
+	require.NoError(t, cacheDirectory.MarkInterrupted(interruptedAt))
+	require.NoError(t, cacheDirectory.CheckLock())
+	require.NoError(t, cacheDirectory.Lock())
+	require.NoError(t, cacheDirectory.MarkInterrupted(interruptedAt))
+	require.EqualError(t, cacheDirectory.CheckLock(), fmt.Sprintf(errorCacheInterrupted, "2026-01-02T03:04:05Z"))
+	require.ErrorIs(t, cacheDirectory.CheckLock(), errorcategory.ErrCacheLocked)
+	// The next pull takes the lock afresh.
+	require.NoError(t, cacheDirectory.Lock())
+	require.EqualError(t, cacheDirectory.CheckLock(), errorCacheLocked)
+}
+
+func TestReadUnparseableLock(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	cacheDirectory := NewCacheDirectory(path.Join(temporaryDirectory, "cache"))
+	require.NoError(t, cacheDirectory.CheckOrCreateVersionFile(true, aVersion))
+	// Earlier versions of the sync tool locked the cache directory with an empty file.
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.lockFilePath(), []byte{}, 0644))
+	lockInfo, err := cacheDirectory.ReadLock()
+	require.NoError(t, err)
+	require.Equal(t, &LockInfo{}, lockInfo)
+	require.EqualError(t, cacheDirectory.CheckLock(), errorCacheLocked)
+}
@@ -0,0 +1,410 @@
+package changelog
+
+import (
+	"bytes"
+	"encoding/json"
+	usererrors "errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/actionconfiguration"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+const FormatMarkdown = "markdown"
+const FormatHTML = "html"
+
+const errorInvalidFormat = "The changelog format must be either `markdown` or `html`."
+
+const packagePath = "package.json"
+const changelogPath = "CHANGELOG.md"
+
+// The maximum number of commits listed for each reference, so that a reference that has moved a long way does not produce an unreadable changelog.
+const maxCommits = 50
+
+const StatusAdded = "added"
+const StatusRemoved = "removed"
+const StatusUpdated = "updated"
+const StatusUnchanged = "unchanged"
+
+func ValidateFormat(format string) error {
+	if format != FormatMarkdown && format != FormatHTML {
+		return usererrors.New(errorInvalidFormat)
+	}
+	return nil
+}
+
+// Extension returns the file extension for a changelog in the given format.
+func Extension(format string) string {
+	if format == FormatHTML {
+		return ".html"
+	}
+	return ".md"
+}
+
+// Snapshot records the commit that each matching branch and tag points to.
+func Snapshot(repository *git.Repository, pattern *regexp.Regexp) (map[string]plumbing.Hash, error) {
+	snapshot := map[string]plumbing.Hash{}
+	references, err := repository.References()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading references from Git repository cache.")
+	}
+	defer references.Close()
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if !pattern.MatchString(reference.Name().String()) {
+			return nil
+		}
+		resolvedReference, err := repository.ResolveRevision(plumbing.Revision(reference.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "Error resolving reference %s.", reference.Name())
+		}
+		snapshot[reference.Name().String()] = *resolvedReference
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+type Commit struct {
+	SHA     string
+	Summary string
+	Author  string
+	Date    string
+}
+
+type ReferenceChange struct {
+	Reference        string
+	Status           string
+	OldSHA           string
+	NewSHA           string
+	OldBundleVersion string
+	NewBundleVersion string
+	// Rewritten is set if the new commit does not descend from the old one, e.g. because the branch was force-pushed.
+	Rewritten bool
+	// OldMissing is set if the old commit is no longer in the cache, so the commits between them cannot be listed.
+	OldMissing     bool
+	Commits        []Commit
+	OmittedCommits int
+	ReleaseNotes   string
+}
+
+type Changelog struct {
+	Source    string
+	Changes   []ReferenceChange
+	Unchanged []string
+	FirstSync bool
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func fileContents(commit *object.Commit, path string) (string, error) {
+	file, err := commit.File(path)
+	if err == object.ErrFileNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Error loading %s from commit %s.", path, commit.Hash)
+	}
+	return file.Contents()
+}
+
+func bundleVersion(commit *object.Commit) (string, error) {
+	content, err := fileContents(commit, actionconfiguration.DefaultConfigurationPath)
+	if err != nil || content == "" {
+		return "", err
+	}
+	configuration, err := actionconfiguration.Parse(content)
+	if err != nil {
+		// An invalid configuration is reported when the bundles are pulled, so the changelog just leaves the version out.
+		return "", nil
+	}
+	return configuration.BundleVersion, nil
+}
+
+func packageVersion(commit *object.Commit) (string, error) {
+	content, err := fileContents(commit, packagePath)
+	if err != nil || content == "" {
+		return "", err
+	}
+	packageJSON := struct {
+		Version string `json:"version"`
+	}{}
+	if json.Unmarshal([]byte(content), &packageJSON) != nil {
+		return "", nil
+	}
+	return packageJSON.Version, nil
+}
+
+func isVersionHeading(line string, version string) bool {
+	return line == "## "+version || strings.HasPrefix(line, "## "+version+" ") || strings.HasPrefix(line, "## ["+version+"]")
+}
+
+// ReleaseNotes extracts the sections of a CHANGELOG.md for the releases after oldVersion up to and including newVersion. The sections are expected to be `##` headings starting with the version, newest first.
+func ReleaseNotes(changelog string, newVersion string, oldVersion string) string {
+	if newVersion == "" || newVersion == oldVersion {
+		return ""
+	}
+	lines := strings.Split(strings.ReplaceAll(changelog, "\r\n", "\n"), "\n")
+	start := -1
+	for index, line := range lines {
+		if isVersionHeading(line, newVersion) {
+			start = index
+			break
+		}
+	}
+	if start == -1 {
+		return ""
+	}
+	end := len(lines)
+	for index := start + 1; index < len(lines); index++ {
+		if strings.HasPrefix(lines[index], "## ") && (oldVersion == "" || isVersionHeading(lines[index], oldVersion)) {
+			end = index
+			break
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+}
+
+func ancestors(commit *object.Commit) (map[plumbing.Hash]bool, error) {
+	seen := map[plumbing.Hash]bool{}
+	err := object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(ancestor *object.Commit) error {
+		seen[ancestor.Hash] = true
+		return nil
+	})
+	return seen, err
+}
+
+func (change *ReferenceChange) listCommits(oldCommit *object.Commit, newCommit *object.Commit) error {
+	oldAncestors, err := ancestors(oldCommit)
+	if err != nil {
+		return errors.Wrapf(err, "Error listing the history of commit %s.", oldCommit.Hash)
+	}
+	change.Commits = []Commit{}
+	err = object.NewCommitPreorderIter(newCommit, oldAncestors, nil).ForEach(func(commit *object.Commit) error {
+		if len(change.Commits) >= maxCommits {
+			change.OmittedCommits++
+			return nil
+		}
+		change.Commits = append(change.Commits, Commit{
+			SHA:     commit.Hash.String(),
+			Summary: strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0],
+			Author:  commit.Author.Name,
+			Date:    commit.Author.When.UTC().Format("2006-01-02"),
+		})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Error listing the commits between %s and %s.", oldCommit.Hash, newCommit.Hash)
+	}
+	descends, err := oldCommit.IsAncestor(newCommit)
+	if err != nil {
+		return errors.Wrapf(err, "Error checking whether %s descends from %s.", newCommit.Hash, oldCommit.Hash)
+	}
+	change.Rewritten = !descends
+	return nil
+}
+
+// Generate describes how the branches and tags of the Action changed between two snapshots of the cache. If previous is nil, this is the first sync.
+func Generate(repository *git.Repository, source string, previous map[string]plumbing.Hash, current map[string]plumbing.Hash) (*Changelog, error) {
+	changelog := Changelog{
+		Source:    source,
+		Changes:   []ReferenceChange{},
+		Unchanged: []string{},
+		FirstSync: previous == nil,
+	}
+	referenceNames := []string{}
+	for referenceName := range current {
+		referenceNames = append(referenceNames, referenceName)
+	}
+	for referenceName := range previous {
+		if _, ok := current[referenceName]; !ok {
+			referenceNames = append(referenceNames, referenceName)
+		}
+	}
+	sort.Strings(referenceNames)
+
+	for _, referenceName := range referenceNames {
+		oldHash, hadOld := previous[referenceName]
+		newHash, hasNew := current[referenceName]
+		if hadOld && hasNew && oldHash == newHash {
+			changelog.Unchanged = append(changelog.Unchanged, referenceName)
+			continue
+		}
+		change := ReferenceChange{Reference: referenceName}
+		var oldCommit, newCommit *object.Commit
+		var oldPackageVersion string
+		if hadOld {
+			change.OldSHA = oldHash.String()
+			commit, err := repository.CommitObject(oldHash)
+			if err == plumbing.ErrObjectNotFound {
+				change.OldMissing = true
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "Error loading commit %s.", oldHash)
+			} else {
+				oldCommit = commit
+				change.OldBundleVersion, err = bundleVersion(oldCommit)
+				if err != nil {
+					return nil, err
+				}
+				oldPackageVersion, err = packageVersion(oldCommit)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if hasNew {
+			change.NewSHA = newHash.String()
+			commit, err := repository.CommitObject(newHash)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error loading commit %s.", newHash)
+			}
+			newCommit = commit
+			change.NewBundleVersion, err = bundleVersion(newCommit)
+			if err != nil {
+				return nil, err
+			}
+			newPackageVersion, err := packageVersion(newCommit)
+			if err != nil {
+				return nil, err
+			}
+			changelogContent, err := fileContents(newCommit, changelogPath)
+			if err != nil {
+				return nil, err
+			}
+			change.ReleaseNotes = ReleaseNotes(changelogContent, newPackageVersion, oldPackageVersion)
+		}
+		switch {
+		case !hadOld:
+			change.Status = StatusAdded
+		case !hasNew:
+			change.Status = StatusRemoved
+		default:
+			change.Status = StatusUpdated
+			if oldCommit != nil {
+				err := change.listCommits(oldCommit, newCommit)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		changelog.Changes = append(changelog.Changes, change)
+	}
+	return &changelog, nil
+}
+
+func (changelog *Changelog) Markdown() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# Changes to the CodeQL Action from %s\n\n", changelog.Source)
+	if changelog.FirstSync {
+		builder.WriteString("This is the first sync to this cache, so every branch and tag is new.\n\n")
+	} else if len(changelog.Changes) == 0 {
+		builder.WriteString("Nothing has changed since the last sync.\n\n")
+	}
+	for _, change := range changelog.Changes {
+		fmt.Fprintf(&builder, "## %s\n\n", change.Reference)
+		switch change.Status {
+		case StatusAdded:
+			fmt.Fprintf(&builder, "Added at `%s`.\n\n", shortSHA(change.NewSHA))
+		case StatusRemoved:
+			fmt.Fprintf(&builder, "Removed (was at `%s`).\n\n", shortSHA(change.OldSHA))
+		default:
+			fmt.Fprintf(&builder, "Updated from `%s` to `%s`.\n\n", shortSHA(change.OldSHA), shortSHA(change.NewSHA))
+		}
+		if change.OldBundleVersion != change.NewBundleVersion && change.OldBundleVersion != "" && change.NewBundleVersion != "" {
+			fmt.Fprintf(&builder, "CodeQL bundle changed from `%s` to `%s`.\n\n", change.OldBundleVersion, change.NewBundleVersion)
+		} else if change.NewBundleVersion != "" {
+			fmt.Fprintf(&builder, "CodeQL bundle: `%s`.\n\n", change.NewBundleVersion)
+		}
+		if change.OldMissing {
+			builder.WriteString("The previous commit is no longer in the cache, so the commits in between cannot be listed.\n\n")
+		}
+		if change.Rewritten {
+			builder.WriteString("The new commit does not descend from the previous one (for example because it was force-pushed), so these are the commits that are only in the new version.\n\n")
+		}
+		if len(change.Commits) != 0 {
+			builder.WriteString("### Commits\n\n")
+			for _, commit := range change.Commits {
+				fmt.Fprintf(&builder, "* `%s` %s (%s, %s)\n", shortSHA(commit.SHA), commit.Summary, commit.Author, commit.Date)
+			}
+			if change.OmittedCommits != 0 {
+				fmt.Fprintf(&builder, "* ... and %d more.\n", change.OmittedCommits)
+			}
+			builder.WriteString("\n")
+		}
+		if change.ReleaseNotes != "" {
+			builder.WriteString("### Release notes\n\n")
+			// The release notes use `##` headings, so demote them to keep them under this reference's heading.
+			for _, line := range strings.Split(change.ReleaseNotes, "\n") {
+				if strings.HasPrefix(line, "#") {
+					line = "##" + line
+				}
+				builder.WriteString(line + "\n")
+			}
+			builder.WriteString("\n")
+		}
+	}
+	if len(changelog.Unchanged) != 0 {
+		fmt.Fprintf(&builder, "Unchanged: %s.\n", strings.Join(changelog.Unchanged, ", "))
+	}
+	return builder.String()
+}
+
+var htmlTemplate = template.Must(template.New("changelog").Funcs(template.FuncMap{"short": shortSHA}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Changes to the CodeQL Action from {{ .Source }}</title>
+</head>
+<body>
+<h1>Changes to the CodeQL Action from {{ .Source }}</h1>
+{{ if .FirstSync }}<p>This is the first sync to this cache, so every branch and tag is new.</p>
+{{ else if not .Changes }}<p>Nothing has changed since the last sync.</p>
+{{ end }}{{ range .Changes }}<h2>{{ .Reference }}</h2>
+{{ if eq .Status "added" }}<p>Added at <code>{{ short .NewSHA }}</code>.</p>
+{{ else if eq .Status "removed" }}<p>Removed (was at <code>{{ short .OldSHA }}</code>).</p>
+{{ else }}<p>Updated from <code>{{ short .OldSHA }}</code> to <code>{{ short .NewSHA }}</code>.</p>
+{{ end }}{{ if and .OldBundleVersion .NewBundleVersion (ne .OldBundleVersion .NewBundleVersion) }}<p>CodeQL bundle changed from <code>{{ .OldBundleVersion }}</code> to <code>{{ .NewBundleVersion }}</code>.</p>
+{{ else if .NewBundleVersion }}<p>CodeQL bundle: <code>{{ .NewBundleVersion }}</code>.</p>
+{{ end }}{{ if .OldMissing }}<p>The previous commit is no longer in the cache, so the commits in between cannot be listed.</p>
+{{ end }}{{ if .Rewritten }}<p>The new commit does not descend from the previous one (for example because it was force-pushed), so these are the commits that are only in the new version.</p>
+{{ end }}{{ if .Commits }}<h3>Commits</h3>
+<ul>
+{{ range .Commits }}<li><code>{{ short .SHA }}</code> {{ .Summary }} ({{ .Author }}, {{ .Date }})</li>
+{{ end }}{{ if .OmittedCommits }}<li>... and {{ .OmittedCommits }} more.</li>
+{{ end }}</ul>
+{{ end }}{{ if .ReleaseNotes }}<h3>Release notes</h3>
+<pre>{{ .ReleaseNotes }}</pre>
+{{ end }}{{ end }}{{ if .Unchanged }}<p>Unchanged: {{ range $index, $reference := .Unchanged }}{{ if $index }}, {{ end }}{{ $reference }}{{ end }}.</p>
+{{ end }}</body>
+</html>
+`))
+
+func (changelog *Changelog) HTML() (string, error) {
+	var buffer bytes.Buffer
+	err := htmlTemplate.Execute(&buffer, changelog)
+	if err != nil {
+		return "", errors.Wrap(err, "Error rendering changelog.")
+	}
+	return buffer.String(), nil
+}
+
+// Render formats the changelog as Markdown or HTML.
+func (changelog *Changelog) Render(format string) (string, error) {
+	if format == FormatHTML {
+		return changelog.HTML()
+	}
+	return changelog.Markdown(), nil
+}
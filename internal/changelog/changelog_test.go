@@ -0,0 +1,60 @@
+package changelog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testChangelog = `# CodeQL Action Changelog
+
+## [UNRELEASED]
+
+No user facing changes.
+
+## 3.26.2 - 15 Aug 2024
+
+- Fix an issue.
+
+## 3.26.1 - 13 Aug 2024
+
+- Update default CodeQL bundle version to 2.18.2.
+
+## 3.26.0 - 06 Aug 2024
+
+- Add a feature.
+`
+
+func TestReleaseNotes(t *testing.T) {
+	require.Equal(t, "## 3.26.2 - 15 Aug 2024\n\n- Fix an issue.\n\n## 3.26.1 - 13 Aug 2024\n\n- Update default CodeQL bundle version to 2.18.2.", ReleaseNotes(testChangelog, "3.26.2", "3.26.0"))
+	require.Equal(t, "## 3.26.1 - 13 Aug 2024\n\n- Update default CodeQL bundle version to 2.18.2.", ReleaseNotes(testChangelog, "3.26.1", ""))
+	require.Equal(t, "## 3.26.0 - 06 Aug 2024\n\n- Add a feature.", ReleaseNotes(testChangelog, "3.26.0", "3.25.0"))
+	require.Equal(t, "", ReleaseNotes(testChangelog, "3.26.1", "3.26.1"))
+	require.Equal(t, "", ReleaseNotes(testChangelog, "3.27.0", "3.26.2"))
+	require.Equal(t, "", ReleaseNotes(testChangelog, "", "3.26.2"))
+}
+
+func TestMarkdownDemotesReleaseNoteHeadings(t *testing.T) {
+	changelog := Changelog{
+		Source: "github/codeql-action",
+		Changes: []ReferenceChange{{
+			Reference:        "refs/heads/v3",
+			Status:           StatusUpdated,
+			OldSHA:           "e529a54fad10a936308b2220e05f7f00757f8e7c",
+			NewSHA:           "33d42021633d74bcd0bf9c95e3d3159131a5faa7",
+			OldBundleVersion: "codeql-bundle-v2.18.1",
+			NewBundleVersion: "codeql-bundle-v2.18.2",
+			ReleaseNotes:     "## 3.26.1 - 13 Aug 2024\n\n- Update default CodeQL bundle version to 2.18.2.",
+		}},
+	}
+	require.Equal(t, "# Changes to the CodeQL Action from github/codeql-action\n\n"+
+		"## refs/heads/v3\n\nUpdated from `e529a54` to `33d4202`.\n\n"+
+		"CodeQL bundle changed from `codeql-bundle-v2.18.1` to `codeql-bundle-v2.18.2`.\n\n"+
+		"### Release notes\n\n#### 3.26.1 - 13 Aug 2024\n\n- Update default CodeQL bundle version to 2.18.2.\n\n", changelog.Markdown())
+}
+
+func TestValidateFormat(t *testing.T) {
+	require.NoError(t, ValidateFormat(FormatMarkdown))
+	require.NoError(t, ValidateFormat(FormatHTML))
+	require.EqualError(t, ValidateFormat("pdf"), errorInvalidFormat)
+}
@@ -0,0 +1,101 @@
+package compatibility
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+const packageJSONPath = "package.json"
+
+var enterpriseVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)`)
+var actionMajorVersionReferencePattern = regexp.MustCompile(`^refs/(heads|tags)/v(\d+)$`)
+
+type EnterpriseVersion struct {
+	Major int
+	Minor int
+}
+
+func (version EnterpriseVersion) String() string {
+	return fmt.Sprintf("%d.%d", version.Major, version.Minor)
+}
+
+func (version EnterpriseVersion) AtLeast(other EnterpriseVersion) bool {
+	if version.Major != other.Major {
+		return version.Major > other.Major
+	}
+	return version.Minor >= other.Minor
+}
+
+// The minimum GitHub Enterprise Server version that has a runner able to run each major version of the CodeQL Action.
+// This needs updating whenever a new major version of the CodeQL Action is released.
+var minimumEnterpriseVersions = map[int]EnterpriseVersion{
+	1: {Major: 3, Minor: 0},
+	2: {Major: 3, Minor: 4},
+	3: {Major: 3, Minor: 11},
+}
+
+// GitHub Enterprise Server versions before this ship a runner image without the tools the CodeQL Action needs to extract `.tar.zst` bundles, so it falls back to `.tar.gz` bundles.
+var minimumZstdBundleEnterpriseVersion = EnterpriseVersion{Major: 3, Minor: 13}
+
+// Repository rulesets (including rulesets for tags) became generally available in this GitHub Enterprise Server version. Older versions only have branch protection rules and tag protection.
+var minimumRulesetsEnterpriseVersion = EnterpriseVersion{Major: 3, Minor: 11}
+
+// ParseEnterpriseVersion parses the value of the `X-GitHub-Enterprise-Version` header. It returns nil if the value does not contain a GitHub Enterprise Server version, as is the case for GitHub AE.
+func ParseEnterpriseVersion(header string) *EnterpriseVersion {
+	match := enterpriseVersionPattern.FindStringSubmatch(strings.TrimSpace(header))
+	if match == nil {
+		return nil
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return &EnterpriseVersion{Major: major, Minor: minor}
+}
+
+func MinimumEnterpriseVersion(actionMajorVersion int) (EnterpriseVersion, bool) {
+	version, known := minimumEnterpriseVersions[actionMajorVersion]
+	return version, known
+}
+
+func SupportsZstdBundles(enterpriseVersion EnterpriseVersion) bool {
+	return enterpriseVersion.AtLeast(minimumZstdBundleEnterpriseVersion)
+}
+
+func SupportsRulesets(enterpriseVersion EnterpriseVersion) bool {
+	return enterpriseVersion.AtLeast(minimumRulesetsEnterpriseVersion)
+}
+
+// ActionMajorVersion works out the major version of the CodeQL Action at a commit, preferring the version in `package.json` and falling back to the name of the reference (e.g. `refs/heads/v2`).
+func ActionMajorVersion(commit *object.Commit, referenceName plumbing.ReferenceName) (int, bool, error) {
+	file, err := commit.File(packageJSONPath)
+	if err != nil && err != object.ErrFileNotFound {
+		return 0, false, errors.Wrapf(err, "Error loading %s from commit %s.", packageJSONPath, commit.Hash.String())
+	}
+	if err == nil {
+		content, err := file.Contents()
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "Error reading %s from commit %s.", packageJSONPath, commit.Hash.String())
+		}
+		var packageJSON struct {
+			Version string
+		}
+		if json.Unmarshal([]byte(content), &packageJSON) == nil {
+			majorVersion, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(packageJSON.Version, "v"), ".", 2)[0])
+			if err == nil {
+				return majorVersion, true, nil
+			}
+		}
+	}
+	match := actionMajorVersionReferencePattern.FindStringSubmatch(referenceName.String())
+	if match == nil {
+		return 0, false, nil
+	}
+	majorVersion, _ := strconv.Atoi(match[2])
+	return majorVersion, true, nil
+}
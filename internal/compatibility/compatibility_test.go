@@ -0,0 +1,61 @@
+package compatibility
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/require"
+)
+
+const actionRepository = "../pull/pull_test/codeql-action-initial.git"
+
+func TestParseEnterpriseVersion(t *testing.T) {
+	require.Equal(t, &EnterpriseVersion{Major: 3, Minor: 4}, ParseEnterpriseVersion("3.4.2"))
+	require.Equal(t, &EnterpriseVersion{Major: 3, Minor: 11}, ParseEnterpriseVersion("3.11.0"))
+	require.Nil(t, ParseEnterpriseVersion("GitHub AE"))
+	require.Nil(t, ParseEnterpriseVersion(""))
+}
+
+func TestAtLeast(t *testing.T) {
+	require.True(t, EnterpriseVersion{Major: 3, Minor: 11}.AtLeast(EnterpriseVersion{Major: 3, Minor: 4}))
+	require.True(t, EnterpriseVersion{Major: 3, Minor: 4}.AtLeast(EnterpriseVersion{Major: 3, Minor: 4}))
+	require.False(t, EnterpriseVersion{Major: 3, Minor: 4}.AtLeast(EnterpriseVersion{Major: 3, Minor: 11}))
+	require.True(t, EnterpriseVersion{Major: 4, Minor: 0}.AtLeast(EnterpriseVersion{Major: 3, Minor: 11}))
+}
+
+func TestMinimumEnterpriseVersion(t *testing.T) {
+	minimumVersion, known := MinimumEnterpriseVersion(3)
+	require.True(t, known)
+	require.Equal(t, EnterpriseVersion{Major: 3, Minor: 11}, minimumVersion)
+	_, known = MinimumEnterpriseVersion(99)
+	require.False(t, known)
+}
+
+func TestActionMajorVersionFromReferenceName(t *testing.T) {
+	repository, err := git.PlainOpen(actionRepository)
+	require.NoError(t, err)
+	for referenceName, expectedMajorVersion := range map[string]int{"refs/heads/v1": 1, "refs/tags/v2": 2, "refs/heads/v3": 3} {
+		hash, err := repository.ResolveRevision(plumbing.Revision(referenceName))
+		require.NoError(t, err)
+		commit, err := repository.CommitObject(*hash)
+		require.NoError(t, err)
+		majorVersion, known, err := ActionMajorVersion(commit, plumbing.ReferenceName(referenceName))
+		require.NoError(t, err)
+		require.True(t, known)
+		require.Equal(t, expectedMajorVersion, majorVersion)
+	}
+
+	hash, err := repository.ResolveRevision(plumbing.Revision("refs/heads/main"))
+	require.NoError(t, err)
+	commit, err := repository.CommitObject(*hash)
+	require.NoError(t, err)
+	_, known, err := ActionMajorVersion(commit, plumbing.ReferenceName("refs/heads/main"))
+	require.NoError(t, err)
+	require.False(t, known)
+}
+
+func TestSupportsRulesets(t *testing.T) {
+	require.True(t, SupportsRulesets(EnterpriseVersion{Major: 3, Minor: 11}))
+	require.False(t, SupportsRulesets(EnterpriseVersion{Major: 3, Minor: 10}))
+}
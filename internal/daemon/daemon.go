@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	usererrors "errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const errorScheduleExhausted = "The schedule has no future runs."
+
+const ResultSuccess = "success"
+const ResultFailure = "failure"
+const ResultSkipped = "skipped"
+
+// Status describes the most recent runs of the daemon, and is served as JSON from the status endpoint.
+type Status struct {
+	Running         bool       `json:"running"`
+	LastRunStarted  *time.Time `json:"last_run_started,omitempty"`
+	LastRunFinished *time.Time `json:"last_run_finished,omitempty"`
+	LastRunResult   string     `json:"last_run_result,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastSuccess     *time.Time `json:"last_success,omitempty"`
+	NextRun         *time.Time `json:"next_run,omitempty"`
+	Fingerprint     string     `json:"fingerprint,omitempty"`
+}
+
+// Daemon runs a sync on a schedule, skipping it when the upstream fingerprint has not changed since the last successful run.
+type Daemon struct {
+	schedule    Schedule
+	sync        func(ctx context.Context) error
+	fingerprint func(ctx context.Context) (string, error)
+	now         func() time.Time
+
+	mutex  sync.Mutex
+	status Status
+}
+
+func New(schedule Schedule, sync func(ctx context.Context) error, fingerprint func(ctx context.Context) (string, error)) *Daemon {
+	return &Daemon{
+		schedule:    schedule,
+		sync:        sync,
+		fingerprint: fingerprint,
+		now:         time.Now,
+	}
+}
+
+func (daemon *Daemon) Status() Status {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	return daemon.status
+}
+
+func (daemon *Daemon) updateStatus(update func(status *Status)) {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	update(&daemon.status)
+}
+
+func (daemon *Daemon) runOnce(ctx context.Context) {
+	started := daemon.now()
+	daemon.updateStatus(func(status *Status) {
+		status.Running = true
+		status.LastRunStarted = &started
+		status.NextRun = nil
+	})
+	result, fingerprint, err := daemon.syncIfChanged(ctx)
+	finished := daemon.now()
+	daemon.updateStatus(func(status *Status) {
+		status.Running = false
+		status.LastRunFinished = &finished
+		status.LastRunResult = result
+		status.LastError = ""
+		switch result {
+		case ResultSuccess:
+			status.LastSuccess = &finished
+			status.Fingerprint = fingerprint
+		case ResultFailure:
+			status.LastError = err.Error()
+		}
+	})
+}
+
+func (daemon *Daemon) syncIfChanged(ctx context.Context) (string, string, error) {
+	previous := daemon.Status()
+	fingerprint, err := daemon.fingerprint(ctx)
+	if err != nil {
+		log.Warnf("Could not check for upstream changes, so syncing anyway: %s", err)
+	} else if previous.LastSuccess != nil && fingerprint == previous.Fingerprint {
+		log.Info("Nothing has changed upstream since the last successful sync, so skipping it.")
+		return ResultSkipped, fingerprint, nil
+	}
+	err = daemon.sync(ctx)
+	if err != nil {
+		log.Errorf("Sync failed: %+v", err)
+		return ResultFailure, "", err
+	}
+	log.Info("Sync finished.")
+	return ResultSuccess, fingerprint, nil
+}
+
+// Run syncs immediately and then on the schedule, until the context is cancelled.
+func (daemon *Daemon) Run(ctx context.Context) error {
+	for {
+		daemon.runOnce(ctx)
+		next, ok := daemon.schedule.Next(daemon.now())
+		if !ok {
+			return usererrors.New(errorScheduleExhausted)
+		}
+		daemon.updateStatus(func(status *Status) {
+			status.NextRun = &next
+		})
+		log.Infof("Next sync at %s.", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// Handler serves `/healthz`, which fails if the last run failed, `/status`, which reports the status as JSON, and `/metrics`, which reports Prometheus metrics.
+func (daemon *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(response http.ResponseWriter, request *http.Request) {
+		if daemon.Status().LastRunResult == ResultFailure {
+			response.WriteHeader(http.StatusServiceUnavailable)
+			response.Write([]byte("last sync failed\n"))
+			return
+		}
+		response.Write([]byte("ok\n"))
+	})
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/status", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(response).Encode(daemon.Status())
+	})
+	return mux
+}
+
+// Serve runs the daemon, serving its status on the given address if it is not empty.
+func (daemon *Daemon) Serve(ctx context.Context, address string) error {
+	if address == "" {
+		return daemon.Run(ctx)
+	}
+	server := &http.Server{Addr: address, Handler: daemon.Handler()}
+	serverErrors := make(chan error, 1)
+	go func() {
+		log.Infof("Serving status on %s.", address)
+		serverErrors <- server.ListenAndServe()
+	}()
+	runErrors := make(chan error, 1)
+	runContext, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		runErrors <- daemon.Run(runContext)
+	}()
+	select {
+	case err := <-serverErrors:
+		cancel()
+		<-runErrors
+		return errors.Wrap(err, "Error serving status.")
+	case err := <-runErrors:
+		shutdownContext, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		server.Shutdown(shutdownContext)
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	usererrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOnceSkipsWhenUnchanged(t *testing.T) {
+	syncs := 0
+	var syncErr error
+	fingerprint := "a"
+	daemon := New(NewIntervalSchedule(time.Hour), func(ctx context.Context) error {
+		syncs++
+		return syncErr
+	}, func(ctx context.Context) (string, error) {
+		return fingerprint, nil
+	})
+
+	daemon.runOnce(context.Background())
+	require.Equal(t, 1, syncs)
+	require.Equal(t, ResultSuccess, daemon.Status().LastRunResult)
+	require.Equal(t, "a", daemon.Status().Fingerprint)
+
+	daemon.runOnce(context.Background())
+	require.Equal(t, 1, syncs)
+	require.Equal(t, ResultSkipped, daemon.Status().LastRunResult)
+
+	fingerprint = "b"
+	syncErr = usererrors.New("the destination is down")
+	daemon.runOnce(context.Background())
+	require.Equal(t, 2, syncs)
+	require.Equal(t, ResultFailure, daemon.Status().LastRunResult)
+	require.Equal(t, "the destination is down", daemon.Status().LastError)
+	require.Equal(t, "a", daemon.Status().Fingerprint)
+
+	// A failed sync is retried even if nothing has changed since.
+	syncErr = nil
+	daemon.runOnce(context.Background())
+	require.Equal(t, 3, syncs)
+	require.Equal(t, ResultSuccess, daemon.Status().LastRunResult)
+	require.Equal(t, "", daemon.Status().LastError)
+}
+
+func TestRunOnceSyncsWhenFingerprintFails(t *testing.T) {
+	syncs := 0
+	daemon := New(NewIntervalSchedule(time.Hour), func(ctx context.Context) error {
+		syncs++
+		return nil
+	}, func(ctx context.Context) (string, error) {
+		return "", usererrors.New("rate limited")
+	})
+	daemon.runOnce(context.Background())
+	daemon.runOnce(context.Background())
+	require.Equal(t, 2, syncs)
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	syncs := 0
+	daemon := New(NewIntervalSchedule(time.Hour), func(ctx context.Context) error {
+		syncs++
+		cancel()
+		return nil
+	}, func(ctx context.Context) (string, error) {
+		return "a", nil
+	})
+	require.NoError(t, daemon.Run(ctx))
+	require.Equal(t, 1, syncs)
+	require.NotNil(t, daemon.Status().NextRun)
+}
+
+func TestHandler(t *testing.T) {
+	daemon := New(NewIntervalSchedule(time.Hour), func(ctx context.Context) error {
+		return usererrors.New("the destination is down")
+	}, func(ctx context.Context) (string, error) {
+		return "a", nil
+	})
+	server := httptest.NewServer(daemon.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	daemon.runOnce(context.Background())
+	response, err = http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	response, err = http.Get(server.URL + "/status")
+	require.NoError(t, err)
+	require.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	response, err = http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Contains(t, response.Header.Get("Content-Type"), "text/plain")
+}
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errorInvalidCronExpression = "The cron expression %q is not valid. It should have five fields: minute, hour, day of month, month and day of week."
+
+// The furthest ahead to look for the next time a cron expression matches, so that expressions which never match (such as `0 0 31 2 *`) don't loop forever.
+const maximumCronSearch = 5 * 366 * 24 * time.Hour
+
+// Schedule decides when the next sync should run.
+type Schedule interface {
+	Next(after time.Time) (time.Time, bool)
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func NewIntervalSchedule(interval time.Duration) Schedule {
+	return intervalSchedule{interval: interval}
+}
+
+func (schedule intervalSchedule) Next(after time.Time) (time.Time, bool) {
+	return after.Add(schedule.interval), true
+}
+
+type cronField map[int]bool
+
+// cronSchedule matches times in the standard five-field cron format, in the local time zone.
+type cronSchedule struct {
+	minutes     cronField
+	hours       cronField
+	daysOfMonth cronField
+	months      cronField
+	daysOfWeek  cronField
+	// As in cron, if both the day of month and day of week are restricted then a day matching either is accepted.
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func parseCronField(field string, minimum int, maximum int) (cronField, error) {
+	values := cronField{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash != -1 {
+			var err error
+			step, err = strconv.Atoi(part[slash+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:slash]
+		}
+		start, end := minimum, maximum
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step != 1 {
+				end = maximum
+			}
+		}
+		if start < minimum || end > maximum || start > end {
+			return nil, fmt.Errorf("%q is out of range", part)
+		}
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func ParseCronSchedule(expression string) (Schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf(errorInvalidCronExpression, expression)
+	}
+	schedule := cronSchedule{
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+	var err error
+	for _, field := range []struct {
+		target   *cronField
+		value    string
+		minimum  int
+		maximum  int
+		describe string
+	}{
+		{&schedule.minutes, fields[0], 0, 59, "minute"},
+		{&schedule.hours, fields[1], 0, 23, "hour"},
+		{&schedule.daysOfMonth, fields[2], 1, 31, "day of month"},
+		{&schedule.months, fields[3], 1, 12, "month"},
+		{&schedule.daysOfWeek, fields[4], 0, 7, "day of week"},
+	} {
+		*field.target, err = parseCronField(field.value, field.minimum, field.maximum)
+		if err != nil {
+			return nil, fmt.Errorf(errorInvalidCronExpression+" The %s field is not valid: %s.", expression, field.describe, err)
+		}
+	}
+	// Both 0 and 7 mean Sunday.
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+	return schedule, nil
+}
+
+func (schedule cronSchedule) matchesDay(instant time.Time) bool {
+	dayOfMonth := schedule.daysOfMonth[instant.Day()]
+	dayOfWeek := schedule.daysOfWeek[int(instant.Weekday())]
+	switch {
+	case schedule.anyDayOfMonth && schedule.anyDayOfWeek:
+		return true
+	case schedule.anyDayOfMonth:
+		return dayOfWeek
+	case schedule.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+func (schedule cronSchedule) Next(after time.Time) (time.Time, bool) {
+	instant := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(maximumCronSearch)
+	for instant.Before(limit) {
+		switch {
+		case !schedule.months[int(instant.Month())]:
+			instant = time.Date(instant.Year(), instant.Month()+1, 1, 0, 0, 0, 0, instant.Location())
+		case !schedule.matchesDay(instant):
+			instant = time.Date(instant.Year(), instant.Month(), instant.Day()+1, 0, 0, 0, 0, instant.Location())
+		case !schedule.hours[instant.Hour()]:
+			instant = time.Date(instant.Year(), instant.Month(), instant.Day(), instant.Hour()+1, 0, 0, 0, instant.Location())
+		case !schedule.minutes[instant.Minute()]:
+			instant = instant.Add(time.Minute)
+		default:
+			return instant, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireNext(t *testing.T, schedule Schedule, after string, expected string) {
+	afterTime, err := time.ParseInLocation("2006-01-02 15:04", after, time.Local)
+	require.NoError(t, err)
+	next, ok := schedule.Next(afterTime)
+	require.True(t, ok)
+	require.Equal(t, expected, next.Format("2006-01-02 15:04 Mon"))
+}
+
+func TestIntervalSchedule(t *testing.T) {
+	requireNext(t, NewIntervalSchedule(90*time.Minute), "2024-03-01 12:00", "2024-03-01 13:30 Fri")
+}
+
+func TestCronSchedule(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 2 * * *")
+	require.NoError(t, err)
+	requireNext(t, schedule, "2024-03-01 01:59", "2024-03-01 02:00 Fri")
+	requireNext(t, schedule, "2024-03-01 02:00", "2024-03-02 02:00 Sat")
+
+	schedule, err = ParseCronSchedule("*/15 9-17 * * 1-5")
+	require.NoError(t, err)
+	requireNext(t, schedule, "2024-03-01 09:07", "2024-03-01 09:15 Fri")
+	requireNext(t, schedule, "2024-03-01 17:45", "2024-03-04 09:00 Mon")
+
+	schedule, err = ParseCronSchedule("30 4 1,15 * 7")
+	require.NoError(t, err)
+	requireNext(t, schedule, "2024-03-01 05:00", "2024-03-03 04:30 Sun")
+	requireNext(t, schedule, "2024-03-10 05:00", "2024-03-15 04:30 Fri")
+
+	schedule, err = ParseCronSchedule("0 0 29 2 *")
+	require.NoError(t, err)
+	requireNext(t, schedule, "2024-03-01 00:00", "2028-02-29 00:00 Tue")
+
+	schedule, err = ParseCronSchedule("0 0 31 2 *")
+	require.NoError(t, err)
+	_, ok := schedule.Next(time.Now())
+	require.False(t, ok)
+}
+
+func TestInvalidCronSchedule(t *testing.T) {
+	_, err := ParseCronSchedule("0 2 * *")
+	require.EqualError(t, err, "The cron expression \"0 2 * *\" is not valid. It should have five fields: minute, hour, day of month, month and day of week.")
+	_, err = ParseCronSchedule("0 24 * * *")
+	require.EqualError(t, err, "The cron expression \"0 24 * * *\" is not valid. It should have five fields: minute, hour, day of month, month and day of week. The hour field is not valid: \"24\" is out of range.")
+	for _, expression := range []string{"x * * * *", "*/0 * * * *", "5-1 * * * *", "* * 0 * *"} {
+		_, err = ParseCronSchedule(expression)
+		require.Error(t, err, expression)
+	}
+}
@@ -0,0 +1,171 @@
+package errorcategory
+
+import (
+	"context"
+	usererrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/github/codeql-action-sync/internal/retry"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/google/go-github/v32/github"
+)
+
+// The categories of failure that a program running the sync may want to handle differently, e.g. by retrying later or asking someone to fix the configuration. An error in a category matches it with `errors.Is`.
+var ErrAuth = usererrors.New("authentication failed")
+var ErrPermission = usererrors.New("permission denied")
+var ErrCacheInvalid = usererrors.New("cache invalid")
+var ErrCacheLocked = usererrors.New("cache locked")
+var ErrNetwork = usererrors.New("network failure")
+var ErrConflict = usererrors.New("conflict")
+var ErrRateLimited = usererrors.New("rate limited")
+
+// The process exit codes for each category. Any other failure exits with ExitCodeFailure.
+const ExitCodeSuccess = 0
+const ExitCodeFailure = 1
+const ExitCodeAuth = 2
+const ExitCodePermission = 3
+const ExitCodeCacheInvalid = 4
+const ExitCodeCacheLocked = 5
+const ExitCodeNetwork = 6
+const ExitCodeConflict = 7
+const ExitCodeRateLimited = 8
+
+type categorizedError struct {
+	category error
+	err      error
+}
+
+func (err *categorizedError) Error() string {
+	return err.err.Error()
+}
+
+func (err *categorizedError) Unwrap() []error {
+	return []error{err.err, err.category}
+}
+
+func (err *categorizedError) Cause() error {
+	return err.err
+}
+
+// Format keeps the stack trace of the underlying error when it is printed with `%+v`.
+func (err *categorizedError) Format(state fmt.State, verb rune) {
+	if formatter, ok := err.err.(fmt.Formatter); ok {
+		formatter.Format(state, verb)
+		return
+	}
+	io.WriteString(state, err.err.Error())
+}
+
+// Wrap puts an error in a category without changing its message.
+func Wrap(category error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+func New(category error, message string) error {
+	return Wrap(category, usererrors.New(message))
+}
+
+func Errorf(category error, format string, args ...interface{}) error {
+	return Wrap(category, fmt.Errorf(format, args...))
+}
+
+var categories = []error{ErrRateLimited, ErrAuth, ErrPermission, ErrCacheLocked, ErrCacheInvalid, ErrConflict, ErrNetwork}
+
+// Of returns the category of an error, or nil if it is not in one. Errors from the GitHub API, Git and the network are categorized by their status code or cause even if they were not put in a category explicitly.
+func Of(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, category := range categories {
+		if usererrors.Is(err, category) {
+			return category
+		}
+	}
+	if usererrors.Is(err, context.Canceled) || usererrors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if rateLimitError := new(github.RateLimitError); usererrors.As(err, &rateLimitError) {
+		return ErrRateLimited
+	}
+	if abuseRateLimitError := new(github.AbuseRateLimitError); usererrors.As(err, &abuseRateLimitError) {
+		return ErrRateLimited
+	}
+	if usererrors.Is(err, transport.ErrAuthenticationRequired) {
+		return ErrAuth
+	}
+	if usererrors.Is(err, transport.ErrAuthorizationFailed) {
+		return ErrPermission
+	}
+	// go-git does not allow unwrapping its unexpected errors, which is where it puts unexpected HTTP status codes.
+	if unexpectedError := new(plumbing.UnexpectedError); usererrors.As(err, &unexpectedError) {
+		err = unexpectedError.Err
+	}
+	if githubErrorResponse := new(github.ErrorResponse); usererrors.As(err, &githubErrorResponse) {
+		if githubErrorResponse.Response != nil {
+			return ofStatusCode(githubErrorResponse.Response.StatusCode)
+		}
+		return nil
+	}
+	if statusError := new(retry.StatusError); usererrors.As(err, &statusError) {
+		return ofStatusCode(statusError.StatusCode)
+	}
+	var statusCodeError interface{ StatusCode() int }
+	if usererrors.As(err, &statusCodeError) {
+		return ofStatusCode(statusCodeError.StatusCode())
+	}
+	var netError net.Error
+	if usererrors.As(err, &netError) {
+		return ErrNetwork
+	}
+	if usererrors.Is(err, io.ErrUnexpectedEOF) || usererrors.Is(err, syscall.ECONNRESET) || usererrors.Is(err, syscall.ECONNREFUSED) {
+		return ErrNetwork
+	}
+	return nil
+}
+
+func ofStatusCode(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return ErrAuth
+	case statusCode == http.StatusForbidden:
+		return ErrPermission
+	case statusCode == http.StatusConflict:
+		return ErrConflict
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return ErrNetwork
+	}
+	return nil
+}
+
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeSuccess
+	}
+	switch Of(err) {
+	case ErrAuth:
+		return ExitCodeAuth
+	case ErrPermission:
+		return ExitCodePermission
+	case ErrCacheInvalid:
+		return ExitCodeCacheInvalid
+	case ErrCacheLocked:
+		return ExitCodeCacheLocked
+	case ErrNetwork:
+		return ExitCodeNetwork
+	case ErrConflict:
+		return ExitCodeConflict
+	case ErrRateLimited:
+		return ExitCodeRateLimited
+	}
+	return ExitCodeFailure
+}
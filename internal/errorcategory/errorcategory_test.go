@@ -0,0 +1,62 @@
+package errorcategory
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/retry"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func githubError(statusCode int) error {
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: statusCode, Request: &http.Request{}}}
+}
+
+func TestWrapKeepsMessageAndStackTrace(t *testing.T) {
+	err := errors.Wrap(New(ErrCacheLocked, "The cache directory is locked."), "Error pushing.")
+	require.EqualError(t, err, "Error pushing.: The cache directory is locked.")
+	require.ErrorIs(t, err, ErrCacheLocked)
+	require.Equal(t, ErrCacheLocked, Of(err))
+	require.Nil(t, Wrap(ErrAuth, nil))
+
+	err = Wrap(ErrConflict, errors.New("Some error."))
+	require.Contains(t, fmt.Sprintf("%+v", err), "TestWrapKeepsMessageAndStackTrace")
+}
+
+func TestOf(t *testing.T) {
+	require.Nil(t, Of(nil))
+	require.Nil(t, Of(errors.New("Some error.")))
+	require.Nil(t, Of(errors.Wrap(context.Canceled, "Error pulling.")))
+	require.Equal(t, ErrAuth, Of(errors.Wrap(githubError(http.StatusUnauthorized), "Error getting current user.")))
+	require.Equal(t, ErrPermission, Of(githubError(http.StatusForbidden)))
+	require.Equal(t, ErrConflict, Of(githubError(http.StatusConflict)))
+	require.Equal(t, ErrRateLimited, Of(githubError(http.StatusTooManyRequests)))
+	require.Equal(t, ErrNetwork, Of(githubError(http.StatusBadGateway)))
+	require.Nil(t, Of(githubError(http.StatusNotFound)))
+	require.Equal(t, ErrRateLimited, Of(&github.RateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden, Request: &http.Request{}}}))
+	require.Equal(t, ErrRateLimited, Of(&github.AbuseRateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden, Request: &http.Request{}}}))
+	require.Equal(t, ErrAuth, Of(fmt.Errorf("%w: bad credentials", transport.ErrAuthenticationRequired)))
+	require.Equal(t, ErrPermission, Of(fmt.Errorf("%w: forbidden", transport.ErrAuthorizationFailed)))
+	require.Equal(t, ErrNetwork, Of(&retry.StatusError{StatusCode: http.StatusServiceUnavailable, Message: "Unexpected response"}))
+	require.Equal(t, ErrNetwork, Of(errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "Error pulling.")))
+	// An explicit category takes precedence over one worked out from the cause.
+	require.Equal(t, ErrAuth, Of(Wrap(ErrAuth, githubError(http.StatusForbidden))))
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, ExitCodeSuccess, ExitCode(nil))
+	require.Equal(t, ExitCodeFailure, ExitCode(errors.New("Some error.")))
+	require.Equal(t, ExitCodeAuth, ExitCode(New(ErrAuth, "The destination token you've provided is not valid.")))
+	require.Equal(t, ExitCodePermission, ExitCode(githubError(http.StatusForbidden)))
+	require.Equal(t, ExitCodeCacheInvalid, ExitCode(New(ErrCacheInvalid, "The cache directory is not valid.")))
+	require.Equal(t, ExitCodeCacheLocked, ExitCode(New(ErrCacheLocked, "The cache directory is locked.")))
+	require.Equal(t, ExitCodeNetwork, ExitCode(githubError(http.StatusGatewayTimeout)))
+	require.Equal(t, ExitCodeConflict, ExitCode(New(ErrConflict, "The destination repository already exists.")))
+	require.Equal(t, ExitCodeRateLimited, ExitCode(githubError(http.StatusTooManyRequests)))
+}
@@ -0,0 +1,61 @@
+package event
+
+const PhaseStarted = "phase_started"
+const PhaseFinished = "phase_finished"
+const AssetStarted = "asset_started"
+const AssetProgress = "asset_progress"
+const AssetFinished = "asset_finished"
+const GitProgress = "git_progress"
+
+// Event is something that happened during a pull or push, so that programs driving them can observe progress.
+type Event struct {
+	Type string `json:"type"`
+	// Phase is set for phase and Git progress events, and is one of `pullGit`, `pullReleases`, `pushGit` or `pushReleases`.
+	Phase   string `json:"phase,omitempty"`
+	Release string `json:"release,omitempty"`
+	Asset   string `json:"asset,omitempty"`
+	// Status is set when an asset is finished, and is one of `downloaded`, `cached`, `uploaded` or `existing`.
+	Status string `json:"status,omitempty"`
+	// Bytes and Total are set for asset events, and are the number of bytes transferred so far and the size of the asset.
+	Bytes int64 `json:"bytes,omitempty"`
+	Total int64 `json:"total,omitempty"`
+	// Message is set for Git progress events, and is a line of progress reported by the Git server, e.g. `Compressing objects: 100% (5/5), done.`.
+	Message string `json:"message,omitempty"`
+}
+
+// Handler is called with each event. It is called synchronously, so it should return quickly.
+type Handler func(Event)
+
+func (handler Handler) Emit(event Event) {
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// Combine returns a handler that calls each of the handlers in turn.
+func Combine(handlers ...Handler) Handler {
+	return func(event Event) {
+		for _, handler := range handlers {
+			handler.Emit(event)
+		}
+	}
+}
+
+// StartPhase emits an event for the start of a phase, and returns a function that emits one for its end.
+func (handler Handler) StartPhase(phase string) func() {
+	handler.Emit(Event{Type: PhaseStarted, Phase: phase})
+	return func() {
+		handler.Emit(Event{Type: PhaseFinished, Phase: phase})
+	}
+}
+
+// WrapDraw wraps a function that draws the progress of an asset transfer so that it also emits progress events.
+func (handler Handler) WrapDraw(release string, asset string, draw func(progress int64, total int64) error) func(int64, int64) error {
+	return func(progress int64, total int64) error {
+		// The transfer being finished is signalled with a progress of -1, which is only meaningful to the draw function.
+		if progress >= 0 {
+			handler.Emit(Event{Type: AssetProgress, Release: release, Asset: asset, Bytes: progress, Total: total})
+		}
+		return draw(progress, total)
+	}
+}
@@ -1,25 +1,42 @@
 package githubapiutil
 
 import (
+	"context"
+	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/google/go-github/v32/github"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 const xOAuthScopesHeader = "X-OAuth-Scopes"
 const xGitHubRequestIDHeader = "X-GitHub-Request-ID"
 
-func HasAnyScope(response *github.Response, scopes ...string) bool {
+const EnterpriseAPIPath = "/api/v3"
+const EnterpriseUploadsPath = "/api/uploads"
+
+// Scopes returns the OAuth scopes of the token used for a request, or nil if the response does not report them (for example because a GitHub App token was used).
+func Scopes(response *github.Response) []string {
 	if response == nil {
-		return false
+		return nil
 	}
 	if len(response.Header.Values(xOAuthScopesHeader)) == 0 {
-		return false
+		return nil
+	}
+	scopes := []string{}
+	for _, scope := range strings.Split(response.Header.Get(xOAuthScopesHeader), ",") {
+		scope = strings.Trim(scope, " ")
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
 	}
-	actualScopes := strings.Split(response.Header.Get(xOAuthScopesHeader), ",")
-	for _, actualScope := range actualScopes {
-		actualScope = strings.Trim(actualScope, " ")
+	return scopes
+}
+
+func HasAnyScope(response *github.Response, scopes ...string) bool {
+	for _, actualScope := range Scopes(response) {
 		for _, requiredScope := range scopes {
 			if actualScope == requiredScope {
 				return true
@@ -29,13 +46,84 @@ func HasAnyScope(response *github.Response, scopes ...string) bool {
 	return false
 }
 
+// RequestError is an error from a GitHub API request, annotated with the request ID that GitHub Support can use to investigate it.
+type RequestError struct {
+	RequestID string
+	err       error
+}
+
+func (err *RequestError) Error() string {
+	return err.err.Error()
+}
+
+func (err *RequestError) Unwrap() error {
+	return err.err
+}
+
+func (err *RequestError) Cause() error {
+	return err.err
+}
+
 func EnrichResponseError(response *github.Response, err error, message string) error {
 	requestID := ""
 	if response != nil {
 		requestID = response.Header.Get(xGitHubRequestIDHeader)
 	}
-	if requestID != "" {
-		message = message + " (" + requestID + ")"
+	if requestID == "" {
+		return errors.Wrap(err, message)
+	}
+	return &RequestError{
+		RequestID: requestID,
+		err:       errors.Wrap(err, message+" ("+requestID+")"),
+	}
+}
+
+// NewEnterpriseClient checks connectivity to a GitHub Enterprise instance, following any redirect of the API root, and returns the root response so its headers can be inspected.
+func NewEnterpriseClient(ctx context.Context, instanceURL string, httpClient *http.Client) (*github.Client, *github.Response, error) {
+	instanceURL = strings.TrimRight(instanceURL, "/")
+	client, err := github.NewEnterpriseClient(instanceURL+EnterpriseAPIPath, instanceURL+EnterpriseUploadsPath, httpClient)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error creating GitHub Enterprise client.")
+	}
+	rootRequest, err := client.NewRequest("GET", EnterpriseAPIPath, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error constructing request for GitHub Enterprise client.")
+	}
+	rootResponse, err := client.Do(ctx, rootRequest, nil)
+	if err != nil {
+		return nil, rootResponse, EnrichResponseError(rootResponse, err, "Error checking connectivity for GitHub Enterprise client.")
+	}
+	if rootRequest.URL.String() != rootResponse.Request.URL.String() {
+		updatedBaseURL, _ := url.Parse(client.BaseURL.String())
+		updatedBaseURL.Scheme = rootResponse.Request.URL.Scheme
+		updatedBaseURL.Host = rootResponse.Request.URL.Host
+		log.Warnf("%s redirected to %s. The URL %s will be used for all API requests.", rootRequest.URL, rootResponse.Request.URL, updatedBaseURL)
+		updatedUploadsURL, _ := url.Parse(client.UploadURL.String())
+		updatedUploadsURL.Scheme = rootResponse.Request.URL.Scheme
+		updatedUploadsURL.Host = rootResponse.Request.URL.Host
+		client, err = github.NewEnterpriseClient(updatedBaseURL.String(), updatedUploadsURL.String(), httpClient)
+		if err != nil {
+			return nil, rootResponse, errors.Wrap(err, "Error creating GitHub Enterprise client.")
+		}
+	}
+	return client, rootResponse, nil
+}
+
+// NewDataResidencyClient creates a client for a GitHub Enterprise Cloud tenant with data residency (e.g. `https://octocorp.ghe.com`), whose API is served from a separate subdomain.
+func NewDataResidencyClient(tenantURL string, httpClient *http.Client) (*github.Client, error) {
+	parsedTenantURL, err := url.Parse(tenantURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing GitHub Enterprise Cloud URL.")
+	}
+	tenantHost := strings.TrimPrefix(strings.ToLower(parsedTenantURL.Host), "api.")
+	client := github.NewClient(httpClient)
+	client.BaseURL, err = url.Parse("https://api." + tenantHost + "/")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error constructing GitHub Enterprise Cloud API URL.")
+	}
+	client.UploadURL, err = url.Parse("https://uploads." + tenantHost + "/")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error constructing GitHub Enterprise Cloud uploads URL.")
 	}
-	return errors.Wrap(err, message)
+	return client, nil
 }
@@ -1,10 +1,12 @@
 package githubapiutil
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"testing"
 
+	"github.com/github/codeql-action-sync/test"
 	"github.com/stretchr/testify/require"
 
 	"github.com/google/go-github/v32/github"
@@ -25,6 +27,19 @@ func TestHasAnyScope(t *testing.T) {
 	require.False(t, HasAnyScope(&response, "public_repo", "repo"))
 }
 
+func TestScopes(t *testing.T) {
+	response := github.Response{
+		Response: &http.Response{Header: http.Header{}},
+	}
+	require.Nil(t, Scopes(&response))
+
+	response.Header.Set(xOAuthScopesHeader, "")
+	require.Equal(t, []string{}, Scopes(&response))
+
+	response.Header.Set(xOAuthScopesHeader, "gist, notifications, admin:org, repo")
+	require.Equal(t, []string{"gist", "notifications", "admin:org", "repo"}, Scopes(&response))
+}
+
 func TestEnrichErrorResponse(t *testing.T) {
 	response := github.Response{
 		Response: &http.Response{Header: http.Header{}},
@@ -36,4 +51,36 @@ func TestEnrichErrorResponse(t *testing.T) {
 
 	response.Header.Set(xGitHubRequestIDHeader, "AAAA:BBBB:CCCCCCC:DDDDDDD:EEEEEEEE")
 	require.Equal(t, "The error message. (AAAA:BBBB:CCCCCCC:DDDDDDD:EEEEEEEE): The underlying error.", EnrichResponseError(&response, errors.New("The underlying error."), "The error message.").Error())
+	var requestError *RequestError
+	require.True(t, errors.As(EnrichResponseError(&response, errors.New("The underlying error."), "The error message."), &requestError))
+	require.Equal(t, "AAAA:BBBB:CCCCCCC:DDDDDDD:EEEEEEEE", requestError.RequestID)
+}
+
+func TestNewEnterpriseClientFollowsRedirect(t *testing.T) {
+	redirectedTestServer, redirectedURL := test.GetTestHTTPServer(t)
+	redirectedTestServer.HandleFunc("/api/v3", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("X-GitHub-Enterprise-Version", "3.0.0")
+		test.ServeHTTPResponseFromString(t, "{}", response)
+	}).Methods("GET")
+	originalTestServer, originalURL := test.GetTestHTTPServer(t)
+	originalTestServer.HandleFunc("/api/v3", func(response http.ResponseWriter, request *http.Request) {
+		http.Redirect(response, request, redirectedURL+"/api/v3", http.StatusMovedPermanently)
+	}).Methods("GET")
+
+	client, rootResponse, err := NewEnterpriseClient(context.Background(), originalURL+"/", &http.Client{})
+	require.NoError(t, err)
+	require.Equal(t, "3.0.0", rootResponse.Header.Get("X-GitHub-Enterprise-Version"))
+	require.Equal(t, redirectedURL+"/api/v3/", client.BaseURL.String())
+	require.Equal(t, redirectedURL+"/api/uploads/", client.UploadURL.String())
+}
+
+func TestNewDataResidencyClient(t *testing.T) {
+	client, err := NewDataResidencyClient("https://OctoCorp.ghe.com/", &http.Client{})
+	require.NoError(t, err)
+	require.Equal(t, "https://api.octocorp.ghe.com/", client.BaseURL.String())
+	require.Equal(t, "https://uploads.octocorp.ghe.com/", client.UploadURL.String())
+
+	client, err = NewDataResidencyClient("https://api.octocorp.ghe.com", &http.Client{})
+	require.NoError(t, err)
+	require.Equal(t, "https://api.octocorp.ghe.com/", client.BaseURL.String())
 }
@@ -0,0 +1,152 @@
+package githubapiutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/github/codeql-action-sync/internal/retry"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const xRateLimitRemainingHeader = "X-RateLimit-Remaining"
+const xRateLimitResetHeader = "X-RateLimit-Reset"
+const retryAfterHeader = "Retry-After"
+
+// GitHub does not always say how long to wait after hitting a secondary rate limit, in which case it recommends waiting at least a minute.
+const defaultSecondaryRateLimitWait = time.Minute
+
+type rateLimitTransport struct {
+	base           http.RoundTripper
+	maxWait        time.Duration
+	mutex          sync.Mutex
+	exhaustedUntil time.Time
+}
+
+// NewHTTPClient returns a client for talking to a GitHub API which authenticates with the given token (if not nil), retries transient failures according to the retry policy, and waits for rate limits to reset, for up to maxRateLimitWait, rather than failing.
+func NewHTTPClient(token *oauth2.Token, maxRateLimitWait time.Duration, retryPolicy retry.Policy) *http.Client {
+	// Leaving the base transport unset means `http.DefaultTransport` is used, so that the `--insecure` flag still applies.
+	var transport http.RoundTripper
+	if token != nil {
+		transport = &oauth2.Transport{Source: oauth2.StaticTokenSource(token)}
+	}
+	transport = retry.NewTransport(transport, retryPolicy)
+	return &http.Client{
+		Transport: NewRateLimitTransport(transport, maxRateLimitWait),
+	}
+}
+
+func NewRateLimitTransport(base http.RoundTripper, maxWait time.Duration) http.RoundTripper {
+	return &rateLimitTransport{
+		base:    base,
+		maxWait: maxWait,
+	}
+}
+
+func (transport *rateLimitTransport) baseTransport() http.RoundTripper {
+	if transport.base == nil {
+		return http.DefaultTransport
+	}
+	return transport.base
+}
+
+func (transport *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	for {
+		err := transport.waitForExhaustedRateLimit(request)
+		if err != nil {
+			return nil, err
+		}
+		response, err := transport.baseTransport().RoundTrip(request)
+		if err != nil {
+			return response, err
+		}
+		wait, limited := transport.checkRateLimit(response)
+		if !limited {
+			return response, nil
+		}
+		if wait > transport.maxWait {
+			log.Warnf("The GitHub API rate limit was reached for %s %s and will not reset for %s, which is longer than the maximum wait of %s.", request.Method, request.URL, wait.Round(time.Second), transport.maxWait)
+			return response, nil
+		}
+		if request.Body != nil && request.GetBody == nil {
+			log.Warnf("The GitHub API rate limit was reached for %s %s, but the request cannot be retried.", request.Method, request.URL)
+			return response, nil
+		}
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		log.Warnf("The GitHub API rate limit was reached for %s %s. Waiting %s before retrying...", request.Method, request.URL, wait.Round(time.Second))
+		metrics.RateLimitWait.Add(wait.Seconds())
+		err = retry.Sleep(request.Context(), wait)
+		if err != nil {
+			return nil, err
+		}
+		request, err = retry.RewindRequest(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (transport *rateLimitTransport) waitForExhaustedRateLimit(request *http.Request) error {
+	transport.mutex.Lock()
+	wait := time.Until(transport.exhaustedUntil)
+	transport.mutex.Unlock()
+	if wait <= 0 || wait > transport.maxWait {
+		// If the wait would be too long we make the request anyway, so that the rate limit error is reported in the normal way.
+		return nil
+	}
+	log.Warnf("The GitHub API rate limit has been exhausted. Waiting %s for it to reset...", wait.Round(time.Second))
+	metrics.RateLimitWait.Add(wait.Seconds())
+	return retry.Sleep(request.Context(), wait)
+}
+
+func (transport *rateLimitTransport) checkRateLimit(response *http.Response) (time.Duration, bool) {
+	var resetWait time.Duration
+	exhausted := response.Header.Get(xRateLimitRemainingHeader) == "0"
+	if exhausted {
+		reset, err := strconv.ParseInt(response.Header.Get(xRateLimitResetHeader), 10, 64)
+		if err == nil {
+			resetAt := time.Unix(reset, 0).Add(time.Second)
+			resetWait = time.Until(resetAt)
+			transport.mutex.Lock()
+			transport.exhaustedUntil = resetAt
+			transport.mutex.Unlock()
+		}
+	}
+
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if retryAfter := response.Header.Get(retryAfterHeader); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return time.Until(date), true
+		}
+	}
+	if exhausted {
+		return resetWait, true
+	}
+	if isSecondaryRateLimit(response) {
+		return defaultSecondaryRateLimitWait, true
+	}
+	return 0, false
+}
+
+func isSecondaryRateLimit(response *http.Response) bool {
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
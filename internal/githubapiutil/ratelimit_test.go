@@ -0,0 +1,87 @@
+package githubapiutil
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/retry"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitTransportHonoursRetryAfter(t *testing.T) {
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	attempts := 0
+	githubTestServer.HandleFunc("/resource", func(response http.ResponseWriter, request *http.Request) {
+		attempts++
+		if attempts == 1 {
+			response.Header().Set(retryAfterHeader, "1")
+			response.WriteHeader(http.StatusForbidden)
+			test.ServeHTTPResponseFromString(t, `{"message": "You have exceeded a secondary rate limit."}`, response)
+			return
+		}
+		test.ServeHTTPResponseFromString(t, "{}", response)
+	}).Methods("GET")
+
+	client := NewHTTPClient(nil, time.Minute, retry.Policy{})
+	response, err := client.Get(githubURL + "/resource")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, 2, attempts)
+}
+
+func TestRateLimitTransportWaitsForReset(t *testing.T) {
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	attempts := 0
+	githubTestServer.HandleFunc("/resource", func(response http.ResponseWriter, request *http.Request) {
+		attempts++
+		if attempts == 1 {
+			response.Header().Set(xRateLimitRemainingHeader, "0")
+			response.Header().Set(xRateLimitResetHeader, strconv.FormatInt(time.Now().Unix(), 10))
+			response.WriteHeader(http.StatusForbidden)
+			return
+		}
+		test.ServeHTTPResponseFromString(t, "{}", response)
+	}).Methods("GET")
+
+	client := NewHTTPClient(nil, time.Minute, retry.Policy{})
+	response, err := client.Get(githubURL + "/resource")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, 2, attempts)
+}
+
+func TestRateLimitTransportGivesUpAfterMaximumWait(t *testing.T) {
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	attempts := 0
+	githubTestServer.HandleFunc("/resource", func(response http.ResponseWriter, request *http.Request) {
+		attempts++
+		response.Header().Set(xRateLimitRemainingHeader, "0")
+		response.Header().Set(xRateLimitResetHeader, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		response.WriteHeader(http.StatusForbidden)
+	}).Methods("GET")
+
+	client := NewHTTPClient(nil, time.Minute, retry.Policy{})
+	response, err := client.Get(githubURL + "/resource")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, response.StatusCode)
+	require.Equal(t, 1, attempts)
+}
+
+func TestRateLimitTransportIgnoresOtherForbiddenResponses(t *testing.T) {
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	attempts := 0
+	githubTestServer.HandleFunc("/resource", func(response http.ResponseWriter, request *http.Request) {
+		attempts++
+		response.WriteHeader(http.StatusForbidden)
+		test.ServeHTTPResponseFromString(t, `{"message": "Must have admin rights to Repository."}`, response)
+	}).Methods("GET")
+
+	client := NewHTTPClient(nil, time.Minute, retry.Policy{})
+	response, err := client.Get(githubURL + "/resource")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, response.StatusCode)
+	require.Equal(t, 1, attempts)
+}
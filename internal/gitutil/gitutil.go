@@ -0,0 +1,23 @@
+package gitutil
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// CommitTime returns the committer time of a commit, or of the commit an annotated tag points at, as seconds since the epoch.
+func CommitTime(repository *git.Repository, hash plumbing.Hash) (float64, error) {
+	if tag, err := repository.TagObject(hash); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return 0, errors.Wrapf(err, "Error loading commit for tag %s.", hash)
+		}
+		return float64(commit.Committer.When.Unix()), nil
+	}
+	commit, err := repository.CommitObject(hash)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error loading commit %s.", hash)
+	}
+	return float64(commit.Committer.When.Unix()), nil
+}
@@ -0,0 +1,32 @@
+package gitutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitTime(t *testing.T) {
+	repository, err := git.PlainInit(filepath.Join(test.CreateTemporaryDirectory(t), "repository"), false)
+	require.NoError(t, err)
+	worktree, err := repository.Worktree()
+	require.NoError(t, err)
+	when := time.Date(2020, 6, 30, 12, 0, 0, 0, time.UTC)
+	signature := &object.Signature{Name: "user", Email: "user@example.com", When: when}
+	commitHash, err := worktree.Commit("Initial commit.", &git.CommitOptions{Author: signature, Committer: signature, AllowEmptyCommits: true})
+	require.NoError(t, err)
+	tag, err := repository.CreateTag("v1", commitHash, &git.CreateTagOptions{Tagger: signature, Message: "v1"})
+	require.NoError(t, err)
+
+	commitTime, err := CommitTime(repository, commitHash)
+	require.NoError(t, err)
+	require.Equal(t, float64(when.Unix()), commitTime)
+	commitTime, err = CommitTime(repository, tag.Hash())
+	require.NoError(t, err)
+	require.Equal(t, float64(when.Unix()), commitTime)
+}
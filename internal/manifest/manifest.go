@@ -0,0 +1,214 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/signature"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const manifestVersion = 1
+
+// The namespace used for SSH signatures on manifests, so that they can't be confused with signatures made for other purposes with the same key.
+const SignatureNamespace = "codeql-action-sync-manifest"
+
+const errorManifestMissing = "The cache directory does not contain a signed manifest. Please re-run the `pull` command with `--manifest-signing-key`."
+const errorManifestSignature = "The signature on the cache manifest could not be verified because %s. The cache may have been tampered with."
+const errorManifestMismatch = "The cache contents do not match its signed manifest, so it may have been tampered with:\n%s"
+
+// The most differences to list when the cache does not match its manifest.
+const maximumReportedDifferences = 20
+
+// Manifest lists the contents of a cache directory, so that they can be checked after it is carried to another machine.
+type Manifest struct {
+	Version    int               `json:"version"`
+	CreatedAt  time.Time         `json:"created_at"`
+	References map[string]string `json:"references"`
+	Files      map[string]string `json:"files"`
+}
+
+func digestFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error opening %s.", path)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error reading %s.", path)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Generate lists the references and file digests of everything in a cache directory that is pushed.
+func Generate(cacheDirectory cachedirectory.CacheDirectory) (*Manifest, error) {
+	manifest := Manifest{
+		Version:    manifestVersion,
+		CreatedAt:  time.Now().UTC(),
+		References: map[string]string{},
+		Files:      map[string]string{},
+	}
+
+	gitRepository, err := git.PlainOpen(cacheDirectory.GitPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening Git repository cache.")
+	}
+	references, err := gitRepository.References()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing references.")
+	}
+	defer references.Close()
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Type() == plumbing.HashReference {
+			manifest.References[reference.Name().String()] = reference.Hash().String()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Dir(cacheDirectory.GitPath())
+	for _, path := range []string{cacheDirectory.GitPath(), cacheDirectory.ReleasesPath(), cacheDirectory.PinsPath()} {
+		err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) && filePath == path {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			relativePath, err := filepath.Rel(root, filePath)
+			if err != nil {
+				return err
+			}
+			digest, err := digestFile(filePath)
+			if err != nil {
+				return err
+			}
+			manifest.Files[filepath.ToSlash(relativePath)] = digest
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error listing cache contents.")
+		}
+	}
+	return &manifest, nil
+}
+
+// Write generates a manifest for a cache directory and signs it. If no signer is given, any existing manifest is removed instead, as it would no longer match.
+func Write(cacheDirectory cachedirectory.CacheDirectory, signer *signature.Signer) error {
+	if signer == nil {
+		for _, path := range []string{cacheDirectory.ManifestPath(), cacheDirectory.ManifestSignaturePath()} {
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "Error removing outdated manifest.")
+			}
+		}
+		return nil
+	}
+	log.Debug("Writing signed cache manifest...")
+	manifest, err := Generate(cacheDirectory)
+	if err != nil {
+		return err
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error converting manifest to JSON.")
+	}
+	manifestSignature, err := signer.Sign(manifestJSON, SignatureNamespace)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(cacheDirectory.ManifestPath(), manifestJSON, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing manifest.")
+	}
+	err = ioutil.WriteFile(cacheDirectory.ManifestSignaturePath(), []byte(manifestSignature), 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing manifest signature.")
+	}
+	return nil
+}
+
+func differences(kind string, expected map[string]string, actual map[string]string) []string {
+	result := []string{}
+	for name, expectedValue := range expected {
+		actualValue, exists := actual[name]
+		if !exists {
+			result = append(result, fmt.Sprintf("%s %s is missing", kind, name))
+		} else if actualValue != expectedValue {
+			result = append(result, fmt.Sprintf("%s %s is %s, but should be %s", kind, name, actualValue, expectedValue))
+		}
+	}
+	for name := range actual {
+		if _, exists := expected[name]; !exists {
+			result = append(result, fmt.Sprintf("%s %s is not in the manifest", kind, name))
+		}
+	}
+	return result
+}
+
+// Verify checks that a cache directory has a manifest signed by a trusted key, and that its contents match it.
+func Verify(cacheDirectory cachedirectory.CacheDirectory, keyring *signature.Keyring) error {
+	log.Debug("Verifying signed cache manifest...")
+	manifestJSON, err := ioutil.ReadFile(cacheDirectory.ManifestPath())
+	if os.IsNotExist(err) {
+		return errorcategory.New(errorcategory.ErrCacheInvalid, errorManifestMissing)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error reading manifest.")
+	}
+	manifestSignature, err := ioutil.ReadFile(cacheDirectory.ManifestSignaturePath())
+	if os.IsNotExist(err) {
+		return errorcategory.New(errorcategory.ErrCacheInvalid, errorManifestMissing)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Error reading manifest signature.")
+	}
+	signer, err := keyring.Verify(manifestJSON, string(manifestSignature), SignatureNamespace)
+	if err != nil {
+		return errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorManifestSignature, err)
+	}
+	expected := Manifest{}
+	err = json.Unmarshal(manifestJSON, &expected)
+	if err != nil {
+		return errors.Wrap(err, "Error parsing manifest.")
+	}
+	if expected.Version != manifestVersion {
+		return fmt.Errorf("The cache manifest has version %d, but this version of the sync tool only supports version %d.", expected.Version, manifestVersion)
+	}
+
+	actual, err := Generate(cacheDirectory)
+	if err != nil {
+		return err
+	}
+	problems := append(differences("Reference", expected.References, actual.References), differences("File", expected.Files, actual.Files)...)
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		if len(problems) > maximumReportedDifferences {
+			problems = append(problems[:maximumReportedDifferences], fmt.Sprintf("...and %d more differences", len(problems)-maximumReportedDifferences))
+		}
+		return errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorManifestMismatch, "* "+strings.Join(problems, "\n* "))
+	}
+	log.Infof("The cache matches its manifest, which was signed by %s at %s.", signer, expected.CreatedAt.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/signature"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func getTestKeys(t *testing.T, directory string) (*signature.Signer, *signature.Keyring) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateKeyBlock, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	privateKeyPath := path.Join(directory, "id_ed25519")
+	require.NoError(t, ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(privateKeyBlock), 0600))
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	publicKeyPath := path.Join(directory, "id_ed25519.pub")
+	require.NoError(t, ioutil.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(sshPublicKey), 0644))
+	signer, err := signature.LoadSigner(privateKeyPath)
+	require.NoError(t, err)
+	keyring, err := signature.LoadKeyring([]string{publicKeyPath})
+	require.NoError(t, err)
+	return signer, keyring
+}
+
+func getTestCacheDirectory(t *testing.T, directory string) cachedirectory.CacheDirectory {
+	cacheDirectory := cachedirectory.NewCacheDirectory(path.Join(directory, "cache"))
+	_, err := git.PlainInit(cacheDirectory.GitPath(), true)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(cacheDirectory.AssetsPath("codeql-bundle-20200101"), 0755))
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.MetadataPath("codeql-bundle-20200101"), []byte("{}"), 0644))
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.AssetPath("codeql-bundle-20200101", "codeql-bundle.tar.gz"), []byte("Not really a bundle."), 0644))
+	return cacheDirectory
+}
+
+func TestWriteAndVerify(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	signer, keyring := getTestKeys(t, temporaryDirectory)
+	cacheDirectory := getTestCacheDirectory(t, temporaryDirectory)
+
+	err := Write(cacheDirectory, signer)
+	require.NoError(t, err)
+	manifest, err := Generate(cacheDirectory)
+	require.NoError(t, err)
+	require.Equal(t, "sha256:71bb9432204c321b631b7f3694fe4b53fecf48a2e5ce6139c524056d70d4ad6d", manifest.Files["releases/codeql-bundle-20200101/assets/codeql-bundle.tar.gz"])
+	require.Contains(t, manifest.Files, "git/HEAD")
+	err = Verify(cacheDirectory, keyring)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.AssetPath("codeql-bundle-20200101", "codeql-bundle.tar.gz"), []byte("Something malicious."), 0644))
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.AssetPath("codeql-bundle-20200101", "extra.tar.gz"), []byte("Something else."), 0644))
+	err = Verify(cacheDirectory, keyring)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "* File releases/codeql-bundle-20200101/assets/codeql-bundle.tar.gz is sha256:")
+	require.Contains(t, err.Error(), "* File releases/codeql-bundle-20200101/assets/extra.tar.gz is not in the manifest")
+}
+
+func TestVerifyTamperedManifest(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	signer, keyring := getTestKeys(t, temporaryDirectory)
+	cacheDirectory := getTestCacheDirectory(t, temporaryDirectory)
+	err := Write(cacheDirectory, signer)
+	require.NoError(t, err)
+
+	manifestJSON, err := ioutil.ReadFile(cacheDirectory.ManifestPath())
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.ManifestPath(), append(manifestJSON, ' '), 0644))
+	err = Verify(cacheDirectory, keyring)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The signature on the cache manifest could not be verified")
+
+	_, otherKeyring := getTestKeys(t, temporaryDirectory)
+	require.NoError(t, Write(cacheDirectory, signer))
+	err = Verify(cacheDirectory, otherKeyring)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "untrusted key")
+}
+
+func TestWriteWithoutSignerRemovesManifest(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	signer, keyring := getTestKeys(t, temporaryDirectory)
+	cacheDirectory := getTestCacheDirectory(t, temporaryDirectory)
+	require.NoError(t, Write(cacheDirectory, signer))
+	require.NoError(t, Write(cacheDirectory, nil))
+	require.NoFileExists(t, cacheDirectory.ManifestPath())
+	require.NoFileExists(t, cacheDirectory.ManifestSignaturePath())
+	require.EqualError(t, Verify(cacheDirectory, keyring), errorManifestMissing)
+}
@@ -0,0 +1,30 @@
+package metrics
+
+const OperationPull = "pull"
+const OperationPush = "push"
+
+const PhasePullGit = "pullGit"
+const PhasePullReleases = "pullReleases"
+const PhasePushGit = "pushGit"
+const PhasePushReleases = "pushReleases"
+
+const AssetDownloaded = "downloaded"
+const AssetCached = "cached"
+const AssetUploaded = "uploaded"
+const AssetExisting = "existing"
+
+var (
+	LastSuccess             = defaultRegistry.NewGauge("codeql_action_sync_last_success_timestamp_seconds", "When each operation last succeeded, as a Unix timestamp.", "operation")
+	LastFailure             = defaultRegistry.NewGauge("codeql_action_sync_last_failure_timestamp_seconds", "When each operation last failed, as a Unix timestamp.", "operation")
+	PhaseDuration           = defaultRegistry.NewGauge("codeql_action_sync_phase_duration_seconds", "How long the last run of each phase took.", "phase")
+	DownloadedBytes         = defaultRegistry.NewCounter("codeql_action_sync_downloaded_bytes_total", "The number of bytes of release assets downloaded.")
+	UploadedBytes           = defaultRegistry.NewCounter("codeql_action_sync_uploaded_bytes_total", "The number of bytes of release assets uploaded.")
+	Assets                  = defaultRegistry.NewCounter("codeql_action_sync_assets_total", "The number of release assets handled, by operation and status.", "operation", "status")
+	Retries                 = defaultRegistry.NewCounter("codeql_action_sync_retries_total", "The number of network operations that were retried.")
+	RateLimitWait           = defaultRegistry.NewCounter("codeql_action_sync_rate_limit_wait_seconds_total", "The time spent waiting for GitHub API rate limits to reset.")
+	UpstreamReference       = defaultRegistry.NewGauge("codeql_action_sync_upstream_reference_info", "The commit of each synced branch and tag upstream, as of the last pull or push.", "ref", "sha")
+	DestinationReference    = defaultRegistry.NewGauge("codeql_action_sync_destination_reference_info", "The commit of each synced branch and tag that was last pushed to the destination.", "ref", "sha")
+	UpstreamCommitTime      = defaultRegistry.NewGauge("codeql_action_sync_upstream_commit_timestamp_seconds", "When the upstream commit of each synced branch and tag was committed, as a Unix timestamp, as of the last pull or push.", "ref")
+	DestinationCommitTime   = defaultRegistry.NewGauge("codeql_action_sync_destination_commit_timestamp_seconds", "When the commit of each synced branch and tag that was last pushed to the destination was committed, as a Unix timestamp.", "ref")
+	ReferenceBehindUpstream = defaultRegistry.NewGauge("codeql_action_sync_reference_behind_upstream", "Whether each synced branch and tag on the destination is at a different commit from upstream (because it is pinned or was skipped), as of the last push.", "ref")
+)
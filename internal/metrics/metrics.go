@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const counterType = "counter"
+const gaugeType = "gauge"
+
+// The content type of the Prometheus text exposition format (see https://prometheus.io/docs/instrumenting/exposition_formats/).
+const textContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// Metric is a counter or gauge with a fixed set of label names.
+type Metric struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+
+	mutex   sync.Mutex
+	samples map[string]*sample
+}
+
+// Registry holds metrics so that they can be written out together.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []*Metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (registry *Registry) register(name string, help string, metricType string, labelNames []string) *Metric {
+	metric := &Metric{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		samples:    map[string]*sample{},
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.metrics = append(registry.metrics, metric)
+	return metric
+}
+
+func (registry *Registry) NewCounter(name string, help string, labelNames ...string) *Metric {
+	return registry.register(name, help, counterType, labelNames)
+}
+
+func (registry *Registry) NewGauge(name string, help string, labelNames ...string) *Metric {
+	return registry.register(name, help, gaugeType, labelNames)
+}
+
+func (metric *Metric) sample(labelValues []string) *sample {
+	if len(labelValues) != len(metric.labelNames) {
+		panic(fmt.Sprintf("metric %s has %d labels, but %d values were given", metric.name, len(metric.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	existing, ok := metric.samples[key]
+	if !ok {
+		existing = &sample{labelValues: labelValues}
+		metric.samples[key] = existing
+	}
+	return existing
+}
+
+func (metric *Metric) Add(value float64, labelValues ...string) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+	metric.sample(labelValues).value += value
+}
+
+func (metric *Metric) Set(value float64, labelValues ...string) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+	metric.sample(labelValues).value = value
+}
+
+// Reset removes every sample, for gauges whose set of labels changes over time.
+func (metric *Metric) Reset() {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+	metric.samples = map[string]*sample{}
+}
+
+func (metric *Metric) Value(labelValues ...string) float64 {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+	if existing, ok := metric.samples[strings.Join(labelValues, "\xff")]; ok {
+		return existing.value
+	}
+	return 0
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func (metric *Metric) write(writer io.Writer) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+	fmt.Fprintf(writer, "# HELP %s %s\n", metric.name, metric.help)
+	fmt.Fprintf(writer, "# TYPE %s %s\n", metric.name, metric.metricType)
+	lines := []string{}
+	for _, sample := range metric.samples {
+		labels := []string{}
+		for index, labelName := range metric.labelNames {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, labelName, labelValueEscaper.Replace(sample.labelValues[index])))
+		}
+		line := metric.name
+		if len(labels) != 0 {
+			line += "{" + strings.Join(labels, ",") + "}"
+		}
+		lines = append(lines, line+" "+formatValue(sample.value))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(writer, line)
+	}
+}
+
+// WriteText writes every metric in the Prometheus text exposition format.
+func (registry *Registry) WriteText(writer io.Writer) {
+	registry.mutex.Lock()
+	metrics := append([]*Metric{}, registry.metrics...)
+	registry.mutex.Unlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+	for _, metric := range metrics {
+		metric.write(writer)
+	}
+}
+
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("Content-Type", textContentType)
+		registry.WriteText(response)
+	})
+}
+
+// Push sends every metric to a Prometheus Pushgateway, replacing any previously pushed for the job with the same grouping labels. Runs that report different metrics, such as a `pull` and a `push`, should use different grouping labels so that they do not replace each other's metrics.
+func (registry *Registry) Push(ctx context.Context, gatewayURL string, job string, grouping map[string]string) error {
+	var body bytes.Buffer
+	registry.WriteText(&body)
+	groupingPath := "/metrics/job/" + url.PathEscape(job)
+	labelNames := []string{}
+	for labelName := range grouping {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	for _, labelName := range labelNames {
+		groupingPath += "/" + url.PathEscape(labelName) + "/" + url.PathEscape(grouping[labelName])
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimRight(gatewayURL, "/")+groupingPath, &body)
+	if err != nil {
+		return errors.Wrap(err, "Error constructing Pushgateway request.")
+	}
+	request.Header.Set("Content-Type", textContentType)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "Error pushing metrics.")
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("Error pushing metrics: the Pushgateway responded with status code %d.", response.StatusCode)
+	}
+	return nil
+}
+
+var defaultRegistry = NewRegistry()
+
+func Handler() http.Handler {
+	return defaultRegistry.Handler()
+}
+
+func Push(ctx context.Context, gatewayURL string, job string, grouping map[string]string) error {
+	return defaultRegistry.Push(ctx, gatewayURL, job, grouping)
+}
+
+// TimePhase records how long a phase takes. It is intended to be deferred, e.g. `defer metrics.TimePhase(metrics.PhasePullGit)()`.
+func TimePhase(phase string) func() {
+	started := time.Now()
+	return func() {
+		PhaseDuration.Set(time.Since(started).Seconds(), phase)
+	}
+}
+
+// RecordOutcome records when an operation such as `pull` or `push` last succeeded or failed.
+func RecordOutcome(operation string, err error) {
+	now := float64(time.Now().Unix())
+	if err == nil {
+		LastSuccess.Set(now, operation)
+	} else {
+		LastFailure.Set(now, operation)
+	}
+}
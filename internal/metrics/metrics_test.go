@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	usererrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteText(t *testing.T) {
+	registry := NewRegistry()
+	assets := registry.NewCounter("test_assets_total", "The number of assets.", "operation", "status")
+	lastSuccess := registry.NewGauge("test_last_success_timestamp_seconds", "When it last succeeded.", "operation")
+	registry.NewCounter("test_unused_total", "Never incremented.")
+	assets.Add(1, "pull", "downloaded")
+	assets.Add(2, "pull", "downloaded")
+	assets.Add(1, "pull", "cached")
+	lastSuccess.Set(1600000000, `a "quoted" operation`)
+	require.Equal(t, float64(3), assets.Value("pull", "downloaded"))
+
+	var text bytes.Buffer
+	registry.WriteText(&text)
+	require.Equal(t, `# HELP test_assets_total The number of assets.
+# TYPE test_assets_total counter
+test_assets_total{operation="pull",status="cached"} 1
+test_assets_total{operation="pull",status="downloaded"} 3
+# HELP test_last_success_timestamp_seconds When it last succeeded.
+# TYPE test_last_success_timestamp_seconds gauge
+test_last_success_timestamp_seconds{operation="a \"quoted\" operation"} 1.6e+09
+# HELP test_unused_total Never incremented.
+# TYPE test_unused_total counter
+`, text.String())
+
+	assets.Reset()
+	require.Equal(t, float64(0), assets.Value("pull", "downloaded"))
+	require.Panics(t, func() {
+		assets.Add(1, "pull")
+	})
+}
+
+func TestPush(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGauge("test_gauge", "A gauge.").Set(42)
+	var requestPath, requestMethod, requestBody string
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requestMethod = request.Method
+		requestPath = request.URL.Path
+		body, _ := ioutil.ReadAll(request.Body)
+		requestBody = string(body)
+	}))
+	defer server.Close()
+
+	err := registry.Push(context.Background(), server.URL+"/", "codeql-action-sync", map[string]string{"command": "push", "instance": "ghes"})
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPut, requestMethod)
+	require.Equal(t, "/metrics/job/codeql-action-sync/command/push/instance/ghes", requestPath)
+	require.Contains(t, requestBody, "test_gauge 42\n")
+
+	server.Config.Handler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusBadRequest)
+	})
+	err = registry.Push(context.Background(), server.URL, "codeql-action-sync", nil)
+	require.EqualError(t, err, "Error pushing metrics: the Pushgateway responded with status code 400.")
+}
+
+func TestRecordOutcome(t *testing.T) {
+	before := float64(time.Now().Unix())
+	RecordOutcome(OperationPull, nil)
+	RecordOutcome(OperationPush, usererrors.New("it failed"))
+	require.GreaterOrEqual(t, LastSuccess.Value(OperationPull), before)
+	require.Equal(t, float64(0), LastSuccess.Value(OperationPush))
+	require.GreaterOrEqual(t, LastFailure.Value(OperationPush), before)
+}
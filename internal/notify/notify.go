@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	usererrors "errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/github/codeql-action-sync/internal/push"
+	"github.com/pkg/errors"
+)
+
+const StatusSuccess = "success"
+const StatusFailure = "failure"
+
+const OnAlways = "always"
+const OnFailure = "failure"
+const OnChange = "change"
+
+const TemplateRaw = "raw"
+const TemplateSlack = "slack"
+const TemplateTeams = "teams"
+
+const errorInvalidOn = "The webhook condition must be one of `always`, `failure` or `change`."
+
+const sendTimeout = 30 * time.Second
+
+var builtInTemplates = map[string]string{
+	TemplateRaw:   `{{ json . }}`,
+	TemplateSlack: `{"text": {{ json (join .SummaryLines "\n") }}}`,
+	TemplateTeams: `{
+  "@type": "MessageCard",
+  "@context": "https://schema.org/extensions",
+  "summary": {{ json .Title }},
+  "themeColor": {{ if eq .Status "success" }}"2EB886"{{ else }}"D00000"{{ end }},
+  "title": {{ json .Title }},
+  "text": {{ json (join .SummaryLines "\n\n") }}
+}`,
+}
+
+// Outcome describes the result of a sync, and is the data that webhook templates are rendered with.
+type Outcome struct {
+	Status            string                `json:"status"`
+	Source            string                `json:"source"`
+	Destination       string                `json:"destination"`
+	StartedAt         time.Time             `json:"started_at"`
+	FinishedAt        time.Time             `json:"finished_at"`
+	BundleVersions    []string              `json:"bundle_versions"`
+	NewBundleVersions []string              `json:"new_bundle_versions"`
+	MovedReferences   []push.MovedReference `json:"moved_references"`
+	Error             string                `json:"error,omitempty"`
+	ErrorChain        []string              `json:"error_chain,omitempty"`
+	RequestIDs        []string              `json:"request_ids,omitempty"`
+}
+
+func NewOutcome(source string, destination string, startedAt time.Time, result *push.Result, err error) Outcome {
+	outcome := Outcome{
+		Status:            StatusSuccess,
+		Source:            source,
+		Destination:       destination,
+		StartedAt:         startedAt.UTC(),
+		FinishedAt:        time.Now().UTC(),
+		BundleVersions:    []string{},
+		NewBundleVersions: []string{},
+		MovedReferences:   []push.MovedReference{},
+	}
+	if result != nil {
+		outcome.BundleVersions = result.BundleVersions
+		outcome.NewBundleVersions = result.NewBundleVersions
+		outcome.MovedReferences = result.MovedReferences
+	}
+	if err != nil {
+		outcome.Status = StatusFailure
+		outcome.Error = err.Error()
+		outcome.ErrorChain, outcome.RequestIDs = unwrapError(err)
+	}
+	return outcome
+}
+
+// unwrapError lists the message added by each layer of wrapping, from the outermost to the root cause, and the IDs of any failed GitHub API requests.
+func unwrapError(err error) ([]string, []string) {
+	chain := []string{}
+	requestIDs := []string{}
+	for err != nil {
+		if requestError, ok := err.(*githubapiutil.RequestError); ok {
+			requestIDs = append(requestIDs, requestError.RequestID)
+		}
+		message := err.Error()
+		next := usererrors.Unwrap(err)
+		if next != nil {
+			if message == next.Error() {
+				// This layer only adds a stack trace or other metadata.
+				err = next
+				continue
+			}
+			message = strings.TrimSuffix(message, ": "+next.Error())
+		}
+		chain = append(chain, message)
+		err = next
+	}
+	return chain, requestIDs
+}
+
+// Changed reports whether the sync failed or changed anything on the destination.
+func (outcome Outcome) Changed() bool {
+	return outcome.Status != StatusSuccess || len(outcome.NewBundleVersions) != 0 || len(outcome.MovedReferences) != 0
+}
+
+func (outcome Outcome) Title() string {
+	if outcome.Status == StatusSuccess {
+		return fmt.Sprintf("CodeQL Action sync to %s succeeded", outcome.Destination)
+	}
+	return fmt.Sprintf("CodeQL Action sync to %s failed", outcome.Destination)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// SummaryLines describes the outcome in human-readable lines, for use in chat messages.
+func (outcome Outcome) SummaryLines() []string {
+	lines := []string{outcome.Title() + "."}
+	if len(outcome.NewBundleVersions) != 0 {
+		lines = append(lines, "New CodeQL bundles: "+strings.Join(outcome.NewBundleVersions, ", "))
+	}
+	for _, movedReference := range outcome.MovedReferences {
+		if movedReference.From == "" {
+			lines = append(lines, fmt.Sprintf("Created %s at %s", movedReference.Reference, shortSHA(movedReference.To)))
+		} else {
+			lines = append(lines, fmt.Sprintf("Moved %s from %s to %s", movedReference.Reference, shortSHA(movedReference.From), shortSHA(movedReference.To)))
+		}
+	}
+	if outcome.Status == StatusSuccess && len(outcome.NewBundleVersions) == 0 && len(outcome.MovedReferences) == 0 {
+		lines = append(lines, "The destination was already up to date.")
+	}
+	if outcome.Error != "" {
+		lines = append(lines, "Error: "+outcome.Error)
+	}
+	if len(outcome.RequestIDs) != 0 {
+		lines = append(lines, "GitHub request IDs: "+strings.Join(outcome.RequestIDs, ", "))
+	}
+	return lines
+}
+
+func ValidateOn(on string) error {
+	if on != OnAlways && on != OnFailure && on != OnChange {
+		return usererrors.New(errorInvalidOn)
+	}
+	return nil
+}
+
+// ShouldSend reports whether the outcome matches the condition for sending a notification.
+func (outcome Outcome) ShouldSend(on string) bool {
+	switch on {
+	case OnFailure:
+		return outcome.Status != StatusSuccess
+	case OnChange:
+		return outcome.Changed()
+	default:
+		return true
+	}
+}
+
+// LoadTemplate returns one of the built-in templates by name, or otherwise reads a Go template from a file.
+func LoadTemplate(nameOrPath string) (*template.Template, error) {
+	text, ok := builtInTemplates[nameOrPath]
+	if !ok {
+		content, err := ioutil.ReadFile(nameOrPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error reading webhook template %s.", nameOrPath)
+		}
+		text = string(content)
+	}
+	parsed, err := template.New(nameOrPath).Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing webhook template %s.", nameOrPath)
+	}
+	return parsed, nil
+}
+
+func Render(payloadTemplate *template.Template, outcome Outcome) ([]byte, error) {
+	var payload bytes.Buffer
+	err := payloadTemplate.Execute(&payload, outcome)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error rendering webhook template.")
+	}
+	if !json.Valid(payload.Bytes()) {
+		return nil, usererrors.New("The webhook template did not produce valid JSON.")
+	}
+	return payload.Bytes(), nil
+}
+
+// Send renders the outcome with the template and posts it to the webhook URL.
+func Send(ctx context.Context, webhookURL string, payloadTemplate *template.Template, outcome Outcome) error {
+	payload, err := Render(payloadTemplate, outcome)
+	if err != nil {
+		return err
+	}
+	// The sync's context may already have been cancelled, but the notification is still worth sending.
+	sendContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(sendContext, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "Error constructing webhook request.")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "Error sending webhook notification.")
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("Error sending webhook notification: the webhook responded with status code %d.", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	usererrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/github/codeql-action-sync/internal/push"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var testResult = &push.Result{
+	BundleVersions:    []string{"codeql-bundle-20200101", "codeql-bundle-20200630"},
+	NewBundleVersions: []string{"codeql-bundle-20200630"},
+	MovedReferences: []push.MovedReference{
+		{Reference: "refs/heads/v1", From: "bd82b85707bc13904e3526517677039d4da4a9bb", To: "26936381e619a01122ea33993e3cebc474496805"},
+		{Reference: "refs/heads/v3", To: "e529a54fad10a936308b2220e05f7f00757f8e7c"},
+	},
+}
+
+func getTestError() error {
+	response := &github.Response{Response: &http.Response{Header: http.Header{}}}
+	response.Header.Set("X-GitHub-Request-ID", "AAAA:BBBB")
+	err := githubapiutil.EnrichResponseError(response, usererrors.New("502 Bad Gateway"), "Error uploading release asset.")
+	return errors.Wrap(err, "Error pushing CodeQL bundle.")
+}
+
+func TestNewOutcome(t *testing.T) {
+	startedAt := time.Now()
+	outcome := NewOutcome("github/codeql-action", "https://ghe.example.com/github/codeql-action", startedAt, testResult, nil)
+	require.Equal(t, StatusSuccess, outcome.Status)
+	require.Equal(t, []string{"codeql-bundle-20200630"}, outcome.NewBundleVersions)
+	require.Empty(t, outcome.ErrorChain)
+	require.True(t, outcome.Changed())
+	require.Equal(t, []string{
+		"CodeQL Action sync to https://ghe.example.com/github/codeql-action succeeded.",
+		"New CodeQL bundles: codeql-bundle-20200630",
+		"Moved refs/heads/v1 from bd82b85 to 2693638",
+		"Created refs/heads/v3 at e529a54",
+	}, outcome.SummaryLines())
+
+	outcome = NewOutcome("github/codeql-action", "https://ghe.example.com/github/codeql-action", startedAt, nil, getTestError())
+	require.Equal(t, StatusFailure, outcome.Status)
+	require.Equal(t, "Error pushing CodeQL bundle.: Error uploading release asset. (AAAA:BBBB): 502 Bad Gateway", outcome.Error)
+	require.Equal(t, []string{"Error pushing CodeQL bundle.", "Error uploading release asset. (AAAA:BBBB)", "502 Bad Gateway"}, outcome.ErrorChain)
+	require.Equal(t, []string{"AAAA:BBBB"}, outcome.RequestIDs)
+	require.Equal(t, "GitHub request IDs: AAAA:BBBB", outcome.SummaryLines()[len(outcome.SummaryLines())-1])
+}
+
+func TestShouldSend(t *testing.T) {
+	unchanged := NewOutcome("github/codeql-action", "destination", time.Now(), &push.Result{}, nil)
+	changed := NewOutcome("github/codeql-action", "destination", time.Now(), testResult, nil)
+	failed := NewOutcome("github/codeql-action", "destination", time.Now(), nil, usererrors.New("it failed"))
+	require.True(t, unchanged.ShouldSend(OnAlways))
+	require.False(t, unchanged.ShouldSend(OnFailure))
+	require.False(t, unchanged.ShouldSend(OnChange))
+	require.False(t, changed.ShouldSend(OnFailure))
+	require.True(t, changed.ShouldSend(OnChange))
+	require.True(t, failed.ShouldSend(OnFailure))
+	require.True(t, failed.ShouldSend(OnChange))
+	require.EqualError(t, ValidateOn("sometimes"), errorInvalidOn)
+}
+
+func TestRenderBuiltInTemplates(t *testing.T) {
+	outcome := NewOutcome("github/codeql-action", "https://ghe.example.com/github/codeql-action", time.Now(), testResult, nil)
+
+	rawTemplate, err := LoadTemplate(TemplateRaw)
+	require.NoError(t, err)
+	payload, err := Render(rawTemplate, outcome)
+	require.NoError(t, err)
+	raw := Outcome{}
+	require.NoError(t, json.Unmarshal(payload, &raw))
+	require.Equal(t, outcome.MovedReferences, raw.MovedReferences)
+	require.Equal(t, outcome.NewBundleVersions, raw.NewBundleVersions)
+
+	slackTemplate, err := LoadTemplate(TemplateSlack)
+	require.NoError(t, err)
+	payload, err = Render(slackTemplate, outcome)
+	require.NoError(t, err)
+	slack := map[string]string{}
+	require.NoError(t, json.Unmarshal(payload, &slack))
+	require.Equal(t, "CodeQL Action sync to https://ghe.example.com/github/codeql-action succeeded.\nNew CodeQL bundles: codeql-bundle-20200630\nMoved refs/heads/v1 from bd82b85 to 2693638\nCreated refs/heads/v3 at e529a54", slack["text"])
+
+	teamsTemplate, err := LoadTemplate(TemplateTeams)
+	require.NoError(t, err)
+	payload, err = Render(teamsTemplate, outcome)
+	require.NoError(t, err)
+	teams := map[string]string{}
+	require.NoError(t, json.Unmarshal(payload, &teams))
+	require.Equal(t, "MessageCard", teams["@type"])
+	require.Equal(t, "2EB886", teams["themeColor"])
+	require.Equal(t, "CodeQL Action sync to https://ghe.example.com/github/codeql-action succeeded", teams["title"])
+}
+
+func TestRenderCustomTemplate(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	templatePath := path.Join(temporaryDirectory, "template.json")
+	require.NoError(t, ioutil.WriteFile(templatePath, []byte(`{"ok": {{ eq .Status "success" }}, "bundles": {{ json .NewBundleVersions }}}`), 0644))
+	customTemplate, err := LoadTemplate(templatePath)
+	require.NoError(t, err)
+	payload, err := Render(customTemplate, NewOutcome("github/codeql-action", "destination", time.Now(), testResult, nil))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ok": true, "bundles": ["codeql-bundle-20200630"]}`, string(payload))
+
+	require.NoError(t, ioutil.WriteFile(templatePath, []byte(`{"status": {{ .Status }}}`), 0644))
+	customTemplate, err = LoadTemplate(templatePath)
+	require.NoError(t, err)
+	_, err = Render(customTemplate, NewOutcome("github/codeql-action", "destination", time.Now(), testResult, nil))
+	require.EqualError(t, err, "The webhook template did not produce valid JSON.")
+}
+
+func TestSend(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		contentType = request.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(request.Body)
+	}))
+	defer server.Close()
+	slackTemplate, err := LoadTemplate(TemplateSlack)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Send(ctx, server.URL, slackTemplate, NewOutcome("github/codeql-action", "destination", time.Now(), nil, usererrors.New("interrupted")))
+	require.NoError(t, err)
+	require.Equal(t, "application/json", contentType)
+	require.Contains(t, string(body), "Error: interrupted")
+
+	server.Config.Handler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	})
+	err = Send(context.Background(), server.URL, slackTemplate, NewOutcome("github/codeql-action", "destination", time.Now(), nil, nil))
+	require.EqualError(t, err, "Error sending webhook notification: the webhook responded with status code 404.")
+}
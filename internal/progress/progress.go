@@ -0,0 +1,208 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/event"
+	"github.com/mitchellh/ioprogress"
+)
+
+const ModeAuto = "auto"
+const ModeTTY = "tty"
+const ModePlain = "plain"
+const ModeJSON = "json"
+const ModeSilent = "silent"
+
+const errorInvalidMode = "The progress mode %s is not valid. It should be one of `auto`, `tty`, `plain`, `json` or `silent`."
+
+// The plain reporter writes a line for each asset at most this often, so that CI logs stay readable.
+const DefaultPlainInterval = 10 * time.Second
+
+// Reporter shows the progress of release asset transfers and Git operations.
+type Reporter interface {
+	// Asset returns a function to draw the progress of transferring a release asset, for use with an `ioprogress.Reader`.
+	Asset(release string, asset string) ioprogress.DrawFunc
+	// Git returns a writer for the progress messages of the Git fetch or push in a phase.
+	Git(phase string) io.Writer
+	// Event is called with every event of a pull or push.
+	Event(e event.Event)
+}
+
+// New returns the reporter for a mode. Progress is written to standard error, except in JSON mode, where it is written to standard output so that it is not mixed with log messages.
+func New(mode string) (Reporter, error) {
+	switch mode {
+	case ModeAuto:
+		if isTerminal(os.Stderr) {
+			return NewTTY(os.Stderr), nil
+		}
+		return NewPlain(os.Stderr, DefaultPlainInterval), nil
+	case ModeTTY:
+		return NewTTY(os.Stderr), nil
+	case ModePlain:
+		return NewPlain(os.Stderr, DefaultPlainInterval), nil
+	case ModeJSON:
+		return NewJSON(os.Stdout), nil
+	case ModeSilent:
+		return Silent(), nil
+	}
+	return nil, fmt.Errorf(errorInvalidMode, mode)
+}
+
+func isTerminal(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	return err == nil && fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// GitWriter returns a writer for the progress messages of a Git fetch or push, which passes them to the reporter and also emits each complete line as an event.
+func GitWriter(reporter Reporter, events event.Handler, phase string) io.Writer {
+	return io.MultiWriter(reporter.Git(phase), newLineWriter(func(line string) {
+		events.Emit(event.Event{Type: event.GitProgress, Phase: phase, Message: line})
+	}))
+}
+
+// lineWriter passes on each complete line written to it. Git servers redraw progress with carriage returns, so anything overwritten by a carriage return is dropped.
+type lineWriter struct {
+	mutex  sync.Mutex
+	buffer []byte
+	line   func(line string)
+}
+
+func newLineWriter(line func(line string)) *lineWriter {
+	return &lineWriter{line: line}
+}
+
+func (writer *lineWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	for _, b := range p {
+		switch b {
+		case '\r':
+			writer.buffer = writer.buffer[:0]
+		case '\n':
+			if len(writer.buffer) != 0 {
+				writer.line(string(writer.buffer))
+			}
+			writer.buffer = writer.buffer[:0]
+		default:
+			writer.buffer = append(writer.buffer, b)
+		}
+	}
+	return len(p), nil
+}
+
+type ttyReporter struct {
+	output io.Writer
+}
+
+// NewTTY returns a reporter that redraws progress in place, for an interactive terminal.
+func NewTTY(output io.Writer) Reporter {
+	return &ttyReporter{output: output}
+}
+
+func (reporter *ttyReporter) Asset(release string, asset string) ioprogress.DrawFunc {
+	return ioprogress.DrawTerminalf(reporter.output, ioprogress.DrawTextFormatBytes)
+}
+
+func (reporter *ttyReporter) Git(phase string) io.Writer {
+	return reporter.output
+}
+
+func (reporter *ttyReporter) Event(e event.Event) {}
+
+type plainReporter struct {
+	mutex    sync.Mutex
+	output   io.Writer
+	interval time.Duration
+}
+
+// NewPlain returns a reporter that writes a line of progress for each asset at most once per interval, and only the completed lines of Git progress, for logs.
+func NewPlain(output io.Writer, interval time.Duration) Reporter {
+	return &plainReporter{output: output, interval: interval}
+}
+
+func (reporter *plainReporter) println(line string) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	fmt.Fprintln(reporter.output, line)
+}
+
+func (reporter *plainReporter) Asset(release string, asset string) ioprogress.DrawFunc {
+	var lastDraw time.Time
+	var lastProgress int64 = -1
+	return func(progress int64, total int64) error {
+		if progress < 0 {
+			return nil
+		}
+		finished := progress == total
+		if progress == lastProgress || (!finished && !lastDraw.IsZero() && time.Since(lastDraw) < reporter.interval) {
+			return nil
+		}
+		lastDraw = time.Now()
+		lastProgress = progress
+		percentage := int64(100)
+		if total > 0 {
+			percentage = progress * 100 / total
+		}
+		reporter.println(fmt.Sprintf("%s %s: %s (%d%%)", release, asset, ioprogress.DrawTextFormatBytes(progress, total), percentage))
+		return nil
+	}
+}
+
+func (reporter *plainReporter) Git(phase string) io.Writer {
+	return newLineWriter(reporter.println)
+}
+
+func (reporter *plainReporter) Event(e event.Event) {}
+
+type jsonReporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSON returns a reporter that writes every event as a line of JSON.
+func NewJSON(output io.Writer) Reporter {
+	return &jsonReporter{encoder: json.NewEncoder(output)}
+}
+
+// Asset progress is reported by the events emitted alongside the draw function.
+func (reporter *jsonReporter) Asset(release string, asset string) ioprogress.DrawFunc {
+	return discardDraw
+}
+
+// Git progress is reported by the events emitted by GitWriter.
+func (reporter *jsonReporter) Git(phase string) io.Writer {
+	return ioutil.Discard
+}
+
+func (reporter *jsonReporter) Event(e event.Event) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.encoder.Encode(e)
+}
+
+type silentReporter struct{}
+
+// Silent returns a reporter that does not report anything.
+func Silent() Reporter {
+	return silentReporter{}
+}
+
+func (reporter silentReporter) Asset(release string, asset string) ioprogress.DrawFunc {
+	return discardDraw
+}
+
+func (reporter silentReporter) Git(phase string) io.Writer {
+	return ioutil.Discard
+}
+
+func (reporter silentReporter) Event(e event.Event) {}
+
+func discardDraw(progress int64, total int64) error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/event"
+	"github.com/stretchr/testify/require"
+)
+
+const gitServerProgress = "Counting objects:  50% (1/2)\rCounting objects: 100% (2/2)\rCounting objects: 100% (2/2), done.\nCompressing objects: 100% (1/1), done.\n"
+
+func TestNewRejectsInvalidMode(t *testing.T) {
+	_, err := New("fancy")
+	require.EqualError(t, err, fmt.Sprintf(errorInvalidMode, "fancy"))
+	reporter, err := New(ModeSilent)
+	require.NoError(t, err)
+	require.Equal(t, Silent(), reporter)
+}
+
+func TestPlainAsset(t *testing.T) {
+	output := bytes.Buffer{}
+	reporter := NewPlain(&output, time.Hour)
+	draw := reporter.Asset("codeql-bundle-20200101", "codeql-bundle.tar.gz")
+	for _, progress := range []int64{0, 1000, 2000, 3000, 3000, -1} {
+		total := int64(3000)
+		if progress == -1 {
+			total = -1
+		}
+		require.NoError(t, draw(progress, total))
+	}
+	require.Equal(t, `codeql-bundle-20200101 codeql-bundle.tar.gz: 0 B/3 KB (0%)
+codeql-bundle-20200101 codeql-bundle.tar.gz: 3 KB/3 KB (100%)
+`, output.String())
+}
+
+func TestPlainGitDropsRedrawnLines(t *testing.T) {
+	output := bytes.Buffer{}
+	reporter := NewPlain(&output, time.Hour)
+	writer := reporter.Git("pullGit")
+	// Progress may be split across writes at any point.
+	for _, chunk := range strings.SplitAfter(gitServerProgress, "o") {
+		_, err := writer.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+	require.Equal(t, "Counting objects: 100% (2/2), done.\nCompressing objects: 100% (1/1), done.\n", output.String())
+}
+
+func TestJSON(t *testing.T) {
+	output := bytes.Buffer{}
+	reporter := NewJSON(&output)
+	events := event.Combine(reporter.Event)
+	draw := events.WrapDraw("codeql-bundle-20200101", "codeql-bundle.tar.gz", reporter.Asset("codeql-bundle-20200101", "codeql-bundle.tar.gz"))
+	require.NoError(t, draw(1000, 3000))
+	require.NoError(t, draw(-1, -1))
+	_, err := GitWriter(reporter, events, "pushGit").Write([]byte(gitServerProgress))
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"asset_progress","release":"codeql-bundle-20200101","asset":"codeql-bundle.tar.gz","bytes":1000,"total":3000}
+{"type":"git_progress","phase":"pushGit","message":"Counting objects: 100% (2/2), done."}
+{"type":"git_progress","phase":"pushGit","message":"Compressing objects: 100% (1/1), done."}
+`, output.String())
+}
+
+func TestTTYPassesGitProgressThrough(t *testing.T) {
+	output := bytes.Buffer{}
+	reporter := NewTTY(&output)
+	_, err := GitWriter(reporter, nil, "pullGit").Write([]byte(gitServerProgress))
+	require.NoError(t, err)
+	require.Equal(t, gitServerProgress, output.String())
+}
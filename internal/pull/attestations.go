@@ -0,0 +1,67 @@
+package pull
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/github/codeql-action-sync/internal/attestation"
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type attestationsResponse struct {
+	Attestations []struct {
+		Bundle json.RawMessage `json:"bundle"`
+	} `json:"attestations"`
+}
+
+// downloadAttestation stores the Sigstore bundles attesting to an asset in JSON Lines format, which is the same format `gh attestation download` uses.
+func (pullService *pullService) downloadAttestation(releaseTag string, assetName string) error {
+	attestationPath := pullService.cacheDirectory.AttestationPath(releaseTag, assetName)
+	digest, err := attestation.DigestFile(pullService.cacheDirectory.AssetPath(releaseTag, assetName))
+	if err != nil {
+		return err
+	}
+	request, err := pullService.githubClient.NewRequest("GET", fmt.Sprintf("repos/%s/%s/attestations/sha256:%s", pullService.sourceOwner, pullService.sourceRepository, digest), nil)
+	if err != nil {
+		return errors.Wrap(err, "Error constructing attestation request.")
+	}
+	attestations := attestationsResponse{}
+	response, err := pullService.githubClient.Do(pullService.ctx, request, &attestations)
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return githubapiutil.EnrichResponseError(response, err, "Error downloading attestations for asset "+assetName+".")
+	}
+	var content bytes.Buffer
+	for _, bundle := range attestations.Attestations {
+		if len(bundle.Bundle) == 0 || string(bundle.Bundle) == "null" {
+			continue
+		}
+		err := json.Compact(&content, bundle.Bundle)
+		if err != nil {
+			return errors.Wrap(err, "Error parsing attestation.")
+		}
+		content.WriteString("\n")
+	}
+	if content.Len() == 0 {
+		log.Warnf("There are no attestations for asset %s in release %s.", assetName, releaseTag)
+		err := os.Remove(attestationPath)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "Error removing outdated attestations.")
+		}
+		return nil
+	}
+	err = os.MkdirAll(pullService.cacheDirectory.AttestationsPath(releaseTag), 0755)
+	if err != nil {
+		return errors.Wrap(err, "Error creating attestations directory.")
+	}
+	err = ioutil.WriteFile(attestationPath, content.Bytes(), 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing attestations.")
+	}
+	return nil
+}
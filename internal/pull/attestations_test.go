@@ -0,0 +1,35 @@
+package pull
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadAttestation(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	digest := sha256.Sum256([]byte(releaseSomeCodeQLVersionOnMainContent))
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/attestations/sha256:"+hex.EncodeToString(digest[:]), func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromString(t, `{"attestations": [{"bundle": {"mediaType": "first"}, "repository_id": 1}, {"bundle": {"mediaType": "second"}, "repository_id": 1}]}`, response)
+	}).Methods("GET")
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, githubURL)
+	require.NoError(t, os.MkdirAll(pullService.cacheDirectory.AssetsPath("some-codeql-version-on-main"), 0755))
+	require.NoError(t, ioutil.WriteFile(pullService.cacheDirectory.AssetPath("some-codeql-version-on-main", "codeql-bundle.tar.gz"), []byte(releaseSomeCodeQLVersionOnMainContent), 0644))
+
+	err := pullService.downloadAttestation("some-codeql-version-on-main", "codeql-bundle.tar.gz")
+	require.NoError(t, err)
+	test.RequireFileHasContent(t, "{\"mediaType\":\"first\"}\n{\"mediaType\":\"second\"}\n", pullService.cacheDirectory.AttestationPath("some-codeql-version-on-main", "codeql-bundle.tar.gz"))
+
+	// An asset without attestations should not keep any that are left over from a previous pull.
+	require.NoError(t, ioutil.WriteFile(pullService.cacheDirectory.AssetPath("some-codeql-version-on-main", "codeql-bundle.tar.gz"), []byte("A different not-bundle."), 0644))
+	err = pullService.downloadAttestation("some-codeql-version-on-main", "codeql-bundle.tar.gz")
+	require.NoError(t, err)
+	require.NoFileExists(t, pullService.cacheDirectory.AttestationPath("some-codeql-version-on-main", "codeql-bundle.tar.gz"))
+}
@@ -0,0 +1,62 @@
+package pull
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/github/codeql-action-sync/internal/changelog"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// snapshotReferences records the commits of the Action's branches and tags as of the last pull, or returns nil if there is no usable cache yet.
+func (pullService *pullService) snapshotReferences() map[string]plumbing.Hash {
+	localRepository, err := git.PlainOpen(pullService.cacheDirectory.GitPath())
+	if err != nil {
+		log.Debugf("Not recording the previous state of the cache for the changelog: %s", err.Error())
+		return nil
+	}
+	snapshot, err := changelog.Snapshot(localRepository, relevantReferences)
+	if err != nil {
+		log.Debugf("Not recording the previous state of the cache for the changelog: %s", err.Error())
+		return nil
+	}
+	return snapshot
+}
+
+func (pullService *pullService) writeChangelog(previousReferences map[string]plumbing.Hash) error {
+	for _, format := range []string{changelog.FormatMarkdown, changelog.FormatHTML} {
+		err := os.Remove(pullService.cacheDirectory.ChangelogPath(changelog.Extension(format)))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "Error removing outdated changelog.")
+		}
+	}
+	if pullService.changelogFormat == "" {
+		return nil
+	}
+	log.Debug("Writing changelog...")
+	localRepository, err := git.PlainOpen(pullService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error opening Git repository cache.")
+	}
+	currentReferences, err := changelog.Snapshot(localRepository, relevantReferences)
+	if err != nil {
+		return err
+	}
+	generated, err := changelog.Generate(localRepository, fmt.Sprintf("%s/%s", pullService.sourceOwner, pullService.sourceRepository), previousReferences, currentReferences)
+	if err != nil {
+		return err
+	}
+	rendered, err := generated.Render(pullService.changelogFormat)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(pullService.cacheDirectory.ChangelogPath(changelog.Extension(pullService.changelogFormat)), []byte(rendered), 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing changelog.")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package pull
+
+import (
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/changelog"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteChangelog(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, "")
+	pullService.changelogFormat = changelog.FormatMarkdown
+	previousReferences := pullService.snapshotReferences()
+	require.Nil(t, previousReferences)
+	err := pullService.pullGit(true)
+	require.NoError(t, err)
+	err = pullService.writeChangelog(previousReferences)
+	require.NoError(t, err)
+	test.RequireFileHasContent(t, "# Changes to the CodeQL Action from github/codeql-action\n\n"+
+		"This is the first sync to this cache, so every branch and tag is new.\n\n"+
+		"## refs/heads/main\n\nAdded at `b9f01aa`.\n\nCodeQL bundle: `some-codeql-version-on-main`.\n\n"+
+		"## refs/heads/v1\n\nAdded at `2693638`.\n\nCodeQL bundle: `some-codeql-version-on-v1-and-v2`.\n\n"+
+		"## refs/heads/v3\n\nAdded at `e529a54`.\n\n"+
+		"## refs/tags/v2\n\nAdded at `2693638`.\n\nCodeQL bundle: `some-codeql-version-on-v1-and-v2`.\n\n",
+		pullService.cacheDirectory.ChangelogPath(".md"))
+
+	previousReferences = pullService.snapshotReferences()
+	pullService.gitCloneURL = modifiedActionRepository
+	pullService.changelogFormat = changelog.FormatHTML
+	err = pullService.pullGit(false)
+	require.NoError(t, err)
+	err = pullService.writeChangelog(previousReferences)
+	require.NoError(t, err)
+	require.NoFileExists(t, pullService.cacheDirectory.ChangelogPath(".md"))
+	test.RequireFileHasContent(t, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Changes to the CodeQL Action from github/codeql-action</title>
+</head>
+<body>
+<h1>Changes to the CodeQL Action from github/codeql-action</h1>
+<h2>refs/heads/v3</h2>
+<p>Updated from <code>e529a54</code> to <code>33d4202</code>.</p>
+<p>CodeQL bundle: <code>some-codeql-version-on-main</code>.</p>
+<p>The new commit does not descend from the previous one (for example because it was force-pushed), so these are the commits that are only in the new version.</p>
+<h3>Commits</h3>
+<ul>
+<li><code>33d4202</code> &#34;Force push&#34; v3 branch. (Chris Gavin, 2020-08-18)</li>
+</ul>
+<h2>refs/heads/v4</h2>
+<p>Added at <code>42d077b</code>.</p>
+<p>CodeQL bundle: <code>some-codeql-version-on-main</code>.</p>
+<h2>refs/tags/v2</h2>
+<p>Removed (was at <code>2693638</code>).</p>
+<p>Unchanged: refs/heads/main, refs/heads/v1.</p>
+</body>
+</html>
+`, pullService.cacheDirectory.ChangelogPath(".html"))
+
+	pullService.changelogFormat = ""
+	err = pullService.writeChangelog(previousReferences)
+	require.NoError(t, err)
+	require.NoFileExists(t, pullService.cacheDirectory.ChangelogPath(".html"))
+}
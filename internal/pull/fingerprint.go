@@ -0,0 +1,67 @@
+package pull
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+)
+
+// fingerprint summarizes the upstream state that a pull depends on: the commits of the synced references and the most recent releases and their assets.
+func (pullService *pullService) fingerprint() (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{pullService.gitCloneURL},
+	})
+	var remoteReferences []*plumbing.Reference
+	err := pullService.retryPolicy.Do(pullService.ctx, "list remote references", func() error {
+		var err error
+		remoteReferences, err = remote.List(&git.ListOptions{Auth: pullService.gitCredentials()})
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Error listing remote references.")
+	}
+	lines := []string{}
+	for _, reference := range remoteReferences {
+		if relevantReferences.MatchString(reference.Name().String()) {
+			lines = append(lines, fmt.Sprintf("%s %s", reference.Hash(), reference.Name()))
+		}
+	}
+
+	releases, response, err := pullService.githubClient.Repositories.ListReleases(pullService.ctx, pullService.sourceOwner, pullService.sourceRepository, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", githubapiutil.EnrichResponseError(response, err, "Error listing releases.")
+	}
+	for _, release := range releases {
+		for _, asset := range release.Assets {
+			lines = append(lines, fmt.Sprintf("%s %d %s %d", release.GetTagName(), asset.GetID(), asset.GetName(), asset.GetSize()))
+		}
+	}
+
+	sort.Strings(lines)
+	hash := sha256.New()
+	for _, line := range lines {
+		fmt.Fprintln(hash, line)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Fingerprint returns a digest of the upstream state that `Pull` would sync, which changes whenever there is something new to pull.
+// Fingerprint only uses the source settings of the options.
+func Fingerprint(ctx context.Context, options Options) (string, error) {
+	pullService, err := newPullService(ctx, options)
+	if err != nil {
+		return "", err
+	}
+	return pullService.fingerprint()
+}
@@ -0,0 +1,36 @@
+package pull
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	releases := []github.RepositoryRelease{releaseSomeCodeQLVersionOnMain}
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/releases", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, releases, response)
+	}).Methods("GET")
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, githubURL)
+
+	initial, err := pullService.fingerprint()
+	require.NoError(t, err)
+	unchanged, err := pullService.fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, initial, unchanged)
+
+	releases = append(releases, releaseSomeCodeQLVersionOnV1AndV2)
+	newRelease, err := pullService.fingerprint()
+	require.NoError(t, err)
+	require.NotEqual(t, initial, newRelease)
+
+	pullService.gitCloneURL = modifiedActionRepository
+	movedReferences, err := pullService.fingerprint()
+	require.NoError(t, err)
+	require.NotEqual(t, newRelease, movedReferences)
+}
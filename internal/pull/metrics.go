@@ -0,0 +1,38 @@
+package pull
+
+import (
+	"github.com/github/codeql-action-sync/internal/gitutil"
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// recordUpstreamReferences records which commit each Action reference is at upstream. It must be called before pins are applied.
+func (pullService *pullService) recordUpstreamReferences() error {
+	localRepository, err := git.PlainOpen(pullService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error opening Git repository cache.")
+	}
+	references, err := localRepository.References()
+	if err != nil {
+		return errors.Wrap(err, "Error reading references from Git repository cache.")
+	}
+	defer references.Close()
+	metrics.UpstreamReference.Reset()
+	metrics.UpstreamCommitTime.Reset()
+	return references.ForEach(func(reference *plumbing.Reference) error {
+		if !relevantReferences.MatchString(reference.Name().String()) {
+			return nil
+		}
+		metrics.UpstreamReference.Set(1, reference.Name().String(), reference.Hash().String())
+		commitTime, err := gitutil.CommitTime(localRepository, reference.Hash())
+		if err != nil {
+			return err
+		}
+		metrics.UpstreamCommitTime.Set(commitTime, reference.Name().String())
+		return nil
+	})
+}
+
+// commitTime returns when a commit, or the commit an annotated tag points to, was committed, as a Unix timestamp.
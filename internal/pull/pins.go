@@ -0,0 +1,109 @@
+package pull
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const errorPinnedReferenceNotFound = "The pinned reference %s does not exist in the source repository."
+const errorPinTargetNotFound = "The pin target %s for %s could not be found in the source repository."
+
+// pinnedReference is recorded in the cache for each pinned branch or tag, so that pushing can tell the upstream version apart from changes made on the destination.
+type pinnedReference struct {
+	Pin      string `json:"pin"`
+	Pinned   string `json:"pinned"`
+	Upstream string `json:"upstream"`
+}
+
+// applyPins moves each pinned branch or tag in the cache from the upstream tip to the commit it is pinned to, so that only the pinned version is pushed and only the CodeQL bundles it needs are pulled.
+func (pullService *pullService) applyPins() error {
+	err := os.Remove(pullService.cacheDirectory.PinsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Error removing previous pins.")
+	}
+	if len(pullService.pins) == 0 {
+		return nil
+	}
+	localRepository, err := git.PlainOpen(pullService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error opening Git repository cache.")
+	}
+
+	names := []string{}
+	for name := range pullService.pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pinnedReferences := map[string]pinnedReference{}
+	// Resolve every target before moving anything, so that pinning one reference to another uses the upstream version of it.
+	targets := map[string]plumbing.Hash{}
+	for _, name := range names {
+		target := pullService.pins[name]
+		hash, err := localRepository.ResolveRevision(plumbing.Revision(target))
+		if err != nil {
+			return fmt.Errorf(errorPinTargetNotFound, target, name)
+		}
+		targets[name] = *hash
+	}
+
+	for _, name := range names {
+		target := targets[name]
+		targetCommit, err := localRepository.CommitObject(target)
+		if err != nil {
+			return errors.Wrapf(err, "Error loading commit %s.", target.String())
+		}
+		found := false
+		for _, referenceName := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(name), plumbing.NewTagReferenceName(name)} {
+			_, err := localRepository.Reference(referenceName, true)
+			if err == plumbing.ErrReferenceNotFound {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "Error finding reference %s.", referenceName)
+			}
+			found = true
+			upstreamHash, err := localRepository.ResolveRevision(plumbing.Revision(referenceName))
+			if err != nil {
+				return errors.Wrapf(err, "Error resolving reference %s.", referenceName)
+			}
+			upstreamCommit, err := localRepository.CommitObject(*upstreamHash)
+			if err != nil {
+				return errors.Wrapf(err, "Error loading commit %s for reference %s.", upstreamHash.String(), referenceName)
+			}
+			isAncestor, err := targetCommit.IsAncestor(upstreamCommit)
+			if err != nil {
+				return errors.Wrapf(err, "Error comparing pin target %s with %s.", pullService.pins[name], referenceName)
+			}
+			if !isAncestor && targetCommit.Hash != upstreamCommit.Hash {
+				log.Warnf("%s is pinned to %s, which is not part of its upstream history.", referenceName, pullService.pins[name])
+			}
+			log.Infof("Pinning %s to %s (%s) instead of the upstream %s.", referenceName, pullService.pins[name], target.String(), upstreamHash.String())
+			err = localRepository.Storer.SetReference(plumbing.NewHashReference(referenceName, target))
+			if err != nil {
+				return errors.Wrapf(err, "Error pinning reference %s.", referenceName)
+			}
+			pinnedReferences[referenceName.String()] = pinnedReference{Pin: pullService.pins[name], Pinned: target.String(), Upstream: upstreamHash.String()}
+		}
+		if !found {
+			return fmt.Errorf(errorPinnedReferenceNotFound, name)
+		}
+	}
+
+	pinsJSON, err := json.MarshalIndent(pinnedReferences, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error converting pins to JSON.")
+	}
+	err = ioutil.WriteFile(pullService.cacheDirectory.PinsPath(), pinsJSON, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing pins.")
+	}
+	return nil
+}
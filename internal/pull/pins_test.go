@@ -0,0 +1,70 @@
+package pull
+
+import (
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPins(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, "")
+	err := pullService.pullGit(true)
+	require.NoError(t, err)
+	pullService.pins = map[string]string{
+		"main": "v2",
+		"v3":   "26936381e619a01122ea33993e3cebc474496805",
+	}
+	err = pullService.applyPins()
+	require.NoError(t, err)
+	test.CheckExpectedReferencesInRepository(t, pullService.cacheDirectory.GitPath(), []string{
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/main",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/v1",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/v3",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/v2",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/heads/very-ignored-branch",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/tags/an-ignored-tag-too",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/a-ref-that-will-need-pruning",
+	})
+	test.RequireFileHasContent(t, `{
+  "refs/heads/main": {
+    "pin": "v2",
+    "pinned": "26936381e619a01122ea33993e3cebc474496805",
+    "upstream": "b9f01aa2c50f49898d4c7845a66be8824499fe9d"
+  },
+  "refs/heads/v3": {
+    "pin": "26936381e619a01122ea33993e3cebc474496805",
+    "pinned": "26936381e619a01122ea33993e3cebc474496805",
+    "upstream": "e529a54fad10a936308b2220e05f7f00757f8e7c"
+  }
+}`, pullService.cacheDirectory.PinsPath())
+
+	// The bundles are worked out from the pinned commits, so the bundle only referenced by the upstream `main` is no longer needed.
+	relevantReleases, err := pullService.findRelevantReleases()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"some-codeql-version-on-v1-and-v2",
+	}, relevantReleases)
+
+	// Pulling again restores the upstream versions before pinning.
+	err = pullService.pullGit(false)
+	require.NoError(t, err)
+	pullService.pins = nil
+	err = pullService.applyPins()
+	require.NoError(t, err)
+	require.NoFileExists(t, pullService.cacheDirectory.PinsPath())
+}
+
+func TestApplyPinsErrors(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, "")
+	err := pullService.pullGit(true)
+	require.NoError(t, err)
+	pullService.pins = map[string]string{"v9": "v2"}
+	err = pullService.applyPins()
+	require.EqualError(t, err, "The pinned reference v9 does not exist in the source repository.")
+	pullService.pins = map[string]string{"v3": "v3.99.0"}
+	err = pullService.applyPins()
+	require.EqualError(t, err, "The pin target v3.99.0 for v3 could not be found in the source repository.")
+}
@@ -3,21 +3,33 @@ package pull
 import (
 	"context"
 	"encoding/json"
+	usererrors "errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/github/codeql-action-sync/internal/actionconfiguration"
 	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/github/codeql-action-sync/internal/manifest"
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/github/codeql-action-sync/internal/progress"
+	"github.com/github/codeql-action-sync/internal/retry"
+	"github.com/github/codeql-action-sync/internal/signature"
 	"github.com/mitchellh/ioprogress"
 	"golang.org/x/oauth2"
 
 	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/changelog"
+	"github.com/github/codeql-action-sync/internal/event"
 	"github.com/github/codeql-action-sync/internal/version"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
@@ -28,23 +40,46 @@ import (
 	"github.com/pkg/errors"
 )
 
-const sourceOwner = "github"
-const sourceRepository = "codeql-action"
-const defaultSourceURL = "https://github.com/" + sourceOwner + "/" + sourceRepository + ".git"
+const defaultSourceRepository = "github/codeql-action"
+const githubDotComURL = "https://github.com"
 
 var relevantReferences = regexp.MustCompile("^refs/(heads|tags)/(main|v\\d+)$")
 
-const defaultConfigurationPath = "src/defaults.json"
+const errorStrictSignaturesWithoutKeys = "`--strict-signatures` requires trusted keys to be provided with `--trusted-keys`."
+const errorInvalidSourceRepository = "The source repository %s is not valid. It should be in the form `owner/name`."
 
 type pullService struct {
-	ctx                context.Context
-	cacheDirectory     cachedirectory.CacheDirectory
-	gitCloneURL        string
-	githubDotComClient *github.Client
-	sourceToken        string
+	ctx              context.Context
+	cacheDirectory   cachedirectory.CacheDirectory
+	gitCloneURL      string
+	githubClient     *github.Client
+	sourceOwner      string
+	sourceRepository string
+	sourceToken      string
+	retryPolicy      retry.Policy
+	pins             map[string]string
+	keyring          *signature.Keyring
+	strictSignatures bool
+	attestations     bool
+	sbom             bool
+	changelogFormat  string
+	events           event.Handler
+	progress         progress.Reporter
+}
+
+func (pullService *pullService) gitCredentials() *githttp.BasicAuth {
+	if pullService.sourceToken == "" {
+		return nil
+	}
+	return &githttp.BasicAuth{
+		Username: "x-access-token",
+		Password: pullService.sourceToken,
+	}
 }
 
 func (pullService *pullService) pullGit(fresh bool) error {
+	defer metrics.TimePhase(metrics.PhasePullGit)()
+	defer pullService.events.StartPhase(metrics.PhasePullGit)()
 	if fresh {
 		log.Debug("Pulling Git contents fresh...")
 	} else {
@@ -80,15 +115,14 @@ func (pullService *pullService) pullGit(fresh bool) error {
 		URLs: []string{pullService.gitCloneURL},
 	})
 
-	var credentials *githttp.BasicAuth
-	if pullService.sourceToken != "" {
-		credentials = &githttp.BasicAuth{
-			Username: "x-access-token",
-			Password: pullService.sourceToken,
-		}
-	}
+	credentials := pullService.gitCredentials()
 
-	remoteReferences, err := remote.List(&git.ListOptions{Auth: credentials})
+	var remoteReferences []*plumbing.Reference
+	err = pullService.retryPolicy.Do(pullService.ctx, "list remote references", func() error {
+		var err error
+		remoteReferences, err = remote.List(&git.ListOptions{Auth: credentials})
+		return err
+	})
 	if err != nil {
 		return errors.Wrap(err, "Error listing remote references.")
 	}
@@ -112,36 +146,48 @@ func (pullService *pullService) pullGit(fresh bool) error {
 		return nil
 	})
 
-	err = remote.FetchContext(pullService.ctx, &git.FetchOptions{
-		RemoteName: git.DefaultRemoteName,
-		RefSpecs: []config.RefSpec{
-			config.RefSpec("+refs/heads/*:refs/heads/*"),
-			config.RefSpec("+refs/tags/*:refs/tags/*"),
-		},
-		Progress: os.Stderr,
-		Tags:     git.NoTags,
-		Force:    true,
-		Auth:     credentials,
+	err = pullService.retryPolicy.Do(pullService.ctx, "fetch Git contents", func() error {
+		err := remote.FetchContext(pullService.ctx, &git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			RefSpecs: []config.RefSpec{
+				config.RefSpec("+refs/heads/*:refs/heads/*"),
+				config.RefSpec("+refs/tags/*:refs/tags/*"),
+			},
+			Progress: progress.GitWriter(pullService.progress, pullService.events, metrics.PhasePullGit),
+			Tags:     git.NoTags,
+			Force:    true,
+			Auth:     credentials,
+		})
+		if err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		return err
 	})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
+	if err != nil {
 		return errors.Wrap(err, "Error doing Git fetch.")
 	}
 	return nil
 }
 
-func (pullService *pullService) findRelevantReleases() ([]string, error) {
+// releaseReference is a synced reference of the Action, and the CodeQL bundle that it uses.
+type releaseReference struct {
+	reference     plumbing.ReferenceName
+	commit        plumbing.Hash
+	bundleVersion string
+}
+
+func (pullService *pullService) findReleaseReferences() ([]releaseReference, error) {
 	log.Debug("Finding release references...")
 	localRepository, err := git.PlainOpen(pullService.cacheDirectory.GitPath())
 	if err != nil {
-		return []string{}, errors.Wrap(err, "Error opening Git repository cache.")
+		return nil, errors.Wrap(err, "Error opening Git repository cache.")
 	}
 	references, err := localRepository.References()
 	if err != nil {
-		return []string{}, errors.Wrap(err, "Error reading references from Git repository cache.")
+		return nil, errors.Wrap(err, "Error reading references from Git repository cache.")
 	}
 	defer references.Close()
-	releasesMap := map[string]bool{}
-	releases := []string{}
+	releaseReferences := []releaseReference{}
 	err = references.ForEach(func(reference *plumbing.Reference) error {
 		if relevantReferences.MatchString(reference.Name().String()) {
 			log.Debugf("Found %s.", reference.Name().String())
@@ -154,7 +200,7 @@ func (pullService *pullService) findRelevantReleases() ([]string, error) {
 			if err != nil {
 				return errors.Wrapf(err, "Error loading commit %s for reference %s.", resolvedReference.String(), reference.Name().String())
 			}
-			file, err := commit.File(defaultConfigurationPath)
+			file, err := commit.File(actionconfiguration.DefaultConfigurationPath)
 			if err != nil {
 				if err == object.ErrFileNotFound {
 					log.Debugf("Ignoring reference %s as it does not have a default configuration.", reference.Name().String())
@@ -170,20 +216,126 @@ func (pullService *pullService) findRelevantReleases() ([]string, error) {
 			if err != nil {
 				return err
 			}
-			if _, exists := releasesMap[configuration.BundleVersion]; !exists {
-				releasesMap[configuration.BundleVersion] = true
-				releases = append(releases, configuration.BundleVersion)
-			}
+			releaseReferences = append(releaseReferences, releaseReference{
+				reference:     reference.Name(),
+				commit:        *resolvedReference,
+				bundleVersion: configuration.BundleVersion,
+			})
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	return releaseReferences, nil
+}
+
+func (pullService *pullService) findRelevantReleases() ([]string, error) {
+	releaseReferences, err := pullService.findReleaseReferences()
+	if err != nil {
+		return []string{}, err
+	}
+	releasesMap := map[string]bool{}
+	releases := []string{}
+	for _, releaseReference := range releaseReferences {
+		if _, exists := releasesMap[releaseReference.bundleVersion]; !exists {
+			releasesMap[releaseReference.bundleVersion] = true
+			releases = append(releases, releaseReference.bundleVersion)
+		}
+	}
 	return releases, nil
 }
 
+// downloadAsset downloads to a partial file first, and resumes the download from it if it is already there, e.g. because a previous pull was interrupted.
+func (pullService *pullService) downloadAsset(releaseTag string, asset *github.ReleaseAsset, downloadPath string) error {
+	err := os.RemoveAll(downloadPath)
+	if err != nil {
+		return errors.Wrap(err, "Error removing existing cached asset.")
+	}
+	partialPath := pullService.cacheDirectory.PartialAssetPath(releaseTag, asset.GetID(), asset.GetName())
+	err = os.MkdirAll(filepath.Dir(partialPath), 0755)
+	if err != nil {
+		return errors.Wrap(err, "Error creating partial downloads directory.")
+	}
+	size := int64(asset.GetSize())
+	offset := int64(0)
+	partialPathStat, err := os.Stat(partialPath)
+	if err == nil && partialPathStat.Size() < size {
+		offset = partialPathStat.Size()
+	}
+
+	// The whole download is retried by the caller, so the request for the asset is not retried on its own as well.
+	reader, redirectURL, err := pullService.githubClient.Repositories.DownloadReleaseAsset(retry.WithoutRetries(pullService.ctx), pullService.sourceOwner, pullService.sourceRepository, asset.GetID(), nil)
+	if err != nil {
+		return errors.Wrap(err, "Error downloading asset.")
+	}
+	if reader == nil {
+		request, err := http.NewRequestWithContext(pullService.ctx, "GET", redirectURL, nil)
+		if err != nil {
+			return errors.Wrap(err, "Error constructing asset download request.")
+		}
+		if offset != 0 {
+			request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return errors.Wrap(err, "Error downloading asset.")
+		}
+		if response.StatusCode >= 300 {
+			response.Body.Close()
+			return errors.Wrap(&retry.StatusError{StatusCode: response.StatusCode, Message: "Unexpected response"}, "Error downloading asset.")
+		}
+		if response.StatusCode != http.StatusPartialContent || !strings.HasPrefix(response.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			offset = 0
+		}
+		reader = response.Body
+	} else {
+		// The asset was served without a redirect, so there was no chance to ask for just the rest of it.
+		offset = 0
+	}
+	defer reader.Close()
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset != 0 {
+		log.Debugf("Resuming download of asset %s from %d bytes...", asset.GetName(), offset)
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	partialFile, err := os.OpenFile(partialPath, flags, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error creating partial asset file.")
+	}
+	draw := pullService.events.WrapDraw(releaseTag, asset.GetName(), pullService.progress.Asset(releaseTag, asset.GetName()))
+	progressReader := &ioprogress.Reader{
+		Reader: reader,
+		Size:   size - offset,
+		DrawFunc: func(progress int64, total int64) error {
+			if progress >= 0 {
+				progress, total = progress+offset, total+offset
+			}
+			return draw(progress, total)
+		},
+	}
+	written, err := io.Copy(partialFile, progressReader)
+	metrics.DownloadedBytes.Add(float64(written))
+	closeErr := partialFile.Close()
+	if err != nil {
+		return errors.Wrap(err, "Error downloading asset.")
+	}
+	if closeErr != nil {
+		return errors.Wrap(closeErr, "Error writing partial asset file.")
+	}
+	if offset+written != size {
+		return errors.Wrap(io.ErrUnexpectedEOF, "Error downloading asset.")
+	}
+	err = os.Rename(partialPath, downloadPath)
+	if err != nil {
+		return errors.Wrap(err, "Error moving downloaded asset into the cache.")
+	}
+	return nil
+}
+
 func (pullService *pullService) pullReleases() error {
+	defer metrics.TimePhase(metrics.PhasePullReleases)()
+	defer pullService.events.StartPhase(metrics.PhasePullReleases)()
 	log.Debug("Pulling CodeQL bundles...")
 	relevantReleases, err := pullService.findRelevantReleases()
 	if err != nil {
@@ -192,7 +344,7 @@ func (pullService *pullService) pullReleases() error {
 
 	for index, releaseTag := range relevantReleases {
 		log.Debugf("Pulling CodeQL bundle %s (%d/%d)...", releaseTag, index+1, len(relevantReleases))
-		release, response, err := pullService.githubDotComClient.Repositories.GetReleaseByTag(pullService.ctx, sourceOwner, sourceRepository, releaseTag)
+		release, response, err := pullService.githubClient.Repositories.GetReleaseByTag(pullService.ctx, pullService.sourceOwner, pullService.sourceRepository, releaseTag)
 		if err != nil {
 			return githubapiutil.EnrichResponseError(response, err, "Error loading CodeQL release information.")
 		}
@@ -209,6 +361,12 @@ func (pullService *pullService) pullReleases() error {
 		if err != nil {
 			return errors.Wrap(err, "Error writing release metadata.")
 		}
+		if !pullService.sbom {
+			err := os.Remove(pullService.cacheDirectory.SBOMPath(releaseTag))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "Error removing outdated SBOM.")
+			}
+		}
 		assetsPath := pullService.cacheDirectory.AssetsPath(releaseTag)
 		err = os.MkdirAll(assetsPath, 0755)
 		if err != nil {
@@ -220,93 +378,258 @@ func (pullService *pullService) pullReleases() error {
 			downloadPathStat, err := os.Stat(downloadPath)
 			if err == nil && downloadPathStat.Size() == int64(asset.GetSize()) {
 				log.Debug("Asset is already in cache.")
-				continue
-			}
-			err = os.RemoveAll(downloadPath)
-			if err != nil {
-				return errors.Wrap(err, "Error removing existing cached asset.")
-			}
-			reader, redirectURL, err := pullService.githubDotComClient.Repositories.DownloadReleaseAsset(pullService.ctx, sourceOwner, sourceRepository, asset.GetID(), http.DefaultClient)
-			if err != nil {
-				return errors.Wrap(err, "Error downloading asset.")
-			}
-			if reader == nil {
-				response, err := http.Get(redirectURL)
+				metrics.Assets.Add(1, metrics.OperationPull, metrics.AssetCached)
+				pullService.events.Emit(event.Event{Type: event.AssetFinished, Release: releaseTag, Asset: asset.GetName(), Status: metrics.AssetCached, Bytes: int64(asset.GetSize()), Total: int64(asset.GetSize())})
+			} else {
+				pullService.events.Emit(event.Event{Type: event.AssetStarted, Release: releaseTag, Asset: asset.GetName(), Total: int64(asset.GetSize())})
+				err = pullService.retryPolicy.Do(pullService.ctx, "download asset "+asset.GetName(), func() error {
+					return pullService.downloadAsset(releaseTag, asset, downloadPath)
+				})
 				if err != nil {
-					return errors.Wrap(err, "Error downloading asset.")
-				}
-				if response.StatusCode >= 300 {
-					return errors.Wrapf(err, "Status code %d while downloading asset.", response.StatusCode)
+					return err
 				}
-				reader = response.Body
+				metrics.Assets.Add(1, metrics.OperationPull, metrics.AssetDownloaded)
+				pullService.events.Emit(event.Event{Type: event.AssetFinished, Release: releaseTag, Asset: asset.GetName(), Status: metrics.AssetDownloaded, Bytes: int64(asset.GetSize()), Total: int64(asset.GetSize())})
 			}
-			defer reader.Close()
-			downloadFile, err := os.Create(downloadPath)
-			if err != nil {
-				return errors.Wrap(err, "Error creating cached asset file.")
-			}
-			defer downloadFile.Close()
-			progressReader := &ioprogress.Reader{
-				Reader:   reader,
-				Size:     int64(asset.GetSize()),
-				DrawFunc: ioprogress.DrawTerminalf(os.Stderr, ioprogress.DrawTextFormatBytes),
-			}
-			_, err = io.Copy(downloadFile, progressReader)
-			if err != nil {
-				return errors.Wrap(err, "Error downloading asset.")
+			if pullService.attestations {
+				log.Debugf("Downloading attestations for asset %s...", asset.GetName())
+				err = pullService.downloadAttestation(releaseTag, asset.GetName())
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
 	return nil
 }
 
-func Pull(ctx context.Context, cacheDirectory cachedirectory.CacheDirectory, sourceToken string, sourceURL string) error {
-	err := cacheDirectory.CheckOrCreateVersionFile(true, version.Version())
-	if err != nil {
-		return err
+// Options configures a pull.
+type Options struct {
+	CacheDirectory cachedirectory.CacheDirectory
+	// SourceToken is normally only needed for GitHub Enterprise sources, or to avoid API rate limits.
+	SourceToken string
+	// SourceURL overrides the Git URL the Action is fetched from.
+	SourceURL string
+	// SourceEnterpriseURL is the URL of a GitHub Enterprise instance to pull from instead of GitHub.com.
+	SourceEnterpriseURL string
+	// SourceRepository defaults to `github/codeql-action`.
+	SourceRepository string
+	MaxRateLimitWait time.Duration
+	RetryPolicy      retry.Policy
+	// Pins maps branches and tags to the earlier upstream version they should be synced at.
+	Pins               map[string]string
+	TrustedKeys        []string
+	StrictSignatures   bool
+	ManifestSigningKey string
+	Attestations       bool
+	SBOM               bool
+	// ChangelogFormat is `markdown`, `html`, or empty to not write a changelog.
+	ChangelogFormat string
+	Events          event.Handler
+	// Progress defaults to reporting nothing.
+	Progress progress.Reporter
+}
+
+func newPullService(ctx context.Context, options Options) (*pullService, error) {
+	var token *oauth2.Token
+	if options.SourceToken != "" {
+		token = &oauth2.Token{AccessToken: options.SourceToken}
 	}
-	err = cacheDirectory.Lock()
-	if err != nil {
-		return err
+	httpClient := githubapiutil.NewHTTPClient(token, options.MaxRateLimitWait, options.RetryPolicy)
+
+	sourceRepository := options.SourceRepository
+	if sourceRepository == "" {
+		sourceRepository = defaultSourceRepository
+	}
+	sourceRepositorySplit := strings.Split(sourceRepository, "/")
+	if len(sourceRepositorySplit) != 2 {
+		return nil, fmt.Errorf(errorInvalidSourceRepository, sourceRepository)
+	}
+
+	var client *github.Client
+	sourceInstanceURL := githubDotComURL
+	if options.SourceEnterpriseURL != "" {
+		sourceInstanceURL = strings.TrimRight(options.SourceEnterpriseURL, "/")
+		var err error
+		client, _, err = githubapiutil.NewEnterpriseClient(ctx, sourceInstanceURL, httpClient)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		client = github.NewClient(httpClient)
 	}
 
-	var tokenClient *http.Client
-	if sourceToken != "" {
-		tokenSource := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: sourceToken},
-		)
-		tokenClient = oauth2.NewClient(ctx, tokenSource)
+	progressReporter := options.Progress
+	if progressReporter == nil {
+		progressReporter = progress.Silent()
 	}
 
+	sourceURL := options.SourceURL
 	if sourceURL == "" {
-		sourceURL = defaultSourceURL
+		sourceURL = sourceInstanceURL + "/" + sourceRepository + ".git"
+	}
+
+	return &pullService{
+		ctx:              ctx,
+		cacheDirectory:   options.CacheDirectory,
+		gitCloneURL:      sourceURL,
+		githubClient:     client,
+		sourceOwner:      sourceRepositorySplit[0],
+		sourceRepository: sourceRepositorySplit[1],
+		sourceToken:      options.SourceToken,
+		retryPolicy:      options.RetryPolicy,
+		pins:             options.Pins,
+		strictSignatures: options.StrictSignatures,
+		attestations:     options.Attestations,
+		sbom:             options.SBOM,
+		changelogFormat:  options.ChangelogFormat,
+		events:           event.Combine(progressReporter.Event, options.Events),
+		progress:         progressReporter,
+	}, nil
+}
+
+// Result describes what a pull left in the cache.
+type Result struct {
+	// BundleVersions are the CodeQL bundles that the synced branches and tags use.
+	BundleVersions []string `json:"bundle_versions"`
+	// References maps each synced branch and tag to the commit it is at in the cache, after pins are applied.
+	References map[string]string `json:"references"`
+}
+
+func (pullService *pullService) result() (*Result, error) {
+	releaseReferences, err := pullService.findReleaseReferences()
+	if err != nil {
+		return nil, err
+	}
+	result := Result{
+		BundleVersions: []string{},
+		References:     map[string]string{},
+	}
+	seen := map[string]bool{}
+	for _, releaseReference := range releaseReferences {
+		result.References[releaseReference.reference.String()] = releaseReference.commit.String()
+		if !seen[releaseReference.bundleVersion] {
+			seen[releaseReference.bundleVersion] = true
+			result.BundleVersions = append(result.BundleVersions, releaseReference.bundleVersion)
+		}
+	}
+	sort.Strings(result.BundleVersions)
+	return &result, nil
+}
+
+// Pull leaves the cache directory locked if it fails, so that a partial cache is not pushed. If it was interrupted by the context being cancelled, the lock records when, and the next pull resumes from where it stopped.
+func Pull(ctx context.Context, options Options) (*Result, error) {
+	result, err := pull(ctx, options)
+	if err != nil && ctx.Err() != nil {
+		markErr := options.CacheDirectory.MarkInterrupted(time.Now())
+		if markErr != nil {
+			log.Warn(markErr.Error())
+		}
+		log.Warn("The pull was interrupted. The cache directory will stay locked until it is pulled again, and the next pull will resume from where this one stopped.")
+	}
+	return result, err
+}
+
+func pull(ctx context.Context, options Options) (*Result, error) {
+	cacheDirectory := options.CacheDirectory
+	var err error
+
+	// The options are all checked before the cache is locked, so that a mistake in them does not leave a valid cache locked.
+	var keyring *signature.Keyring
+	if len(options.TrustedKeys) != 0 {
+		keyring, err = signature.LoadKeyring(options.TrustedKeys)
+		if err != nil {
+			return nil, err
+		}
+	} else if options.StrictSignatures {
+		return nil, usererrors.New(errorStrictSignaturesWithoutKeys)
+	}
+	if options.ChangelogFormat != "" {
+		err = changelog.ValidateFormat(options.ChangelogFormat)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	pullService := pullService{
-		ctx:                ctx,
-		cacheDirectory:     cacheDirectory,
-		gitCloneURL:        sourceURL,
-		githubDotComClient: github.NewClient(tokenClient),
-		sourceToken:        sourceToken,
+	var manifestSigner *signature.Signer
+	if options.ManifestSigningKey != "" {
+		manifestSigner, err = signature.LoadSigner(options.ManifestSigningKey)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	pullService, err := newPullService(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	pullService.keyring = keyring
+
+	err = cacheDirectory.CheckOrCreateVersionFile(true, version.Version())
+	if err != nil {
+		return nil, err
+	}
+	err = cacheDirectory.Lock()
+	if err != nil {
+		return nil, err
+	}
+
+	previousReferences := pullService.snapshotReferences()
 	err = pullService.pullGit(false)
+	if err != nil && ctx.Err() != nil {
+		// Don't throw away the cache just because the pull was interrupted.
+		return nil, err
+	}
 	if err != nil {
 		// If an error occurred updating the existing copy then try cloning fresh instead. An error is expected if the local cache does not yet exist, but even if it is corrupt in some way we can safely delete it and start again.
 		err := pullService.pullGit(true)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
+	err = pullService.recordUpstreamReferences()
+	if err != nil {
+		return nil, err
+	}
+	err = pullService.applyPins()
+	if err != nil {
+		return nil, err
+	}
+	err = pullService.verifySignatures()
+	if err != nil {
+		return nil, err
+	}
+	err = pullService.writeChangelog(previousReferences)
+	if err != nil {
+		return nil, err
+	}
 	err = pullService.pullReleases()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if options.SBOM {
+		err = pullService.generateSBOMs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = os.RemoveAll(cacheDirectory.PartialDownloadsPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "Error removing partial downloads.")
+	}
+	err = manifest.Write(cacheDirectory, manifestSigner)
+	if err != nil {
+		return nil, err
+	}
+	result, err := pullService.result()
+	if err != nil {
+		return nil, err
 	}
 
 	err = cacheDirectory.Unlock()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Info("Finished pulling the CodeQL Action repository and bundles!")
-	return nil
+	return result, nil
 }
@@ -2,11 +2,19 @@ package pull
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/event"
+	"github.com/github/codeql-action-sync/internal/progress"
+	"github.com/github/codeql-action-sync/internal/version"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/stretchr/testify/require"
@@ -48,19 +56,22 @@ var releaseSomeCodeQLVersionOnV1AndV2 = github.RepositoryRelease{
 
 func getTestPullService(t *testing.T, temporaryDirectory string, gitCloneURL string, githubURL string) pullService {
 	cacheDirectory := cachedirectory.NewCacheDirectory(temporaryDirectory)
-	var githubDotComClient *github.Client
+	var githubClient *github.Client
 	if githubURL != "" {
 		client, err := github.NewEnterpriseClient(githubURL+"/api/v3", githubURL+"/api/uploads", &http.Client{})
-		githubDotComClient = client
+		githubClient = client
 		require.NoError(t, err)
 	} else {
-		githubDotComClient = nil
+		githubClient = nil
 	}
 	return pullService{
-		ctx:                context.Background(),
-		cacheDirectory:     cacheDirectory,
-		gitCloneURL:        gitCloneURL,
-		githubDotComClient: githubDotComClient,
+		ctx:              context.Background(),
+		cacheDirectory:   cacheDirectory,
+		gitCloneURL:      gitCloneURL,
+		githubClient:     githubClient,
+		sourceOwner:      "github",
+		sourceRepository: "codeql-action",
+		progress:         progress.Silent(),
 	}
 }
 
@@ -184,9 +195,100 @@ func TestPullReleases(t *testing.T) {
 		test.ServeHTTPResponseFromString(t, releaseSomeCodeQLVersionOnV1AndV2Content, response)
 	}).Methods("GET").Headers("accept", "application/octet-stream")
 	pullService = getTestPullService(t, temporaryDirectory, initialActionRepository, githubURL)
+	finished := []event.Event{}
+	pullService.events = func(e event.Event) {
+		if e.Type == event.AssetFinished {
+			finished = append(finished, e)
+		}
+	}
 	err = pullService.pullReleases()
 	require.NoError(t, err)
 
 	test.RequireFileHasContent(t, releaseSomeCodeQLVersionOnMainContent, pullService.cacheDirectory.AssetPath("some-codeql-version-on-main", "codeql-bundle.tar.gz"))
 	test.RequireFileHasContent(t, releaseSomeCodeQLVersionOnV1AndV2Content, pullService.cacheDirectory.AssetPath("some-codeql-version-on-v1-and-v2", "codeql-bundle.tar.gz"))
+	require.ElementsMatch(t, []string{
+		"some-codeql-version-on-main codeql-bundle.tar.gz cached",
+		"some-codeql-version-on-v1-and-v2 codeql-bundle.tar.gz downloaded",
+	}, describeEvents(finished))
+}
+
+func describeEvents(events []event.Event) []string {
+	descriptions := []string{}
+	for _, e := range events {
+		descriptions = append(descriptions, fmt.Sprintf("%s %s %s", e.Release, e.Asset, e.Status))
+	}
+	return descriptions
+}
+
+func TestDownloadAssetResumesPartialDownload(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/releases/assets/1", func(response http.ResponseWriter, request *http.Request) {
+		http.Redirect(response, request, githubURL+"/download/codeql-bundle.tar.gz", http.StatusFound)
+	}).Methods("GET")
+	ranges := []string{}
+	githubTestServer.HandleFunc("/download/codeql-bundle.tar.gz", func(response http.ResponseWriter, request *http.Request) {
+		ranges = append(ranges, request.Header.Get("Range"))
+		http.ServeContent(response, request, "codeql-bundle.tar.gz", time.Time{}, strings.NewReader(releaseSomeCodeQLVersionOnMainContent))
+	}).Methods("GET")
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, githubURL)
+	asset := releaseSomeCodeQLVersionOnMain.Assets[0]
+	partialPath := pullService.cacheDirectory.PartialAssetPath("some-codeql-version-on-main", asset.GetID(), asset.GetName())
+	require.NoError(t, os.MkdirAll(filepath.Dir(partialPath), 0755))
+	require.NoError(t, ioutil.WriteFile(partialPath, []byte(releaseSomeCodeQLVersionOnMainContent[:10]), 0644))
+	downloadPath := pullService.cacheDirectory.AssetPath("some-codeql-version-on-main", asset.GetName())
+	require.NoError(t, os.MkdirAll(filepath.Dir(downloadPath), 0755))
+
+	err := pullService.downloadAsset("some-codeql-version-on-main", asset, downloadPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bytes=10-"}, ranges)
+	test.RequireFileHasContent(t, releaseSomeCodeQLVersionOnMainContent, downloadPath)
+	require.NoFileExists(t, partialPath)
+
+	// A partial download that is no shorter than the asset can't be resumed, so the whole asset is downloaded again.
+	require.NoError(t, ioutil.WriteFile(partialPath, []byte(releaseSomeCodeQLVersionOnMainContent+" Some nonsense."), 0644))
+	err = pullService.downloadAsset("some-codeql-version-on-main", asset, downloadPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bytes=10-", ""}, ranges)
+	test.RequireFileHasContent(t, releaseSomeCodeQLVersionOnMainContent, downloadPath)
+}
+
+func TestInterruptedPullKeepsCache(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, "")
+	err := pullService.cacheDirectory.CheckOrCreateVersionFile(true, version.Version())
+	require.NoError(t, err)
+	err = pullService.pullGit(true)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Pull(ctx, Options{
+		CacheDirectory: pullService.cacheDirectory,
+		SourceURL:      initialActionRepository,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorContains(t, pullService.cacheDirectory.CheckLock(), "was interrupted at")
+	// The existing cache was not thrown away, so the next pull can pick up from it.
+	test.CheckExpectedReferencesInRepository(t, pullService.cacheDirectory.GitPath(), []string{
+		"b9f01aa2c50f49898d4c7845a66be8824499fe9d refs/heads/main",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/v1",
+		"e529a54fad10a936308b2220e05f7f00757f8e7c refs/heads/v3",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/v2",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/heads/very-ignored-branch",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/tags/an-ignored-tag-too",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/a-ref-that-will-need-pruning",
+	})
+}
+
+func TestPullWithInvalidOptionsDoesNotLockCache(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	cacheDirectory := cachedirectory.NewCacheDirectory(temporaryDirectory)
+	_, err := Pull(context.Background(), Options{CacheDirectory: cacheDirectory, ChangelogFormat: "pdf"})
+	require.Error(t, err)
+	_, err = Pull(context.Background(), Options{CacheDirectory: cacheDirectory, StrictSignatures: true})
+	require.Error(t, err)
+	lockInfo, err := cacheDirectory.ReadLock()
+	require.NoError(t, err)
+	require.Nil(t, lockInfo)
 }
@@ -0,0 +1,170 @@
+package pull
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/github/codeql-action-sync/internal/attestation"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The SBOMs are CycloneDX documents (see https://cyclonedx.org/docs/1.5/json/). They deliberately have no timestamp or serial number, so that they only change when the release does.
+const cycloneDXSpecVersion = "1.5"
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                       `json:"type"`
+	BOMRef             string                       `json:"bom-ref"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version,omitempty"`
+	PackageURL         string                       `json:"purl,omitempty"`
+	Hashes             []cycloneDXHash              `json:"hashes,omitempty"`
+	Properties         []cycloneDXProperty          `json:"properties,omitempty"`
+	ExternalReferences []cycloneDXExternalReference `json:"externalReferences,omitempty"`
+}
+
+type cycloneDXTool struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXDocument struct {
+	BOMFormat   string `json:"bomFormat"`
+	SpecVersion string `json:"specVersion"`
+	Version     int    `json:"version"`
+	Metadata    struct {
+		Tools struct {
+			Components []cycloneDXTool `json:"components"`
+		} `json:"tools"`
+		Component cycloneDXComponent `json:"component"`
+	} `json:"metadata"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+func (pullService *pullService) generateSBOM(releaseTag string, releaseReferences []releaseReference) error {
+	releaseJSON, err := ioutil.ReadFile(pullService.cacheDirectory.MetadataPath(releaseTag))
+	if err != nil {
+		return errors.Wrap(err, "Error reading release metadata.")
+	}
+	release := github.RepositoryRelease{}
+	err = json.Unmarshal(releaseJSON, &release)
+	if err != nil {
+		return errors.Wrap(err, "Error parsing release metadata.")
+	}
+
+	document := cycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: cycloneDXSpecVersion,
+		Version:     1,
+		Components:  []cycloneDXComponent{},
+	}
+	document.Metadata.Tools.Components = []cycloneDXTool{{Type: "application", Name: "codeql-action-sync", Version: version.Version()}}
+	document.Metadata.Component = cycloneDXComponent{
+		Type:    "application",
+		BOMRef:  "release:" + releaseTag,
+		Name:    "codeql-bundle",
+		Version: releaseTag,
+	}
+	if release.GetHTMLURL() != "" {
+		document.Metadata.Component.ExternalReferences = []cycloneDXExternalReference{{Type: "distribution", URL: release.GetHTMLURL()}}
+	}
+
+	for _, asset := range release.Assets {
+		digest, err := attestation.DigestFile(pullService.cacheDirectory.AssetPath(releaseTag, asset.GetName()))
+		if err != nil {
+			return err
+		}
+		component := cycloneDXComponent{
+			Type:       "file",
+			BOMRef:     "asset:" + asset.GetName(),
+			Name:       asset.GetName(),
+			Hashes:     []cycloneDXHash{{Algorithm: "SHA-256", Content: digest}},
+			Properties: []cycloneDXProperty{{Name: "codeql-action-sync:size", Value: fmt.Sprint(asset.GetSize())}},
+		}
+		if asset.GetBrowserDownloadURL() != "" {
+			component.ExternalReferences = []cycloneDXExternalReference{{Type: "distribution", URL: asset.GetBrowserDownloadURL()}}
+		}
+		document.Components = append(document.Components, component)
+	}
+
+	// Each commit of the Action that uses this release is listed once, along with the references it was synced from.
+	commitReferences := map[string][]string{}
+	for _, releaseReference := range releaseReferences {
+		if releaseReference.bundleVersion == releaseTag {
+			commit := releaseReference.commit.String()
+			commitReferences[commit] = append(commitReferences[commit], releaseReference.reference.String())
+		}
+	}
+	commits := []string{}
+	for commit := range commitReferences {
+		commits = append(commits, commit)
+	}
+	sort.Strings(commits)
+	for _, commit := range commits {
+		references := commitReferences[commit]
+		sort.Strings(references)
+		component := cycloneDXComponent{
+			Type:       "application",
+			BOMRef:     "action:" + commit,
+			Name:       pullService.sourceOwner + "/" + pullService.sourceRepository,
+			Version:    commit,
+			PackageURL: fmt.Sprintf("pkg:github/%s/%s@%s", pullService.sourceOwner, pullService.sourceRepository, commit),
+			ExternalReferences: []cycloneDXExternalReference{
+				{Type: "vcs", URL: pullService.gitCloneURL},
+			},
+		}
+		for _, reference := range references {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "codeql-action-sync:ref", Value: reference})
+		}
+		document.Components = append(document.Components, component)
+	}
+
+	sbomJSON, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error converting SBOM to JSON.")
+	}
+	err = ioutil.WriteFile(pullService.cacheDirectory.SBOMPath(releaseTag), sbomJSON, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing SBOM.")
+	}
+	return nil
+}
+
+func (pullService *pullService) generateSBOMs() error {
+	log.Debug("Generating SBOMs for CodeQL bundles...")
+	releaseReferences, err := pullService.findReleaseReferences()
+	if err != nil {
+		return err
+	}
+	releases, err := pullService.findRelevantReleases()
+	if err != nil {
+		return err
+	}
+	for _, releaseTag := range releases {
+		err := pullService.generateSBOM(releaseTag, releaseReferences)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package pull
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSBOMs(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/releases/tags/some-codeql-version-on-main", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, releaseSomeCodeQLVersionOnMain, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/releases/assets/1", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromString(t, releaseSomeCodeQLVersionOnMainContent, response)
+	}).Methods("GET").Headers("accept", "application/octet-stream")
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/releases/tags/some-codeql-version-on-v1-and-v2", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, releaseSomeCodeQLVersionOnV1AndV2, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/github/codeql-action/releases/assets/2", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromString(t, releaseSomeCodeQLVersionOnV1AndV2Content, response)
+	}).Methods("GET").Headers("accept", "application/octet-stream")
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, githubURL)
+	pullService.sbom = true
+	err := pullService.pullGit(true)
+	require.NoError(t, err)
+	err = pullService.pullReleases()
+	require.NoError(t, err)
+	err = pullService.generateSBOMs()
+	require.NoError(t, err)
+
+	sbomJSON, err := ioutil.ReadFile(pullService.cacheDirectory.SBOMPath("some-codeql-version-on-v1-and-v2"))
+	require.NoError(t, err)
+	sbom := cycloneDXDocument{}
+	require.NoError(t, json.Unmarshal(sbomJSON, &sbom))
+	require.Equal(t, "CycloneDX", sbom.BOMFormat)
+	require.Equal(t, "some-codeql-version-on-v1-and-v2", sbom.Metadata.Component.Version)
+	require.Equal(t, []cycloneDXComponent{
+		{
+			Type:       "file",
+			BOMRef:     "asset:codeql-bundle.tar.gz",
+			Name:       "codeql-bundle.tar.gz",
+			Hashes:     []cycloneDXHash{{Algorithm: "SHA-256", Content: "f2867bc9818e9e652d48342278e7b2c68898061e23499e77da5732568ea10406"}},
+			Properties: []cycloneDXProperty{{Name: "codeql-action-sync:size", Value: "67"}},
+		},
+		{
+			Type:       "application",
+			BOMRef:     "action:26936381e619a01122ea33993e3cebc474496805",
+			Name:       "github/codeql-action",
+			Version:    "26936381e619a01122ea33993e3cebc474496805",
+			PackageURL: "pkg:github/github/codeql-action@26936381e619a01122ea33993e3cebc474496805",
+			Properties: []cycloneDXProperty{
+				{Name: "codeql-action-sync:ref", Value: "refs/heads/v1"},
+				{Name: "codeql-action-sync:ref", Value: "refs/tags/v2"},
+			},
+			ExternalReferences: []cycloneDXExternalReference{{Type: "vcs", URL: initialActionRepository}},
+		},
+	}, sbom.Components)
+
+	// Without `--sbom`, outdated SBOMs are removed on the next pull.
+	pullService.sbom = false
+	err = pullService.pullReleases()
+	require.NoError(t, err)
+	require.NoFileExists(t, pullService.cacheDirectory.SBOMPath("some-codeql-version-on-v1-and-v2"))
+}
@@ -0,0 +1,107 @@
+package pull
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const errorUnverifiedReferences = "The signatures on %s could not be verified against the trusted keys, so they have been removed from the cache and the cache directory has been left locked. Check the trusted keys, or re-run this command without `--strict-signatures` to cache them anyway."
+
+// verifyReference checks the signatures on a reference, returning a description of the problem if they could not be verified.
+func (pullService *pullService) verifyReference(localRepository *git.Repository, reference *plumbing.Reference) (string, error) {
+	tag, err := localRepository.TagObject(reference.Hash())
+	if err != nil && err != plumbing.ErrObjectNotFound {
+		return "", errors.Wrapf(err, "Error loading tag for reference %s.", reference.Name())
+	}
+	if err == nil {
+		signer, err := pullService.keyring.VerifyTag(tag)
+		if err != nil {
+			return fmt.Sprintf("the tag %s could not be verified because %s", tag.Hash.String(), err), nil
+		}
+		log.Debugf("The tag %s at %s is signed by %s.", tag.Hash.String(), reference.Name(), signer)
+	}
+
+	resolvedReference, err := localRepository.ResolveRevision(plumbing.Revision(reference.Name()))
+	if err != nil {
+		return "", errors.Wrapf(err, "Error resolving reference %s.", reference.Name())
+	}
+	commit, err := localRepository.CommitObject(*resolvedReference)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error loading commit %s for reference %s.", resolvedReference.String(), reference.Name())
+	}
+	signer, err := pullService.keyring.VerifyCommit(commit)
+	if err != nil {
+		return fmt.Sprintf("the commit %s could not be verified because %s", commit.Hash.String(), err), nil
+	}
+	log.Debugf("The commit %s at %s is signed by %s.", commit.Hash.String(), reference.Name(), signer)
+	return "", nil
+}
+
+// verifySignatures checks the signatures on the annotated tags and commits that every fetched branch and tag points to, since they are all pushed. With strict signatures, the branches and tags that could not be verified are removed from the cache, and the pull fails if any of them are synced branches or tags.
+func (pullService *pullService) verifySignatures() error {
+	if pullService.keyring == nil {
+		return nil
+	}
+	log.Debug("Verifying signatures...")
+	localRepository, err := git.PlainOpen(pullService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error opening Git repository cache.")
+	}
+	references, err := localRepository.References()
+	if err != nil {
+		return errors.Wrap(err, "Error reading references from Git repository cache.")
+	}
+	unverifiedReferences := []plumbing.ReferenceName{}
+	unverifiedSyncedReferences := []string{}
+	unverifiedOtherReferences := []string{}
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if !reference.Name().IsBranch() && !reference.Name().IsTag() {
+			return nil
+		}
+		problem, err := pullService.verifyReference(localRepository, reference)
+		if err != nil {
+			return err
+		}
+		synced := relevantReferences.MatchString(reference.Name().String())
+		if problem != "" {
+			unverifiedReferences = append(unverifiedReferences, reference.Name())
+			if synced {
+				log.Warnf("The signatures on %s could not be verified: %s.", reference.Name(), problem)
+				unverifiedSyncedReferences = append(unverifiedSyncedReferences, reference.Name().String())
+			} else {
+				log.Debugf("The signatures on %s could not be verified: %s.", reference.Name(), problem)
+				unverifiedOtherReferences = append(unverifiedOtherReferences, reference.Name().String())
+			}
+			return nil
+		}
+		if synced {
+			log.Infof("Verified the signatures on %s.", reference.Name())
+		}
+		return nil
+	})
+	references.Close()
+	if err != nil {
+		return err
+	}
+	if len(unverifiedOtherReferences) != 0 {
+		log.Warnf("The signatures on %d other branches and tags could not be verified: %s.", len(unverifiedOtherReferences), strings.Join(unverifiedOtherReferences, ", "))
+	}
+	if !pullService.strictSignatures {
+		return nil
+	}
+	for _, referenceName := range unverifiedReferences {
+		err = localRepository.Storer.RemoveReference(referenceName)
+		if err != nil {
+			return errors.Wrapf(err, "Error removing unverified reference %s.", referenceName)
+		}
+	}
+	if len(unverifiedSyncedReferences) != 0 {
+		return fmt.Errorf(errorUnverifiedReferences, strings.Join(unverifiedSyncedReferences, ", "))
+	}
+	return nil
+}
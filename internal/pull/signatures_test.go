@@ -0,0 +1,48 @@
+package pull
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/signature"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestVerifySignaturesOfUnsignedReferences(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	keyPath := path.Join(temporaryDirectory, "trusted-keys")
+	require.NoError(t, ioutil.WriteFile(keyPath, ssh.MarshalAuthorizedKey(sshPublicKey), 0644))
+	keyring, err := signature.LoadKeyring([]string{keyPath})
+	require.NoError(t, err)
+
+	pullService := getTestPullService(t, path.Join(temporaryDirectory, "cache"), initialActionRepository, "")
+	err = pullService.pullGit(true)
+	require.NoError(t, err)
+	pullService.keyring = keyring
+	err = pullService.verifySignatures()
+	require.NoError(t, err)
+	test.CheckExpectedReferencesInRepository(t, pullService.cacheDirectory.GitPath(), []string{
+		"b9f01aa2c50f49898d4c7845a66be8824499fe9d refs/heads/main",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/v1",
+		"e529a54fad10a936308b2220e05f7f00757f8e7c refs/heads/v3",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/v2",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/heads/very-ignored-branch",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/tags/an-ignored-tag-too",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/a-ref-that-will-need-pruning",
+	})
+
+	pullService.strictSignatures = true
+	err = pullService.verifySignatures()
+	require.EqualError(t, err, "The signatures on refs/heads/main, refs/heads/v1, refs/heads/v3, refs/tags/v2 could not be verified against the trusted keys, so they have been removed from the cache and the cache directory has been left locked. Check the trusted keys, or re-run this command without `--strict-signatures` to cache them anyway.")
+	// None of the branches and tags are signed, so they are all removed, including the ones that are not synced but would still be pushed.
+	test.CheckExpectedReferencesInRepository(t, pullService.cacheDirectory.GitPath(), []string{})
+}
@@ -0,0 +1,333 @@
+package pull
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/go-git/go-git/v5"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+)
+
+const StatusFormatTable = "table"
+const StatusFormatJSON = "json"
+
+const errorInvalidStatusFormat = "The status format %s is not valid. It should be either `table` or `json`."
+const errorNotACache = "The directory %s was not created by the CodeQL Action sync tool."
+
+type ReferenceStatus struct {
+	Name       string    `json:"name"`
+	SHA        string    `json:"sha"`
+	CommitDate time.Time `json:"commit_date"`
+	// Pin is set if the reference was pinned to an earlier upstream version.
+	Pin           string `json:"pin,omitempty"`
+	BundleVersion string `json:"bundle_version"`
+	// BundleComplete is whether every asset of the bundle the reference needs is in the cache.
+	BundleComplete bool `json:"bundle_complete"`
+}
+
+type AssetStatus struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	ExpectedSize int64  `json:"expected_size"`
+	// PartialSize is how much of an asset that is not complete has been downloaded so far.
+	PartialSize int64 `json:"partial_size,omitempty"`
+	Complete    bool  `json:"complete"`
+}
+
+type ReleaseStatus struct {
+	Tag string `json:"tag"`
+	// Missing is set if a reference needs the release, but it has not been pulled at all.
+	Missing  bool          `json:"missing,omitempty"`
+	Assets   []AssetStatus `json:"assets"`
+	Complete bool          `json:"complete"`
+	// Unused is set if no reference needs the release any more, so the next pull will not update it.
+	Unused bool `json:"unused,omitempty"`
+}
+
+// CacheStatus describes what is in a cache directory, so that it can be checked before it is carried to the destination.
+type CacheStatus struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// Compatible is whether the cache was created by this version of the sync tool, which it must be to be pushed.
+	Compatible bool                     `json:"compatible"`
+	Lock       *cachedirectory.LockInfo `json:"lock"`
+	References []ReferenceStatus        `json:"references"`
+	Releases   []ReleaseStatus          `json:"releases"`
+	DiskUsage  int64                    `json:"disk_usage"`
+}
+
+func ValidateStatusFormat(format string) error {
+	if format != StatusFormatTable && format != StatusFormatJSON {
+		return fmt.Errorf(errorInvalidStatusFormat, format)
+	}
+	return nil
+}
+
+// InspectCache only reads the cache directory, so it can be used on a cache that is locked or was created by another version of the sync tool.
+func InspectCache(cacheDirectory cachedirectory.CacheDirectory) (*CacheStatus, error) {
+	cacheVersion, err := cacheDirectory.ReadVersion()
+	if err != nil {
+		return nil, err
+	}
+	if cacheVersion == "" {
+		return nil, errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorNotACache, cacheDirectory.Path())
+	}
+	status := CacheStatus{
+		Path:       cacheDirectory.Path(),
+		Version:    cacheVersion,
+		Compatible: cacheVersion == version.Version(),
+		References: []ReferenceStatus{},
+		Releases:   []ReleaseStatus{},
+	}
+	status.Lock, err = cacheDirectory.ReadLock()
+	if err != nil {
+		return nil, err
+	}
+
+	releases := map[string]*ReleaseStatus{}
+	releasePathStats, err := ioutil.ReadDir(cacheDirectory.ReleasesPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Error reading releases from cache.")
+	}
+	for _, releasePathStat := range releasePathStats {
+		releaseStatus, err := inspectRelease(cacheDirectory, releasePathStat.Name())
+		if err != nil {
+			return nil, err
+		}
+		releaseStatus.Unused = true
+		releases[releaseStatus.Tag] = releaseStatus
+	}
+
+	// A pull can be interrupted before the Git repository is cloned, in which case there are no references yet.
+	if _, err := os.Stat(cacheDirectory.GitPath()); err == nil {
+		pullService := pullService{cacheDirectory: cacheDirectory}
+		releaseReferences, err := pullService.findReleaseReferences()
+		if err != nil {
+			return nil, err
+		}
+		pins, err := readPins(cacheDirectory)
+		if err != nil {
+			return nil, err
+		}
+		localRepository, err := git.PlainOpen(cacheDirectory.GitPath())
+		if err != nil {
+			return nil, errors.Wrap(err, "Error opening Git repository cache.")
+		}
+		for _, releaseReference := range releaseReferences {
+			commit, err := localRepository.CommitObject(releaseReference.commit)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error loading commit %s.", releaseReference.commit)
+			}
+			releaseStatus, ok := releases[releaseReference.bundleVersion]
+			if !ok {
+				releaseStatus = &ReleaseStatus{Tag: releaseReference.bundleVersion, Missing: true, Assets: []AssetStatus{}}
+				releases[releaseStatus.Tag] = releaseStatus
+			}
+			releaseStatus.Unused = false
+			status.References = append(status.References, ReferenceStatus{
+				Name:           releaseReference.reference.String(),
+				SHA:            releaseReference.commit.String(),
+				CommitDate:     commit.Committer.When.UTC(),
+				Pin:            pins[releaseReference.reference.String()].Pin,
+				BundleVersion:  releaseReference.bundleVersion,
+				BundleComplete: releaseStatus.Complete,
+			})
+		}
+	}
+	sort.Slice(status.References, func(i, j int) bool {
+		return status.References[i].Name < status.References[j].Name
+	})
+	for _, releaseStatus := range releases {
+		status.Releases = append(status.Releases, *releaseStatus)
+	}
+	sort.Slice(status.Releases, func(i, j int) bool {
+		return status.Releases[i].Tag < status.Releases[j].Tag
+	})
+
+	err = filepath.Walk(cacheDirectory.Path(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			status.DiskUsage += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error working out the disk usage of the cache.")
+	}
+	return &status, nil
+}
+
+func inspectRelease(cacheDirectory cachedirectory.CacheDirectory, releaseTag string) (*ReleaseStatus, error) {
+	releaseStatus := ReleaseStatus{Tag: releaseTag, Assets: []AssetStatus{}, Complete: true}
+	releaseJSON, err := ioutil.ReadFile(cacheDirectory.MetadataPath(releaseTag))
+	if os.IsNotExist(err) {
+		// The metadata is written before any assets are downloaded, so the release has not really been pulled.
+		releaseStatus.Missing = true
+		releaseStatus.Complete = false
+		return &releaseStatus, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading release metadata.")
+	}
+	release := github.RepositoryRelease{}
+	err = json.Unmarshal(releaseJSON, &release)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing release metadata.")
+	}
+	for _, asset := range release.Assets {
+		assetStatus := AssetStatus{Name: asset.GetName(), ExpectedSize: int64(asset.GetSize())}
+		if assetPathStat, err := os.Stat(cacheDirectory.AssetPath(releaseTag, asset.GetName())); err == nil {
+			assetStatus.Size = assetPathStat.Size()
+		}
+		assetStatus.Complete = assetStatus.Size == assetStatus.ExpectedSize
+		if !assetStatus.Complete {
+			releaseStatus.Complete = false
+			if partialPathStat, err := os.Stat(cacheDirectory.PartialAssetPath(releaseTag, asset.GetID(), asset.GetName())); err == nil {
+				assetStatus.PartialSize = partialPathStat.Size()
+			}
+		}
+		releaseStatus.Assets = append(releaseStatus.Assets, assetStatus)
+	}
+	return &releaseStatus, nil
+}
+
+func readPins(cacheDirectory cachedirectory.CacheDirectory) (map[string]pinnedReference, error) {
+	pins := map[string]pinnedReference{}
+	pinsJSON, err := ioutil.ReadFile(cacheDirectory.PinsPath())
+	if os.IsNotExist(err) {
+		return pins, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading pins.")
+	}
+	err = json.Unmarshal(pinsJSON, &pins)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing pins.")
+	}
+	return pins, nil
+}
+
+func formatBytes(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+func yesOrNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func (status *CacheStatus) lockDescription() string {
+	if status.Lock == nil {
+		return "no"
+	}
+	holder := []string{}
+	if status.Lock.User != "" {
+		holder = append(holder, status.Lock.User)
+	}
+	if status.Lock.Hostname != "" {
+		holder = append(holder, status.Lock.Hostname)
+	}
+	description := "yes"
+	if len(holder) != 0 {
+		description += ", by " + strings.Join(holder, "@")
+	}
+	if status.Lock.PID != 0 {
+		description += fmt.Sprintf(" (PID %d)", status.Lock.PID)
+	}
+	if !status.Lock.StartedAt.IsZero() {
+		description += ", since " + status.Lock.StartedAt.Format(time.RFC3339)
+	}
+	if status.Lock.InterruptedAt != nil {
+		description += ", interrupted at " + status.Lock.InterruptedAt.Format(time.RFC3339)
+	}
+	return description
+}
+
+func (status *CacheStatus) WriteTable(writer io.Writer) error {
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	versionDescription := status.Version
+	if !status.Compatible {
+		versionDescription += fmt.Sprintf(" (not %s, so it must be pulled again with this version before it can be pushed)", version.Version())
+	}
+	fmt.Fprintf(table, "Cache directory:\t%s\n", status.Path)
+	fmt.Fprintf(table, "Created by version:\t%s\n", versionDescription)
+	fmt.Fprintf(table, "Locked:\t%s\n", status.lockDescription())
+	fmt.Fprintf(table, "Disk usage:\t%s\n", formatBytes(status.DiskUsage))
+	fmt.Fprintln(table)
+
+	fmt.Fprintln(table, "REFERENCE\tCOMMIT\tCOMMIT DATE\tPIN\tBUNDLE\tBUNDLE COMPLETE")
+	for _, reference := range status.References {
+		pin := reference.Pin
+		if pin == "" {
+			pin = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", reference.Name, reference.SHA, reference.CommitDate.Format(time.RFC3339), pin, reference.BundleVersion, yesOrNo(reference.BundleComplete))
+	}
+	fmt.Fprintln(table)
+
+	fmt.Fprintln(table, "RELEASE\tASSET\tSIZE\tSTATUS")
+	for _, release := range status.Releases {
+		switch {
+		case release.Missing:
+			fmt.Fprintf(table, "%s\t-\t-\tnot pulled\n", release.Tag)
+		case len(release.Assets) == 0:
+			fmt.Fprintf(table, "%s\t-\t-\tno assets\n", release.Tag)
+		}
+		for _, asset := range release.Assets {
+			assetStatus := "complete"
+			if !asset.Complete {
+				if asset.PartialSize != 0 {
+					assetStatus = fmt.Sprintf("incomplete (%s downloaded)", formatBytes(asset.PartialSize))
+				} else if asset.Size != 0 {
+					assetStatus = fmt.Sprintf("incomplete (%s in cache)", formatBytes(asset.Size))
+				} else {
+					assetStatus = "missing"
+				}
+			}
+			if release.Unused {
+				assetStatus += ", not used by any reference"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", release.Tag, asset.Name, formatBytes(asset.ExpectedSize), assetStatus)
+		}
+	}
+	return table.Flush()
+}
+
+func (status *CacheStatus) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(status)
+}
+
+func (status *CacheStatus) Write(writer io.Writer, format string) error {
+	if format == StatusFormatJSON {
+		return status.WriteJSON(writer)
+	}
+	return status.WriteTable(writer)
+}
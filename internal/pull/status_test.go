@@ -0,0 +1,104 @@
+package pull
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/codeql-action-sync/test"
+)
+
+func writeTestRelease(t *testing.T, cacheDirectory cachedirectory.CacheDirectory, release github.RepositoryRelease, content string) {
+	err := os.MkdirAll(cacheDirectory.AssetsPath(release.GetTagName()), 0755)
+	require.NoError(t, err)
+	releaseJSON, err := json.Marshal(release)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(cacheDirectory.MetadataPath(release.GetTagName()), releaseJSON, 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(cacheDirectory.AssetPath(release.GetTagName(), release.Assets[0].GetName()), []byte(content), 0644)
+	require.NoError(t, err)
+}
+
+func TestInspectCache(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	pullService := getTestPullService(t, temporaryDirectory, initialActionRepository, "")
+	err := pullService.cacheDirectory.CheckOrCreateVersionFile(true, version.Version())
+	require.NoError(t, err)
+	err = pullService.pullGit(true)
+	require.NoError(t, err)
+	writeTestRelease(t, pullService.cacheDirectory, releaseSomeCodeQLVersionOnMain, releaseSomeCodeQLVersionOnMainContent)
+	writeTestRelease(t, pullService.cacheDirectory, releaseSomeCodeQLVersionOnV1AndV2, "")
+	err = os.Remove(pullService.cacheDirectory.AssetPath("some-codeql-version-on-v1-and-v2", "codeql-bundle.tar.gz"))
+	require.NoError(t, err)
+	err = os.MkdirAll(filepath.Dir(pullService.cacheDirectory.PartialAssetPath("some-codeql-version-on-v1-and-v2", 2, "codeql-bundle.tar.gz")), 0755)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(pullService.cacheDirectory.PartialAssetPath("some-codeql-version-on-v1-and-v2", 2, "codeql-bundle.tar.gz"), []byte("This isn't"), 0644)
+	require.NoError(t, err)
+	err = pullService.cacheDirectory.Lock()
+	require.NoError(t, err)
+
+	status, err := InspectCache(pullService.cacheDirectory)
+	require.NoError(t, err)
+	require.Equal(t, version.Version(), status.Version)
+	require.True(t, status.Compatible)
+	require.NotNil(t, status.Lock)
+	require.Equal(t, os.Getpid(), status.Lock.PID)
+	require.NotZero(t, status.DiskUsage)
+
+	references := []string{}
+	for _, reference := range status.References {
+		require.False(t, reference.CommitDate.IsZero())
+		references = append(references, reference.SHA+" "+reference.Name+" "+reference.BundleVersion)
+		require.Equal(t, reference.BundleVersion == "some-codeql-version-on-main", reference.BundleComplete)
+	}
+	require.Equal(t, []string{
+		"b9f01aa2c50f49898d4c7845a66be8824499fe9d refs/heads/main some-codeql-version-on-main",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/v1 some-codeql-version-on-v1-and-v2",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/v2 some-codeql-version-on-v1-and-v2",
+	}, references)
+
+	require.Equal(t, []ReleaseStatus{
+		{
+			Tag:      "some-codeql-version-on-main",
+			Assets:   []AssetStatus{{Name: "codeql-bundle.tar.gz", Size: int64(len(releaseSomeCodeQLVersionOnMainContent)), ExpectedSize: int64(len(releaseSomeCodeQLVersionOnMainContent)), Complete: true}},
+			Complete: true,
+		},
+		{
+			Tag:    "some-codeql-version-on-v1-and-v2",
+			Assets: []AssetStatus{{Name: "codeql-bundle.tar.gz", ExpectedSize: int64(len(releaseSomeCodeQLVersionOnV1AndV2Content)), PartialSize: int64(len("This isn't"))}},
+		},
+	}, status.Releases)
+
+	var table bytes.Buffer
+	err = status.Write(&table, StatusFormatTable)
+	require.NoError(t, err)
+	require.Contains(t, table.String(), "incomplete (10 B downloaded)")
+	var statusJSON bytes.Buffer
+	err = status.Write(&statusJSON, StatusFormatJSON)
+	require.NoError(t, err)
+	decodedStatus := CacheStatus{}
+	err = json.Unmarshal(statusJSON.Bytes(), &decodedStatus)
+	require.NoError(t, err)
+	require.Equal(t, status.References, decodedStatus.References)
+}
+
+func TestInspectCacheReturnsErrorIfNotACache(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	_, err := InspectCache(cachedirectory.NewCacheDirectory(temporaryDirectory))
+	require.ErrorIs(t, err, errorcategory.ErrCacheInvalid)
+}
+
+func TestValidateStatusFormat(t *testing.T) {
+	require.NoError(t, ValidateStatusFormat(StatusFormatTable))
+	require.NoError(t, ValidateStatusFormat(StatusFormatJSON))
+	require.Error(t, ValidateStatusFormat("yaml"))
+}
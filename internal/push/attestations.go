@@ -0,0 +1,83 @@
+package push
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/attestation"
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultAttestationRepository = "github/codeql-action"
+
+const errorUnverifiedAttestations = "The provenance of some CodeQL bundles could not be verified:\n%s"
+
+// AttestationSettings controls whether the provenance attestations of CodeQL bundles are checked before they are pushed.
+type AttestationSettings struct {
+	Policy string
+	// TrustedRoot is the path of a Sigstore trusted root file to use instead of the one bundled with the sync tool.
+	TrustedRoot string
+	// Repository is the repository whose GitHub Actions workflows are trusted to attest to the CodeQL bundles. It defaults to `github/codeql-action`.
+	Repository string
+	// SignerWorkflow is the workflow that must have signed the attestations, e.g. `github/codeql-action/.github/workflows/release.yml`. Any workflow in the repository is accepted if it is empty.
+	SignerWorkflow string
+}
+
+func verifyAttestations(cacheDirectory cachedirectory.CacheDirectory, settings AttestationSettings) error {
+	if settings.Policy == "" || settings.Policy == attestation.PolicySkip {
+		return nil
+	}
+	err := attestation.ValidatePolicy(settings.Policy)
+	if err != nil {
+		return err
+	}
+	var trustedRoots []attestation.TrustedRoot
+	if settings.TrustedRoot == "" {
+		trustedRoots, err = attestation.BundledTrustedRoot()
+	} else {
+		trustedRoots, err = attestation.LoadTrustedRoot(settings.TrustedRoot)
+	}
+	if err != nil {
+		return err
+	}
+	repository := settings.Repository
+	if repository == "" {
+		repository = defaultAttestationRepository
+	}
+	verifier := attestation.NewVerifier(trustedRoots, repository, settings.SignerWorkflow)
+
+	log.Debug("Verifying CodeQL bundle attestations...")
+	releasePathStats, err := ioutil.ReadDir(cacheDirectory.ReleasesPath())
+	if err != nil {
+		return errors.Wrap(err, "Error reading releases.")
+	}
+	problems := []string{}
+	for _, releasePathStat := range releasePathStats {
+		releaseTag := releasePathStat.Name()
+		assetPathStats, err := ioutil.ReadDir(cacheDirectory.AssetsPath(releaseTag))
+		if err != nil {
+			return errors.Wrap(err, "Error reading release assets.")
+		}
+		for _, assetPathStat := range assetPathStats {
+			assetName := assetPathStat.Name()
+			err := verifier.VerifyFile(cacheDirectory.AttestationPath(releaseTag, assetName), cacheDirectory.AssetPath(releaseTag, assetName))
+			if err != nil {
+				problem := fmt.Sprintf("The attestation of asset %s in release %s could not be verified because %s.", assetName, releaseTag, err)
+				if settings.Policy == attestation.PolicyWarn {
+					log.Warn(problem)
+				} else {
+					problems = append(problems, problem)
+				}
+				continue
+			}
+			log.Debugf("Verified the provenance of asset %s in release %s.", assetName, releaseTag)
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf(errorUnverifiedAttestations, strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package push
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/attestation"
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyAttestationsSkip(t *testing.T) {
+	cacheDirectory := cachedirectory.NewCacheDirectory("./push_test/action-cache-initial/")
+	require.NoError(t, verifyAttestations(cacheDirectory, AttestationSettings{Policy: attestation.PolicySkip}))
+}
+
+func TestVerifyAttestationsInvalidPolicy(t *testing.T) {
+	cacheDirectory := cachedirectory.NewCacheDirectory("./push_test/action-cache-initial/")
+	err := verifyAttestations(cacheDirectory, AttestationSettings{Policy: "sometimes"})
+	require.EqualError(t, err, "The attestation policy sometimes is not valid. It should be one of `skip`, `warn` or `verify`.")
+}
+
+func TestVerifyAttestationsMissing(t *testing.T) {
+	cacheDirectory := cachedirectory.NewCacheDirectory("./push_test/action-cache-initial/")
+	trustedRootPath := filepath.Join(test.CreateTemporaryDirectory(t), "trusted_root.json")
+	require.NoError(t, ioutil.WriteFile(trustedRootPath, []byte(`{"tlogs": [], "certificateAuthorities": []}`), 0644))
+	settings := AttestationSettings{Policy: attestation.PolicyVerify, TrustedRoot: trustedRootPath}
+	err := verifyAttestations(cacheDirectory, settings)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The attestation of asset bundle.bin in release codeql-bundle-20200101 could not be verified because there are no attestations for it.")
+
+	settings.Policy = attestation.PolicyWarn
+	require.NoError(t, verifyAttestations(cacheDirectory, settings))
+}
@@ -0,0 +1,177 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	log "github.com/sirupsen/logrus"
+)
+
+const errorCheckFailed = "The destination is not ready for the CodeQL Action to be pushed. Please fix the problems reported above and try again."
+
+// The categories of the problems that check reports, from the most to the least serious.
+var checkProblemCategories = []error{errorcategory.ErrAuth, errorcategory.ErrPermission, errorcategory.ErrConflict}
+
+type checkReport struct {
+	problemCategories map[error]bool
+}
+
+func (report *checkReport) ok(format string, args ...interface{}) {
+	log.Infof("[OK] "+format, args...)
+}
+
+func (report *checkReport) warning(format string, args ...interface{}) {
+	log.Warnf("[WARNING] "+format, args...)
+}
+
+func (report *checkReport) problem(category error, format string, args ...interface{}) {
+	report.problemCategories[category] = true
+	log.Errorf("[PROBLEM] "+format, args...)
+}
+
+// The error is in the category of the most serious problem reported, so that check exits with the same code as the push would.
+func (report *checkReport) err() error {
+	for _, category := range checkProblemCategories {
+		if report.problemCategories[category] {
+			return errorcategory.New(category, errorCheckFailed)
+		}
+	}
+	return nil
+}
+
+func (pushService *pushService) check() error {
+	report := checkReport{problemCategories: map[error]bool{}}
+
+	switch pushService.destinationType {
+	case DestinationTypeEnterpriseServer:
+		if pushService.enterpriseVersion != "" {
+			report.ok("The destination is GitHub Enterprise Server %s.", pushService.enterpriseVersion)
+		} else {
+			report.warning("The destination did not report a GitHub Enterprise version, so it may not be a GitHub Enterprise instance.")
+		}
+	default:
+		report.ok("The destination is %s.", pushService.destinationTypeDescription())
+	}
+
+	user, response, err := pushService.githubEnterpriseClient.Users.Get(pushService.ctx, "")
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusUnauthorized {
+			report.problem(errorcategory.ErrAuth, errorInvalidDestinationToken)
+			return report.err()
+		}
+		return githubapiutil.EnrichResponseError(response, err, "Error getting current user.")
+	}
+	report.ok("The destination token is valid and belongs to %s.", user.GetLogin())
+
+	minimumRepositoryScope, acceptableRepositoryScopes := pushService.repositoryScopes()
+	scopes := githubapiutil.Scopes(response)
+	if scopes == nil {
+		report.warning("The scopes of the destination token could not be determined.")
+	} else {
+		report.ok("The destination token has the scopes: %s.", strings.Join(scopes, ", "))
+		if !githubapiutil.HasAnyScope(response, acceptableRepositoryScopes...) {
+			report.problem(errorcategory.ErrPermission, "The destination token does not have the `%s` scope.", minimumRepositoryScope)
+		}
+		if !githubapiutil.HasAnyScope(response, "workflow") {
+			report.problem(errorcategory.ErrPermission, "The destination token does not have the `workflow` scope.")
+		}
+	}
+	siteAdmin := user.GetSiteAdmin() && githubapiutil.HasAnyScope(response, "site_admin")
+	if !pushService.supportsSiteAdministration() {
+		report.ok("Site administrator access is not required on %s, but the destination organization must already exist.", pushService.destinationTypeDescription())
+	} else if siteAdmin {
+		report.ok("The destination token has site administrator access.")
+	} else {
+		report.warning("The destination token does not have site administrator access (the user must be a site administrator and the token must have the `site_admin` scope), so organizations cannot be created and the Actions admin user cannot be impersonated.")
+	}
+
+	needsImpersonation := false
+	if pushService.destinationRepositoryOwner != user.GetLogin() {
+		_, response, err := pushService.githubEnterpriseClient.Organizations.Get(pushService.ctx, pushService.destinationRepositoryOwner)
+		if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+			return githubapiutil.EnrichResponseError(response, err, "Error checking if destination organization exists.")
+		}
+		if response.StatusCode == http.StatusNotFound {
+			if siteAdmin && pushService.supportsSiteAdministration() {
+				report.ok("The organization %s does not exist, but will be created.", pushService.destinationRepositoryOwner)
+			} else {
+				report.problem(errorcategory.ErrPermission, "The organization %s does not exist, and cannot be created without site administrator access.", pushService.destinationRepositoryOwner)
+			}
+		} else {
+			report.ok("The organization %s exists.", pushService.destinationRepositoryOwner)
+			isMember, response, err := pushService.githubEnterpriseClient.Organizations.IsMember(pushService.ctx, pushService.destinationRepositoryOwner, user.GetLogin())
+			if err != nil {
+				return githubapiutil.EnrichResponseError(response, err, "Failed to check membership of destination organization.")
+			}
+			if isMember {
+				report.ok("%s is a member of the organization %s.", user.GetLogin(), pushService.destinationRepositoryOwner)
+			} else if siteAdmin && pushService.supportsSiteAdministration() {
+				needsImpersonation = true
+				report.ok("%s is not a member of the organization %s, so the Actions admin user will be impersonated.", user.GetLogin(), pushService.destinationRepositoryOwner)
+			} else {
+				report.problem(errorcategory.ErrPermission, "%s is not a member of the organization %s.", user.GetLogin(), pushService.destinationRepositoryOwner)
+			}
+		}
+	}
+
+	if pushService.supportsSiteAdministration() {
+		err := pushService.checkActionsAdminUser(&report, siteAdmin, needsImpersonation)
+		if err != nil {
+			return err
+		}
+	}
+
+	repository, response, err := pushService.githubEnterpriseClient.Repositories.Get(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return githubapiutil.EnrichResponseError(response, err, "Error checking if destination repository exists.")
+	}
+	repositoryFullName := fmt.Sprintf("%s/%s", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+	if response.StatusCode == http.StatusNotFound {
+		report.ok("The repository %s does not exist, but will be created.", repositoryFullName)
+	} else if repository.GetHomepage() == repositoryHomepage {
+		report.ok("The repository %s exists and was created by the CodeQL Action sync tool.", repositoryFullName)
+	} else if pushService.force {
+		report.warning("The repository %s exists and was not created by the CodeQL Action sync tool, but will be replaced because `--force` was provided.", repositoryFullName)
+	} else {
+		report.problem(errorcategory.ErrConflict, errorAlreadyExists)
+	}
+
+	err = report.err()
+	if err != nil {
+		return err
+	}
+	log.Info("The destination is ready for the CodeQL Action to be pushed.")
+	return nil
+}
+
+func (pushService *pushService) checkActionsAdminUser(report *checkReport, siteAdmin bool, needsImpersonation bool) error {
+	_, response, err := pushService.githubEnterpriseClient.Users.Get(pushService.ctx, pushService.actionsAdminUser)
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return githubapiutil.EnrichResponseError(response, err, "Error checking if Actions admin user exists.")
+	}
+	if response.StatusCode == http.StatusNotFound {
+		if needsImpersonation {
+			report.problem(errorcategory.ErrPermission, "The Actions admin user %s does not exist.", pushService.actionsAdminUser)
+		} else {
+			report.warning("The Actions admin user %s does not exist.", pushService.actionsAdminUser)
+		}
+	} else if siteAdmin {
+		report.ok("The Actions admin user %s exists and can be impersonated.", pushService.actionsAdminUser)
+	} else {
+		report.warning("The Actions admin user %s exists, but cannot be impersonated without site administrator access.", pushService.actionsAdminUser)
+	}
+	return nil
+}
+
+// Check only uses the destination settings of the options.
+func Check(ctx context.Context, options Options) error {
+	pushService, err := newPushService(ctx, options)
+	if err != nil {
+		return err
+	}
+	return pushService.check()
+}
@@ -0,0 +1,86 @@
+package push
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckWhenReady(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.enterpriseVersion = "3.0.0"
+	pushService.actionsAdminUser = "actions-admin"
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("X-OAuth-Scopes", "repo, workflow, site_admin")
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("user"), SiteAdmin: github.Bool(true)}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/orgs/destination-repository-owner", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/users/actions-admin", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("actions-admin")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.Repository{Homepage: github.String(repositoryHomepage)}, response)
+	}).Methods("GET")
+	err := pushService.check()
+	require.NoError(t, err)
+}
+
+func TestCheckReportsProblems(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.actionsAdminUser = "actions-admin"
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("X-OAuth-Scopes", "read:org")
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("destination-repository-owner")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/users/actions-admin", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.Repository{}, response)
+	}).Methods("GET")
+	err := pushService.check()
+	require.EqualError(t, err, errorCheckFailed)
+	require.ErrorIs(t, err, errorcategory.ErrPermission)
+}
+
+func TestCheckReportsConflict(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.actionsAdminUser = "actions-admin"
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("X-OAuth-Scopes", "repo, workflow")
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("destination-repository-owner")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/users/actions-admin", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("actions-admin")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.Repository{}, response)
+	}).Methods("GET")
+	err := pushService.check()
+	require.EqualError(t, err, errorCheckFailed)
+	require.ErrorIs(t, err, errorcategory.ErrConflict)
+}
+
+func TestCheckWithInvalidToken(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusUnauthorized)
+	}).Methods("GET")
+	err := pushService.check()
+	require.EqualError(t, err, errorCheckFailed)
+	require.ErrorIs(t, err, errorcategory.ErrAuth)
+}
@@ -0,0 +1,170 @@
+package push
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/actionconfiguration"
+	"github.com/github/codeql-action-sync/internal/compatibility"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func (pushService *pushService) checkCompatibility() error {
+	pushService.skippedReferences = map[plumbing.ReferenceName]bool{}
+	enterpriseVersion := compatibility.ParseEnterpriseVersion(pushService.enterpriseVersion)
+	if enterpriseVersion == nil {
+		log.Debug("Not checking compatibility because the destination is not GitHub Enterprise Server.")
+		return nil
+	}
+	log.Debugf("Checking compatibility with GitHub Enterprise Server %s...", enterpriseVersion)
+
+	gitRepository, err := git.PlainOpen(pushService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error reading Git repository from cache.")
+	}
+	references, err := gitRepository.References()
+	if err != nil {
+		return errors.Wrap(err, "Error listing local references.")
+	}
+	defer references.Close()
+	incompatibleReferences := []plumbing.ReferenceName{}
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if !actionReferences.MatchString(reference.Name().String()) {
+			return nil
+		}
+		resolvedReference, err := gitRepository.ResolveRevision(plumbing.Revision(reference.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "Error resolving reference %s.", reference.Name())
+		}
+		commit, err := gitRepository.CommitObject(*resolvedReference)
+		if err != nil {
+			return errors.Wrapf(err, "Error loading commit %s for reference %s.", resolvedReference.String(), reference.Name())
+		}
+		actionMajorVersion, known, err := compatibility.ActionMajorVersion(commit, reference.Name())
+		if err != nil {
+			return err
+		}
+		if !known {
+			log.Debugf("Could not determine the CodeQL Action version at %s, so not checking its compatibility.", reference.Name())
+			return nil
+		}
+		minimumEnterpriseVersion, known := compatibility.MinimumEnterpriseVersion(actionMajorVersion)
+		if !known {
+			log.Warnf("The compatibility of version %d of the CodeQL Action (at %s) with GitHub Enterprise Server is not known. You may need a newer version of the sync tool.", actionMajorVersion, reference.Name())
+			return nil
+		}
+		if !enterpriseVersion.AtLeast(minimumEnterpriseVersion) {
+			log.Warnf("%s contains version %d of the CodeQL Action, which requires GitHub Enterprise Server %s or later, but the destination is running %s.", reference.Name(), actionMajorVersion, minimumEnterpriseVersion, enterpriseVersion)
+			incompatibleReferences = append(incompatibleReferences, reference.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(incompatibleReferences) != 0 {
+		switch pushService.incompatibleReferences {
+		case IncompatibleReferencesRefuse:
+			names := []string{}
+			for _, reference := range incompatibleReferences {
+				names = append(names, reference.String())
+			}
+			return errorcategory.Errorf(errorcategory.ErrConflict, errorIncompatibleReferences, enterpriseVersion, strings.Join(names, ", "))
+		case IncompatibleReferencesSkip:
+			for _, reference := range incompatibleReferences {
+				log.Warnf("Skipping %s because it is not compatible with the destination.", reference)
+				pushService.skippedReferences[reference] = true
+			}
+		}
+	}
+
+	if !compatibility.SupportsZstdBundles(*enterpriseVersion) {
+		return pushService.checkZstdBundles(gitRepository, *enterpriseVersion)
+	}
+	return nil
+}
+
+func (pushService *pushService) checkZstdBundles(gitRepository *git.Repository, enterpriseVersion compatibility.EnterpriseVersion) error {
+	releasePathStats, err := ioutil.ReadDir(pushService.cacheDirectory.ReleasesPath())
+	if err != nil {
+		return errors.Wrap(err, "Error reading releases.")
+	}
+	incompatibleReleases := []string{}
+	for _, releasePathStat := range releasePathStats {
+		assetPathStats, err := ioutil.ReadDir(pushService.cacheDirectory.AssetsPath(releasePathStat.Name()))
+		if err != nil {
+			return errors.Wrap(err, "Error reading release assets.")
+		}
+		assetNames := map[string]bool{}
+		for _, assetPathStat := range assetPathStats {
+			assetNames[assetPathStat.Name()] = true
+		}
+		incompatible := false
+		for _, assetPathStat := range assetPathStats {
+			assetName := assetPathStat.Name()
+			if filepath.Ext(assetName) != ".zst" {
+				continue
+			}
+			if !assetNames[strings.TrimSuffix(assetName, ".zst")+".gz"] {
+				log.Warnf("The CodeQL bundle %s in release %s is only available as a `.tar.zst` file, which runners on GitHub Enterprise Server %s may not be able to extract.", assetName, releasePathStat.Name(), enterpriseVersion)
+				incompatible = true
+			}
+		}
+		if incompatible {
+			incompatibleReleases = append(incompatibleReleases, releasePathStat.Name())
+		}
+	}
+
+	if len(incompatibleReleases) != 0 {
+		switch pushService.incompatibleReferences {
+		case IncompatibleReferencesRefuse:
+			return errorcategory.Errorf(errorcategory.ErrConflict, errorIncompatibleBundles, enterpriseVersion, strings.Join(incompatibleReleases, ", "))
+		case IncompatibleReferencesSkip:
+			skippedReleases := map[string]bool{}
+			for _, release := range incompatibleReleases {
+				log.Warnf("Skipping CodeQL bundle %s because it is not compatible with the destination.", release)
+				pushService.skippedReferences[plumbing.NewTagReferenceName(release)] = true
+				skippedReleases[release] = true
+			}
+			// Versions of the Action that use a skipped bundle would fail on the runners, so they are skipped too.
+			return pushService.skipReferencesUsingBundles(gitRepository, skippedReleases)
+		}
+	}
+	return nil
+}
+
+func (pushService *pushService) skipReferencesUsingBundles(gitRepository *git.Repository, releases map[string]bool) error {
+	references, err := gitRepository.References()
+	if err != nil {
+		return errors.Wrap(err, "Error listing local references.")
+	}
+	defer references.Close()
+	return references.ForEach(func(reference *plumbing.Reference) error {
+		if !actionReferences.MatchString(reference.Name().String()) || pushService.skippedReferences[reference.Name()] {
+			return nil
+		}
+		resolvedReference, err := gitRepository.ResolveRevision(plumbing.Revision(reference.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "Error resolving reference %s.", reference.Name())
+		}
+		commit, err := gitRepository.CommitObject(*resolvedReference)
+		if err != nil {
+			return errors.Wrapf(err, "Error loading commit %s for reference %s.", resolvedReference.String(), reference.Name())
+		}
+		bundleVersion, err := actionconfiguration.BundleVersion(commit)
+		if err != nil {
+			return errors.Wrapf(err, "Error finding the CodeQL bundle used by %s.", reference.Name())
+		}
+		if releases[bundleVersion] {
+			log.Warnf("Skipping %s because it uses the CodeQL bundle %s, which is not being pushed.", reference.Name(), bundleVersion)
+			pushService.skippedReferences[reference.Name()] = true
+		}
+		return nil
+	})
+}
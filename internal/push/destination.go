@@ -0,0 +1,113 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+)
+
+const DestinationTypeAuto = "auto"
+const DestinationTypeEnterpriseServer = "ghes"
+const DestinationTypeAegis = "ghae"
+const DestinationTypeDataResidency = "ghe.com"
+const DestinationTypeDotCom = "github.com"
+
+const dataResidencyDomainSuffix = ".ghe.com"
+const dotComHost = "github.com"
+const dotComAPIHost = "api.github.com"
+
+const errorInvalidDestinationType = "The destination type %s is not valid. It should be one of `auto`, `ghes`, `ghae`, `ghe.com` or `github.com`."
+
+func resolveDestinationType(destinationType string, destinationURL string) (string, error) {
+	switch destinationType {
+	case DestinationTypeEnterpriseServer, DestinationTypeAegis, DestinationTypeDataResidency, DestinationTypeDotCom:
+		return destinationType, nil
+	case DestinationTypeAuto, "":
+	default:
+		return "", fmt.Errorf(errorInvalidDestinationType, destinationType)
+	}
+	parsedURL, err := url.Parse(destinationURL)
+	if err != nil {
+		return "", errors.Wrap(err, "Error parsing destination URL.")
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	if host == dotComHost || host == dotComAPIHost {
+		return DestinationTypeDotCom, nil
+	}
+	if strings.HasSuffix(host, dataResidencyDomainSuffix) {
+		return DestinationTypeDataResidency, nil
+	}
+	// We can't tell GitHub Enterprise Server and GitHub AE apart until we've asked the server.
+	return DestinationTypeAuto, nil
+}
+
+// newDestinationClient creates a client for the destination and returns it along with the resolved destination type and the reported GitHub Enterprise version, if any.
+func newDestinationClient(ctx context.Context, destinationType string, destinationURL string, httpClient *http.Client) (*github.Client, string, string, error) {
+	destinationType, err := resolveDestinationType(destinationType, destinationURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+	switch destinationType {
+	case DestinationTypeDotCom:
+		return github.NewClient(httpClient), destinationType, "", nil
+	case DestinationTypeDataResidency:
+		client, err := githubapiutil.NewDataResidencyClient(destinationURL, httpClient)
+		return client, destinationType, "", err
+	}
+	client, rootResponse, err := githubapiutil.NewEnterpriseClient(ctx, destinationURL, httpClient)
+	if err != nil {
+		return nil, "", "", err
+	}
+	enterpriseVersion := rootResponse.Header.Get(enterpriseVersionHeaderKey)
+	if destinationType == DestinationTypeAuto {
+		destinationType = DestinationTypeEnterpriseServer
+		if enterpriseVersion == enterpriseAegisVersionHeaderValue {
+			destinationType = DestinationTypeAegis
+		}
+	}
+	return client, destinationType, enterpriseVersion, nil
+}
+
+func (pushService *pushService) destinationTypeDescription() string {
+	switch pushService.destinationType {
+	case DestinationTypeAegis:
+		return "GitHub AE"
+	case DestinationTypeDataResidency:
+		return "GitHub Enterprise Cloud with data residency"
+	case DestinationTypeDotCom:
+		return "GitHub.com"
+	default:
+		return "GitHub Enterprise Server"
+	}
+}
+
+// Only GitHub Enterprise Server and GitHub AE have site administrators, who can create organizations and impersonate other users.
+func (pushService *pushService) supportsSiteAdministration() bool {
+	return pushService.destinationType != DestinationTypeDataResidency && pushService.destinationType != DestinationTypeDotCom
+}
+
+// By default on GitHub Enterprise Server the Action is made public so that every repository can use it. Elsewhere public repositories are either unavailable or would expose the Action to the world, so it is made internal instead.
+func (pushService *pushService) repositoryVisibility() string {
+	if pushService.repositorySettings.Visibility != "" {
+		return pushService.repositorySettings.Visibility
+	}
+	switch pushService.destinationType {
+	case DestinationTypeAegis, DestinationTypeDataResidency, DestinationTypeDotCom:
+		return VisibilityInternal
+	default:
+		return VisibilityPublic
+	}
+}
+
+func (pushService *pushService) repositoryScopes() (string, []string) {
+	if pushService.repositoryVisibility() != VisibilityPublic {
+		return "repo", []string{"repo"}
+	}
+	return "public_repo", []string{"public_repo", "repo"}
+}
@@ -0,0 +1,76 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDestinationType(t *testing.T) {
+	for destinationURL, expectedDestinationType := range map[string]string{
+		"https://github.com":            DestinationTypeDotCom,
+		"https://api.github.com/":       DestinationTypeDotCom,
+		"https://octocorp.ghe.com":      DestinationTypeDataResidency,
+		"https://api.octocorp.ghe.com/": DestinationTypeDataResidency,
+		"https://github.example.com":    DestinationTypeAuto,
+	} {
+		destinationType, err := resolveDestinationType(DestinationTypeAuto, destinationURL)
+		require.NoError(t, err)
+		require.Equal(t, expectedDestinationType, destinationType, destinationURL)
+	}
+
+	destinationType, err := resolveDestinationType(DestinationTypeEnterpriseServer, "https://octocorp.ghe.com")
+	require.NoError(t, err)
+	require.Equal(t, DestinationTypeEnterpriseServer, destinationType)
+
+	_, err = resolveDestinationType("gitlab", "https://github.example.com")
+	require.EqualError(t, err, fmt.Sprintf(errorInvalidDestinationType, "gitlab"))
+}
+
+func TestCreateRepositoryOnDataResidencyRequiresExistingOrganization(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.destinationType = DestinationTypeDataResidency
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("user")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/orgs/destination-repository-owner", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	_, err := pushService.createRepository()
+	require.EqualError(t, err, fmt.Sprintf(errorOrganizationDoesNotExist, "destination-repository-owner", "GitHub Enterprise Cloud with data residency"))
+}
+
+func TestCreateRepositoryOnDataResidencyIsInternalWithoutImpersonation(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.destinationType = DestinationTypeDataResidency
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("user")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/orgs/destination-repository-owner", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.Organization{}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/orgs/destination-repository-owner/repos", func(response http.ResponseWriter, request *http.Request) {
+		body, err := ioutil.ReadAll(request.Body)
+		require.NoError(t, err)
+		var repository github.Repository
+		err = json.Unmarshal(body, &repository)
+		require.NoError(t, err)
+		require.Equal(t, "internal", repository.GetVisibility())
+		test.ServeHTTPResponseFromObject(t, repository, response)
+	}).Methods("POST")
+	_, err := pushService.createRepository()
+	require.NoError(t, err)
+}
@@ -0,0 +1,186 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const DriftedReferencesWarn = "warn"
+const DriftedReferencesRefuse = "refuse"
+const DriftedReferencesSkip = "skip"
+const DriftedReferencesBackup = "backup"
+
+const errorInvalidDriftedReferences = "The drifted references policy %s is not valid. It should be one of `warn`, `refuse`, `skip` or `backup`."
+const errorDriftedReferences = "The destination has changes that are not in the upstream CodeQL Action at %s. Re-run this command with `--drifted-refs backup` to keep a copy of them, or `--drifted-refs warn` to overwrite them."
+
+// Backups of drifted references are kept under this prefix. They are never overwritten or deleted by the sync tool.
+const backupReferencePrefix = "refs/sync-backup/"
+
+func validateDriftedReferences(driftedReferences string) error {
+	switch driftedReferences {
+	case DriftedReferencesWarn, DriftedReferencesRefuse, DriftedReferencesSkip, DriftedReferencesBackup:
+		return nil
+	default:
+		return fmt.Errorf(errorInvalidDriftedReferences, driftedReferences)
+	}
+}
+
+// peelToCommit returns the commit a hash refers to, following annotated tags. It returns nil if the object is not in the local repository or is not a commit.
+func peelToCommit(gitRepository *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	gitObject, err := gitRepository.Object(plumbing.AnyObject, hash)
+	if err == plumbing.ErrObjectNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading object %s.", hash.String())
+	}
+	switch gitObject := gitObject.(type) {
+	case *object.Commit:
+		return gitObject, nil
+	case *object.Tag:
+		commit, err := gitObject.Commit()
+		if err == object.ErrUnsupportedObject {
+			return nil, nil
+		}
+		return commit, err
+	default:
+		return nil, nil
+	}
+}
+
+// readPinnedUpstreams returns the upstream commit of each reference that was pinned to an earlier version when the cache was pulled.
+func (pushService *pushService) readPinnedUpstreams() (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	pinnedUpstreams := map[plumbing.ReferenceName]plumbing.Hash{}
+	pinsJSON, err := ioutil.ReadFile(pushService.cacheDirectory.PinsPath())
+	if os.IsNotExist(err) {
+		return pinnedUpstreams, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading pins.")
+	}
+	pins := map[string]struct {
+		Upstream string `json:"upstream"`
+	}{}
+	err = json.Unmarshal(pinsJSON, &pins)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing pins.")
+	}
+	for referenceName, pin := range pins {
+		pinnedUpstreams[plumbing.ReferenceName(referenceName)] = plumbing.NewHash(pin.Upstream)
+	}
+	return pinnedUpstreams, nil
+}
+
+func isAncestorOf(gitRepository *git.Repository, commit *object.Commit, hash plumbing.Hash) (bool, error) {
+	otherCommit, err := peelToCommit(gitRepository, hash)
+	if err != nil || otherCommit == nil {
+		return false, err
+	}
+	return commit.IsAncestor(otherCommit)
+}
+
+// hasDrifted reports whether the destination has a version of a reference that the upstream version does not contain, i.e. someone has pushed to the destination directly.
+// If the reference is pinned, the destination may also have any version up to the upstream tip at the time the cache was pulled (e.g. if the pin has been moved back).
+func hasDrifted(gitRepository *git.Repository, remoteReference *plumbing.Reference, pinnedUpstream *plumbing.Hash) (bool, error) {
+	remoteCommit, err := peelToCommit(gitRepository, remoteReference.Hash())
+	if err != nil {
+		return false, err
+	}
+	if remoteCommit == nil {
+		// We've never seen this object upstream, so it must have been pushed to the destination.
+		return true, nil
+	}
+	localReference, err := gitRepository.Reference(remoteReference.Name(), true)
+	if err == plumbing.ErrReferenceNotFound {
+		// The reference has been deleted upstream, and the destination only has commits we know about.
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "Error finding local reference %s.", remoteReference.Name())
+	}
+	if localReference.Hash() == remoteReference.Hash() {
+		return false, nil
+	}
+	isAncestor, err := isAncestorOf(gitRepository, remoteCommit, localReference.Hash())
+	if err == nil && !isAncestor && pinnedUpstream != nil {
+		isAncestor, err = isAncestorOf(gitRepository, remoteCommit, *pinnedUpstream)
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "Error comparing %s on the destination with the upstream version.", remoteReference.Name())
+	}
+	return !isAncestor, nil
+}
+
+func (pushService *pushService) detectDrift(gitRepository *git.Repository, remoteReferences []*plumbing.Reference) error {
+	if pushService.skippedReferences == nil {
+		pushService.skippedReferences = map[plumbing.ReferenceName]bool{}
+	}
+	pinnedUpstreams, err := pushService.readPinnedUpstreams()
+	if err != nil {
+		return err
+	}
+	driftedReferences := []string{}
+	for _, remoteReference := range remoteReferences {
+		if remoteReference.Type() != plumbing.HashReference || !strings.HasPrefix(remoteReference.Name().String(), "refs/") || strings.HasPrefix(remoteReference.Name().String(), backupReferencePrefix) {
+			continue
+		}
+		var pinnedUpstream *plumbing.Hash
+		if hash, pinned := pinnedUpstreams[remoteReference.Name()]; pinned {
+			pinnedUpstream = &hash
+		}
+		drifted, err := hasDrifted(gitRepository, remoteReference, pinnedUpstream)
+		if err != nil {
+			return err
+		}
+		if !drifted {
+			continue
+		}
+		log.Warnf("%s on the destination is at %s, which is not part of the upstream history of the CodeQL Action. Someone may have pushed to the destination directly.", remoteReference.Name(), remoteReference.Hash().String())
+		driftedReferences = append(driftedReferences, remoteReference.Name().String())
+		switch pushService.driftedReferences {
+		case DriftedReferencesSkip:
+			log.Warnf("Skipping %s so that the changes on the destination are kept.", remoteReference.Name())
+			pushService.skippedReferences[remoteReference.Name()] = true
+		case DriftedReferencesBackup:
+			err := pushService.backupReference(remoteReference)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(driftedReferences) != 0 && pushService.driftedReferences == DriftedReferencesRefuse {
+		return errorcategory.Errorf(errorcategory.ErrConflict, errorDriftedReferences, strings.Join(driftedReferences, ", "))
+	}
+	return nil
+}
+
+func (pushService *pushService) backupReference(remoteReference *plumbing.Reference) error {
+	backupReferenceName := fmt.Sprintf("%s%s-%s", backupReferencePrefix, strings.TrimPrefix(remoteReference.Name().String(), "refs/"), remoteReference.Hash().String()[:7])
+	log.Warnf("Backing up %s to %s before overwriting it.", remoteReference.Name(), backupReferenceName)
+	// The drifted commits only exist on the destination, so the backup reference has to be created there rather than pushed.
+	_, response, err := pushService.githubEnterpriseClient.Git.CreateRef(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, &github.Reference{
+		Ref:    github.String(backupReferenceName),
+		Object: &github.GitObject{SHA: github.String(remoteReference.Hash().String())},
+	})
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusUnprocessableEntity {
+			log.Debugf("%s already exists.", backupReferenceName)
+			return nil
+		}
+		return githubapiutil.EnrichResponseError(response, err, fmt.Sprintf("Error backing up %s.", remoteReference.Name()))
+	}
+	return nil
+}
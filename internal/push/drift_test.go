@@ -0,0 +1,98 @@
+package push
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/require"
+)
+
+const upstreamV1 = "26936381e619a01122ea33993e3cebc474496805"
+
+// pushDriftedDestination creates a destination that has had the cache pushed to it, and then had a commit pushed directly to `v1`.
+func pushDriftedDestination(t *testing.T) (string, string) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	destinationPath := path.Join(temporaryDirectory, "target")
+	destinationRepository, err := git.PlainInit(destinationPath, true)
+	require.NoError(t, err)
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", "")
+	repository := github.Repository{
+		CloneURL: github.String(destinationPath),
+	}
+	require.NoError(t, pushService.pushGit(&repository, true))
+	require.NoError(t, pushService.pushGit(&repository, false))
+
+	parent, err := destinationRepository.CommitObject(plumbing.NewHash(upstreamV1))
+	require.NoError(t, err)
+	signature := object.Signature{Name: "Someone", Email: "someone@example.com", When: time.Unix(1600000000, 0)}
+	driftedCommit := object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      "A change that was pushed to the destination directly.",
+		TreeHash:     parent.TreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+	encodedObject := destinationRepository.Storer.NewEncodedObject()
+	require.NoError(t, driftedCommit.Encode(encodedObject))
+	driftedHash, err := destinationRepository.Storer.SetEncodedObject(encodedObject)
+	require.NoError(t, err)
+	require.NoError(t, destinationRepository.Storer.SetReference(plumbing.NewHashReference("refs/heads/v1", driftedHash)))
+	return destinationPath, driftedHash.String()
+}
+
+func TestPushGitRefusesDriftedReferences(t *testing.T) {
+	destinationPath, _ := pushDriftedDestination(t)
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", "")
+	pushService.driftedReferences = DriftedReferencesRefuse
+	err := pushService.pushGit(&github.Repository{CloneURL: github.String(destinationPath)}, true)
+	require.EqualError(t, err, "The destination has changes that are not in the upstream CodeQL Action at refs/heads/v1. Re-run this command with `--drifted-refs backup` to keep a copy of them, or `--drifted-refs warn` to overwrite them.")
+}
+
+func TestPushGitSkipsDriftedReferences(t *testing.T) {
+	destinationPath, driftedHash := pushDriftedDestination(t)
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", "")
+	pushService.driftedReferences = DriftedReferencesSkip
+	repository := github.Repository{CloneURL: github.String(destinationPath)}
+	require.NoError(t, pushService.pushGit(&repository, true))
+	require.NoError(t, pushService.pushGit(&repository, false))
+	destinationRepository, err := git.PlainOpen(destinationPath)
+	require.NoError(t, err)
+	reference, err := destinationRepository.Reference("refs/heads/v1", false)
+	require.NoError(t, err)
+	require.Equal(t, driftedHash, reference.Hash().String())
+}
+
+func TestPushGitBacksUpDriftedReferences(t *testing.T) {
+	destinationPath, driftedHash := pushDriftedDestination(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", githubEnterpriseURL)
+	pushService.driftedReferences = DriftedReferencesBackup
+	var backupReference github.Reference
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/git/refs", func(response http.ResponseWriter, request *http.Request) {
+		body := struct {
+			Ref string
+			SHA string
+		}{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		backupReference = github.Reference{Ref: github.String(body.Ref), Object: &github.GitObject{SHA: github.String(body.SHA)}}
+		test.ServeHTTPResponseFromObject(t, backupReference, response)
+	}).Methods("POST")
+	repository := github.Repository{CloneURL: github.String(destinationPath)}
+	require.NoError(t, pushService.pushGit(&repository, true))
+	require.NoError(t, pushService.pushGit(&repository, false))
+	require.Equal(t, "refs/sync-backup/heads/v1-"+driftedHash[:7], backupReference.GetRef())
+	require.Equal(t, driftedHash, backupReference.GetObject().GetSHA())
+	destinationRepository, err := git.PlainOpen(destinationPath)
+	require.NoError(t, err)
+	reference, err := destinationRepository.Reference("refs/heads/v1", false)
+	require.NoError(t, err)
+	require.Equal(t, upstreamV1, reference.Hash().String())
+}
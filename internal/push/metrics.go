@@ -0,0 +1,64 @@
+package push
+
+import (
+	"github.com/github/codeql-action-sync/internal/gitutil"
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// recordReferenceMetrics records which commit each Action reference is at upstream and on the destination, so that alerts can be raised when the destination falls behind.
+func (pushService *pushService) recordReferenceMetrics() error {
+	gitRepository, err := git.PlainOpen(pushService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error reading Git repository from cache.")
+	}
+	pinnedUpstreams, err := pushService.readPinnedUpstreams()
+	if err != nil {
+		return err
+	}
+	references, err := gitRepository.References()
+	if err != nil {
+		return errors.Wrap(err, "Error listing local references.")
+	}
+	defer references.Close()
+	metrics.UpstreamReference.Reset()
+	metrics.DestinationReference.Reset()
+	metrics.ReferenceBehindUpstream.Reset()
+	metrics.UpstreamCommitTime.Reset()
+	metrics.DestinationCommitTime.Reset()
+	return references.ForEach(func(reference *plumbing.Reference) error {
+		if !actionReferences.MatchString(reference.Name().String()) {
+			return nil
+		}
+		upstream := reference.Hash()
+		if pinnedUpstream, ok := pinnedUpstreams[reference.Name()]; ok {
+			upstream = pinnedUpstream
+		}
+		metrics.UpstreamReference.Set(1, reference.Name().String(), upstream.String())
+		upstreamCommitTime, err := gitutil.CommitTime(gitRepository, upstream)
+		if err != nil {
+			return err
+		}
+		metrics.UpstreamCommitTime.Set(upstreamCommitTime, reference.Name().String())
+		if pushService.skippedReferences[reference.Name()] {
+			metrics.ReferenceBehindUpstream.Set(1, reference.Name().String())
+			return nil
+		}
+		metrics.DestinationReference.Set(1, reference.Name().String(), reference.Hash().String())
+		destinationCommitTime, err := gitutil.CommitTime(gitRepository, reference.Hash())
+		if err != nil {
+			return err
+		}
+		metrics.DestinationCommitTime.Set(destinationCommitTime, reference.Name().String())
+		behind := 0.0
+		if reference.Hash() != upstream {
+			behind = 1
+		}
+		metrics.ReferenceBehindUpstream.Set(behind, reference.Name().String())
+		return nil
+	})
+}
+
+// commitTime returns when a commit, or the commit an annotated tag points to, was committed, as a Unix timestamp.
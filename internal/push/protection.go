@@ -0,0 +1,215 @@
+package push
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/github/codeql-action-sync/internal/compatibility"
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const branchRulesetName = "CodeQL Action sync (branches)"
+const tagRulesetName = "CodeQL Action sync (tags)"
+const protectedTagPattern = "v*"
+
+// The built-in repository admin role. Rulesets can only be bypassed by roles, teams and apps, not by individual users, so this is the narrowest actor that includes the user the sync tool pushes as. The sync tool creates the destination repository, so that user is always an admin.
+const repositoryAdminRoleID = 5
+
+// The go-github library predates repository rulesets, so we define the parts of the API we need ourselves.
+type ruleset struct {
+	ID           int64                `json:"id,omitempty"`
+	Name         string               `json:"name"`
+	Target       string               `json:"target"`
+	Enforcement  string               `json:"enforcement"`
+	BypassActors []rulesetBypassActor `json:"bypass_actors"`
+	Conditions   rulesetConditions    `json:"conditions"`
+	Rules        []rulesetRule        `json:"rules"`
+}
+
+type rulesetBypassActor struct {
+	ActorID    int64  `json:"actor_id"`
+	ActorType  string `json:"actor_type"`
+	BypassMode string `json:"bypass_mode"`
+}
+
+type rulesetConditions struct {
+	RefName rulesetRefNameCondition `json:"ref_name"`
+}
+
+type rulesetRefNameCondition struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+type rulesetRule struct {
+	Type string `json:"type"`
+}
+
+type tagProtection struct {
+	ID      int64  `json:"id,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
+func newProtectionRuleset(name string, target string, include []string) ruleset {
+	return ruleset{
+		Name:        name,
+		Target:      target,
+		Enforcement: "active",
+		BypassActors: []rulesetBypassActor{
+			{ActorID: repositoryAdminRoleID, ActorType: "RepositoryRole", BypassMode: "always"},
+		},
+		Conditions: rulesetConditions{RefName: rulesetRefNameCondition{Include: include, Exclude: []string{}}},
+		Rules: []rulesetRule{
+			{Type: "creation"},
+			{Type: "update"},
+			{Type: "deletion"},
+			{Type: "non_fast_forward"},
+		},
+	}
+}
+
+func (pushService *pushService) supportsRulesets() bool {
+	switch pushService.destinationType {
+	case DestinationTypeDataResidency, DestinationTypeDotCom:
+		return true
+	case DestinationTypeAegis:
+		return false
+	}
+	enterpriseVersion := compatibility.ParseEnterpriseVersion(pushService.enterpriseVersion)
+	return enterpriseVersion != nil && compatibility.SupportsRulesets(*enterpriseVersion)
+}
+
+func (pushService *pushService) protectReferences() error {
+	if !pushService.protectRefs {
+		return nil
+	}
+	if pushService.supportsRulesets() {
+		log.Debug("Protecting mirrored references with repository rulesets...")
+		log.Warnf("Repository rulesets cannot be bypassed by an individual user, so every administrator of %s/%s, not only the user the sync tool pushes as, will be able to create, move and delete the protected branches and tags.", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+		err := pushService.createOrUpdateRuleset(newProtectionRuleset(branchRulesetName, "branch", []string{"refs/heads/main", "refs/heads/v*"}))
+		if err != nil {
+			return err
+		}
+		return pushService.createOrUpdateRuleset(newProtectionRuleset(tagRulesetName, "tag", []string{"refs/tags/" + protectedTagPattern}))
+	}
+	log.Debug("Repository rulesets are not available on the destination. Protecting mirrored references with branch protection rules and tag protection instead...")
+	err := pushService.protectBranches()
+	if err != nil {
+		return err
+	}
+	return pushService.protectTags()
+}
+
+func (pushService *pushService) createOrUpdateRuleset(desiredRuleset ruleset) error {
+	rulesetsURL := fmt.Sprintf("repos/%s/%s/rulesets", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+	request, err := pushService.githubEnterpriseClient.NewRequest("GET", rulesetsURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "Error constructing rulesets request.")
+	}
+	existingRulesets := []ruleset{}
+	response, err := pushService.githubEnterpriseClient.Do(pushService.ctx, request, &existingRulesets)
+	if err != nil {
+		return githubapiutil.EnrichResponseError(response, err, "Error listing repository rulesets.")
+	}
+	method := "POST"
+	for _, existingRuleset := range existingRulesets {
+		if existingRuleset.Name == desiredRuleset.Name {
+			log.Debugf("Updating ruleset %s...", desiredRuleset.Name)
+			method = "PUT"
+			rulesetsURL = fmt.Sprintf("%s/%d", rulesetsURL, existingRuleset.ID)
+			break
+		}
+	}
+	if method == "POST" {
+		log.Debugf("Creating ruleset %s...", desiredRuleset.Name)
+	}
+	request, err = pushService.githubEnterpriseClient.NewRequest(method, rulesetsURL, &desiredRuleset)
+	if err != nil {
+		return errors.Wrap(err, "Error constructing ruleset request.")
+	}
+	response, err = pushService.githubEnterpriseClient.Do(pushService.ctx, request, nil)
+	if err != nil {
+		if response != nil && (response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("You don't have permission to manage rulesets on %s/%s, so the mirrored references cannot be protected.", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+		}
+		return githubapiutil.EnrichResponseError(response, err, fmt.Sprintf("Error saving ruleset %s.", desiredRuleset.Name))
+	}
+	return nil
+}
+
+func (pushService *pushService) protectBranches() error {
+	user, response, err := pushService.githubEnterpriseClient.Users.Get(pushService.ctx, "")
+	if err != nil {
+		return githubapiutil.EnrichResponseError(response, err, "Error getting current user.")
+	}
+	var restrictions *github.BranchRestrictionsRequest
+	if pushService.destinationRepositoryOwner != user.GetLogin() {
+		// Push restrictions are only available for repositories owned by an organization.
+		restrictions = &github.BranchRestrictionsRequest{Users: []string{user.GetLogin()}, Teams: []string{}}
+	} else {
+		log.Warnf("The destination repository is owned by a user rather than an organization, so pushes to its branches cannot be restricted to %s. Force pushes and deletions will still be blocked.", user.GetLogin())
+	}
+
+	gitRepository, err := git.PlainOpen(pushService.cacheDirectory.GitPath())
+	if err != nil {
+		return errors.Wrap(err, "Error reading Git repository from cache.")
+	}
+	references, err := gitRepository.References()
+	if err != nil {
+		return errors.Wrap(err, "Error listing local references.")
+	}
+	defer references.Close()
+	return references.ForEach(func(reference *plumbing.Reference) error {
+		if !reference.Name().IsBranch() || !actionReferences.MatchString(reference.Name().String()) || pushService.skippedReferences[reference.Name()] {
+			return nil
+		}
+		branch := reference.Name().Short()
+		log.Debugf("Protecting branch %s...", branch)
+		_, response, err := pushService.githubEnterpriseClient.Repositories.UpdateBranchProtection(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, branch, &github.ProtectionRequest{
+			Restrictions:     restrictions,
+			AllowForcePushes: github.Bool(false),
+			AllowDeletions:   github.Bool(false),
+		})
+		if err != nil {
+			return githubapiutil.EnrichResponseError(response, err, fmt.Sprintf("Error protecting branch %s.", branch))
+		}
+		return nil
+	})
+}
+
+func (pushService *pushService) protectTags() error {
+	tagProtectionURL := fmt.Sprintf("repos/%s/%s/tags/protection", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+	request, err := pushService.githubEnterpriseClient.NewRequest("GET", tagProtectionURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "Error constructing tag protection request.")
+	}
+	existingTagProtections := []tagProtection{}
+	response, err := pushService.githubEnterpriseClient.Do(pushService.ctx, request, &existingTagProtections)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			log.Warn("Tag protection is not available on the destination, so the mirrored tags cannot be protected.")
+			return nil
+		}
+		return githubapiutil.EnrichResponseError(response, err, "Error listing tag protection.")
+	}
+	for _, existingTagProtection := range existingTagProtections {
+		if existingTagProtection.Pattern == protectedTagPattern {
+			return nil
+		}
+	}
+	log.Debugf("Protecting tags matching %s...", protectedTagPattern)
+	request, err = pushService.githubEnterpriseClient.NewRequest("POST", tagProtectionURL, &tagProtection{Pattern: protectedTagPattern})
+	if err != nil {
+		return errors.Wrap(err, "Error constructing tag protection request.")
+	}
+	response, err = pushService.githubEnterpriseClient.Do(pushService.ctx, request, nil)
+	if err != nil {
+		return githubapiutil.EnrichResponseError(response, err, "Error protecting tags.")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package push
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtectReferencesDisabled(t *testing.T) {
+	pushService := getTestPushService(t, test.CreateTemporaryDirectory(t), "")
+	require.NoError(t, pushService.protectReferences())
+}
+
+func TestProtectReferencesWithRulesets(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.protectRefs = true
+	pushService.enterpriseVersion = "3.12.0"
+	savedRulesets := map[string]ruleset{}
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/rulesets", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, []ruleset{{ID: 42, Name: branchRulesetName}}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/rulesets/42", func(response http.ResponseWriter, request *http.Request) {
+		savedRuleset := ruleset{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&savedRuleset))
+		savedRulesets["PUT "+savedRuleset.Name] = savedRuleset
+		test.ServeHTTPResponseFromObject(t, savedRuleset, response)
+	}).Methods("PUT")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/rulesets", func(response http.ResponseWriter, request *http.Request) {
+		savedRuleset := ruleset{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&savedRuleset))
+		savedRulesets["POST "+savedRuleset.Name] = savedRuleset
+		test.ServeHTTPResponseFromObject(t, savedRuleset, response)
+	}).Methods("POST")
+	err := pushService.protectReferences()
+	require.NoError(t, err)
+	require.Len(t, savedRulesets, 2)
+	branchRuleset := savedRulesets["PUT "+branchRulesetName]
+	require.Equal(t, "branch", branchRuleset.Target)
+	require.Equal(t, []string{"refs/heads/main", "refs/heads/v*"}, branchRuleset.Conditions.RefName.Include)
+	require.Equal(t, []rulesetBypassActor{{ActorID: repositoryAdminRoleID, ActorType: "RepositoryRole", BypassMode: "always"}}, branchRuleset.BypassActors)
+	tagRuleset := savedRulesets["POST "+tagRulesetName]
+	require.Equal(t, "tag", tagRuleset.Target)
+	require.Equal(t, []string{"refs/tags/v*"}, tagRuleset.Conditions.RefName.Include)
+}
+
+func TestProtectReferencesWithBranchProtection(t *testing.T) {
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", githubEnterpriseURL)
+	pushService.protectRefs = true
+	pushService.enterpriseVersion = "3.10.4"
+	protectedBranches := []string{}
+	var createdTagProtection tagProtection
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("user")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/branches/{branch}/protection", func(response http.ResponseWriter, request *http.Request) {
+		protectionRequest := github.ProtectionRequest{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&protectionRequest))
+		require.Equal(t, []string{"user"}, protectionRequest.Restrictions.Users)
+		require.False(t, protectionRequest.GetAllowForcePushes())
+		protectedBranches = append(protectedBranches, mux.Vars(request)["branch"])
+		test.ServeHTTPResponseFromObject(t, github.Protection{}, response)
+	}).Methods("PUT")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/tags/protection", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, []tagProtection{}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/tags/protection", func(response http.ResponseWriter, request *http.Request) {
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&createdTagProtection))
+		test.ServeHTTPResponseFromObject(t, createdTagProtection, response)
+	}).Methods("POST")
+	err := pushService.protectReferences()
+	require.NoError(t, err)
+	sort.Strings(protectedBranches)
+	require.Equal(t, []string{"main", "v1", "v3"}, protectedBranches)
+	require.Equal(t, protectedTagPattern, createdTagProtection.Pattern)
+}
@@ -3,7 +3,6 @@ package push
 import (
 	"context"
 	"encoding/json"
-	usererrors "errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,11 +11,20 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
 
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/event"
 	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/github/codeql-action-sync/internal/manifest"
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/github/codeql-action-sync/internal/progress"
+	"github.com/github/codeql-action-sync/internal/retry"
+	"github.com/github/codeql-action-sync/internal/signature"
 
 	log "github.com/sirupsen/logrus"
 
@@ -36,9 +44,19 @@ const repositoryHomepage = "https://github.com/github/codeql-action-sync-tool/"
 
 const errorAlreadyExists = "The destination repository already exists, but it was not created with the CodeQL Action sync tool. If you are sure you want to push the CodeQL Action to it, re-run this command with the `--force` flag."
 const errorInvalidDestinationToken = "The destination token you've provided is not valid."
+const errorOrganizationDoesNotExist = "The destination organization %s does not exist, and organizations cannot be created by the sync tool on %s. Please create it and try again."
+const errorInvalidDestinationRepository = "The destination repository %s is not valid. It should be in the form `owner/name`."
+
+const IncompatibleReferencesWarn = "warn"
+const IncompatibleReferencesRefuse = "refuse"
+const IncompatibleReferencesSkip = "skip"
+
+const errorInvalidIncompatibleReferences = "The incompatible references policy %s is not valid. It should be one of `warn`, `refuse` or `skip`."
+const errorIncompatibleReferences = "The destination GitHub Enterprise Server version %s cannot run the CodeQL Action at %s. Re-run this command with `--incompatible-refs skip` to push everything else."
+const errorIncompatibleBundles = "Runners on the destination GitHub Enterprise Server version %s may not be able to extract the CodeQL bundles in %s, which are only available as `.tar.zst` files. Re-run this command with `--incompatible-refs skip` to push everything else."
+
+var actionReferences = regexp.MustCompile("^refs/(heads|tags)/(main|v\\d+)$")
 
-const enterpriseAPIPath = "/api/v3"
-const enterpriseUploadsPath = "/api/uploads"
 const enterpriseVersionHeaderKey = "X-GitHub-Enterprise-Version"
 const enterpriseAegisVersionHeaderValue = "GitHub AE"
 
@@ -50,30 +68,62 @@ type pushService struct {
 	destinationRepositoryOwner string
 	destinationToken           *oauth2.Token
 	actionsAdminUser           string
-	aegis                      bool
+	enterpriseVersion          string
+	destinationType            string
 	force                      bool
 	pushSSH                    bool
 	gitURL                     string
+	retryPolicy                retry.Policy
+	incompatibleReferences     string
+	driftedReferences          string
+	repositorySettings         RepositorySettings
+	protectRefs                bool
+	uploadSBOM                 bool
+	repositoryCreated          bool
+	skippedReferences          map[plumbing.ReferenceName]bool
+	pushGitDuration            time.Duration
+	previousState              *pushState
+	events                     event.Handler
+	progress                   progress.Reporter
+	stateDirectory             string
 }
 
-func (pushService *pushService) createRepository() (*github.Repository, error) {
-	minimumRepositoryScope := "public_repo"
-	acceptableRepositoryScopes := []string{"public_repo", "repo"}
-	desiredVisibility := "public"
-	if pushService.aegis {
-		minimumRepositoryScope = "repo"
-		acceptableRepositoryScopes = []string{"repo"}
-		desiredVisibility = "internal"
+func (pushService *pushService) impersonateActionsAdminUserIfRequired(user *github.User, minimumRepositoryScope string) error {
+	_, response, err := pushService.githubEnterpriseClient.Organizations.IsMember(pushService.ctx, pushService.destinationRepositoryOwner, user.GetLogin())
+	if err != nil {
+		return githubapiutil.EnrichResponseError(response, err, "Failed to check membership of destination organization.")
+	}
+	if (response.StatusCode == http.StatusFound || response.StatusCode == http.StatusNotFound) && githubapiutil.HasAnyScope(response, "site_admin") {
+		log.Debugf("No access to destination organization (status code %d). Switching to impersonation token for %s...", response.StatusCode, pushService.actionsAdminUser)
+		impersonationToken, response, err := pushService.githubEnterpriseClient.Admin.CreateUserImpersonation(pushService.ctx, pushService.actionsAdminUser, &github.ImpersonateUserOptions{Scopes: []string{minimumRepositoryScope, "workflow"}})
+		if err != nil {
+			return githubapiutil.EnrichResponseError(response, err, "Failed to impersonate Actions admin user.")
+		}
+		pushService.destinationToken.AccessToken = impersonationToken.GetToken()
 	}
+	return nil
+}
 
-	log.Debug("Ensuring repository exists...")
+func (pushService *pushService) currentUser() (*github.User, error) {
 	user, response, err := pushService.githubEnterpriseClient.Users.Get(pushService.ctx, "")
 	if err != nil {
 		if response != nil && response.StatusCode == http.StatusUnauthorized {
-			return nil, usererrors.New(errorInvalidDestinationToken)
+			return nil, errorcategory.New(errorcategory.ErrAuth, errorInvalidDestinationToken)
 		}
 		return nil, githubapiutil.EnrichResponseError(response, err, "Error getting current user.")
 	}
+	return user, nil
+}
+
+func (pushService *pushService) createRepository() (*github.Repository, error) {
+	minimumRepositoryScope, acceptableRepositoryScopes := pushService.repositoryScopes()
+	desiredVisibility := pushService.repositoryVisibility()
+
+	log.Debug("Ensuring repository exists...")
+	user, err := pushService.currentUser()
+	if err != nil {
+		return nil, err
+	}
 
 	// When creating a repository we can either create it in a named organization or under the current user (represented in go-github by an empty string).
 	destinationOrganization := ""
@@ -86,6 +136,9 @@ func (pushService *pushService) createRepository() (*github.Repository, error) {
 		if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
 			return nil, githubapiutil.EnrichResponseError(response, err, "Error checking if destination organization exists.")
 		}
+		if response != nil && response.StatusCode == http.StatusNotFound && !pushService.supportsSiteAdministration() {
+			return nil, errorcategory.Errorf(errorcategory.ErrPermission, errorOrganizationDoesNotExist, pushService.destinationRepositoryOwner, pushService.destinationTypeDescription())
+		}
 		if response != nil && response.StatusCode == http.StatusNotFound {
 			log.Debugf("The organization %s does not exist. Creating it...", pushService.destinationRepositoryOwner)
 			_, response, err := pushService.githubEnterpriseClient.Admin.CreateOrg(pushService.ctx, &github.Organization{
@@ -94,23 +147,17 @@ func (pushService *pushService) createRepository() (*github.Repository, error) {
 			}, user.GetLogin())
 			if err != nil {
 				if response != nil && response.StatusCode == http.StatusNotFound && !githubapiutil.HasAnyScope(response, "site_admin") {
-					return nil, usererrors.New("The destination token you have provided does not have the `site_admin` scope, so the destination organization cannot be created.")
+					return nil, errorcategory.New(errorcategory.ErrPermission, "The destination token you have provided does not have the `site_admin` scope, so the destination organization cannot be created.")
 				}
 				return nil, githubapiutil.EnrichResponseError(response, err, "Error creating organization.")
 			}
 		}
 
-		_, response, err = pushService.githubEnterpriseClient.Organizations.IsMember(pushService.ctx, pushService.destinationRepositoryOwner, user.GetLogin())
-		if err != nil {
-			return nil, githubapiutil.EnrichResponseError(response, err, "Failed to check membership of destination organization.")
-		}
-		if (response.StatusCode == http.StatusFound || response.StatusCode == http.StatusNotFound) && githubapiutil.HasAnyScope(response, "site_admin") {
-			log.Debugf("No access to destination organization (status code %d). Switching to impersonation token for %s...", response.StatusCode, pushService.actionsAdminUser)
-			impersonationToken, response, err := pushService.githubEnterpriseClient.Admin.CreateUserImpersonation(pushService.ctx, pushService.actionsAdminUser, &github.ImpersonateUserOptions{Scopes: []string{minimumRepositoryScope, "workflow"}})
+		if pushService.supportsSiteAdministration() {
+			err := pushService.impersonateActionsAdminUserIfRequired(user, minimumRepositoryScope)
 			if err != nil {
-				return nil, githubapiutil.EnrichResponseError(response, err, "Failed to impersonate Actions admin user.")
+				return nil, err
 			}
-			pushService.destinationToken.AccessToken = impersonationToken.GetToken()
 		}
 	}
 
@@ -119,7 +166,7 @@ func (pushService *pushService) createRepository() (*github.Repository, error) {
 		return nil, githubapiutil.EnrichResponseError(response, err, "Error checking if destination repository exists.")
 	}
 	if response.StatusCode != http.StatusNotFound && repositoryHomepage != repository.GetHomepage() && !pushService.force {
-		return nil, errors.Errorf(errorAlreadyExists)
+		return nil, errorcategory.New(errorcategory.ErrConflict, errorAlreadyExists)
 	}
 	desiredRepositoryProperties := github.Repository{
 		Name:         github.String(pushService.destinationRepositoryName),
@@ -131,6 +178,7 @@ func (pushService *pushService) createRepository() (*github.Repository, error) {
 		HasDownloads: github.Bool(false),
 		Archived:     github.Bool(false),
 	}
+	pushService.applyRepositoryProperties(&desiredRepositoryProperties)
 	if repository.GetVisibility() != desiredVisibility {
 		// For some reason if you provide a visibility it must be different than the current visibility.
 		// It seems to be the only property that behaves this way, so we have to treat is specially...
@@ -141,25 +189,31 @@ func (pushService *pushService) createRepository() (*github.Repository, error) {
 		repository, response, err = pushService.githubEnterpriseClient.Repositories.Create(pushService.ctx, destinationOrganization, &desiredRepositoryProperties)
 		if err != nil {
 			if response.StatusCode == http.StatusNotFound && !githubapiutil.HasAnyScope(response, acceptableRepositoryScopes...) {
-				return nil, fmt.Errorf("The destination token you have provided does not have the `%s` scope.", minimumRepositoryScope)
+				return nil, errorcategory.Errorf(errorcategory.ErrPermission, "The destination token you have provided does not have the `%s` scope.", minimumRepositoryScope)
 			}
 			return nil, githubapiutil.EnrichResponseError(response, err, "Error creating destination repository.")
 		}
+		pushService.repositoryCreated = true
 	} else {
 		log.Debug("Repository already exists. Updating its metadata...")
 		repository, response, err = pushService.githubEnterpriseClient.Repositories.Edit(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, &desiredRepositoryProperties)
 		if err != nil {
 			if response.StatusCode == http.StatusNotFound {
 				if !githubapiutil.HasAnyScope(response, acceptableRepositoryScopes...) {
-					return nil, fmt.Errorf("The destination token you have provided does not have the `%s` scope.", minimumRepositoryScope)
+					return nil, errorcategory.Errorf(errorcategory.ErrPermission, "The destination token you have provided does not have the `%s` scope.", minimumRepositoryScope)
 				} else {
-					return nil, fmt.Errorf("You don't have permission to update the repository at %s/%s. If you wish to update the bundled CodeQL Action please provide a token with the `site_admin` scope.", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+					return nil, errorcategory.Errorf(errorcategory.ErrPermission, "You don't have permission to update the repository at %s/%s. If you wish to update the bundled CodeQL Action please provide a token with the `site_admin` scope.", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
 				}
 			}
 			return nil, githubapiutil.EnrichResponseError(response, err, "Error updating destination repository.")
 		}
 	}
 
+	err = pushService.applyRepositorySettings()
+	if err != nil {
+		return nil, err
+	}
+
 	return repository, nil
 }
 
@@ -183,6 +237,13 @@ func (pushService *pushService) pushGit(repository *github.Repository, initialPu
 			remoteURL = repository.GetSSHURL()
 		}
 	}
+	// The Git contents are pushed in two steps either side of the releases, so the phase duration covers both.
+	started := time.Now()
+	defer pushService.events.StartPhase(metrics.PhasePushGit)()
+	defer func() {
+		pushService.pushGitDuration += time.Since(started)
+		metrics.PhaseDuration.Set(pushService.pushGitDuration.Seconds(), metrics.PhasePushGit)
+	}()
 	if initialPush {
 		log.Debugf("Pushing Git releases to %s...", remoteURL)
 	} else {
@@ -208,12 +269,29 @@ func (pushService *pushService) pushGit(repository *github.Repository, initialPu
 	}
 
 	refSpecBatches := [][]config.RefSpec{}
-	remoteReferences, err := remote.List(&git.ListOptions{Auth: credentials})
-	if err != nil && err != transport.ErrEmptyRemoteRepository {
+	var remoteReferences []*plumbing.Reference
+	err = pushService.retryPolicy.Do(pushService.ctx, "list remote references", func() error {
+		var err error
+		remoteReferences, err = remote.List(&git.ListOptions{Auth: credentials})
+		if err == transport.ErrEmptyRemoteRepository {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
 		return errors.Wrap(err, "Error listing remote references.")
 	}
+	if initialPush {
+		err = pushService.detectDrift(gitRepository, remoteReferences)
+		if err != nil {
+			return err
+		}
+	}
 	deleteRefSpecs := []config.RefSpec{}
 	for _, remoteReference := range remoteReferences {
+		if pushService.skippedReferences[remoteReference.Name()] || strings.HasPrefix(remoteReference.Name().String(), backupReferencePrefix) {
+			continue
+		}
 		_, err := gitRepository.Reference(remoteReference.Name(), false)
 		if err != nil && err != plumbing.ErrReferenceNotFound {
 			return errors.Wrapf(err, "Error finding local reference %s.", remoteReference.Name())
@@ -234,6 +312,9 @@ func (pushService *pushService) pushGit(repository *github.Repository, initialPu
 		initialRefSpecs := []config.RefSpec{}
 		for _, releasePathStat := range releasePathStats {
 			tagReferenceName := plumbing.NewTagReferenceName(releasePathStat.Name())
+			if pushService.skippedReferences[tagReferenceName] {
+				continue
+			}
 			_, err := gitRepository.Reference(tagReferenceName, true)
 			if err != nil {
 				return errors.Wrapf(err, "Error finding local tag reference %s.", tagReferenceName)
@@ -243,18 +324,20 @@ func (pushService *pushService) pushGit(repository *github.Repository, initialPu
 		refSpecBatches = append(refSpecBatches, splitLargeRefSpecs(initialRefSpecs)...)
 	} else {
 		// We've got to push the default branch on its own, so that it will be made the default branch if the repository has just been created. We then push everything else afterwards.
-		refSpecBatches = append(refSpecBatches,
-			[]config.RefSpec{
-				config.RefSpec(defaultBranchRefSpec),
-			},
-		)
+		if !pushService.skippedReferences[plumbing.ReferenceName(defaultBranchRef)] {
+			refSpecBatches = append(refSpecBatches,
+				[]config.RefSpec{
+					config.RefSpec(defaultBranchRefSpec),
+				},
+			)
+		}
 		nonDefaultRefSpecs := []config.RefSpec{}
 		localReferences, err := gitRepository.References()
 		if err != nil {
 			return errors.Wrap(err, "Error listing local references.")
 		}
 		localReferences.ForEach(func(ref *plumbing.Reference) error {
-			if ref.Name().String() != defaultBranchRef && strings.HasPrefix(ref.Name().String(), "refs/") {
+			if ref.Name().String() != defaultBranchRef && strings.HasPrefix(ref.Name().String(), "refs/") && !pushService.skippedReferences[ref.Name()] {
 				nonDefaultRefSpecs = append(nonDefaultRefSpecs, config.RefSpec("+"+ref.Name().String()+":"+ref.Name().String()))
 			}
 			return nil
@@ -264,12 +347,18 @@ func (pushService *pushService) pushGit(repository *github.Repository, initialPu
 	for _, refSpecs := range refSpecBatches {
 		if len(refSpecs) != 0 {
 			log.Debugf("Pushing refspecs %s.", refSpecs)
-			err = remote.PushContext(pushService.ctx, &git.PushOptions{
-				RefSpecs: refSpecs,
-				Auth:     credentials,
-				Progress: os.Stderr,
+			err = pushService.retryPolicy.Do(pushService.ctx, "push Git references", func() error {
+				err := remote.PushContext(pushService.ctx, &git.PushOptions{
+					RefSpecs: refSpecs,
+					Auth:     credentials,
+					Progress: progress.GitWriter(pushService.progress, pushService.events, metrics.PhasePushGit),
+				})
+				if err != nil && errors.Cause(err) == git.NoErrAlreadyUpToDate {
+					return nil
+				}
+				return err
 			})
-			if err != nil && errors.Cause(err) != git.NoErrAlreadyUpToDate {
+			if err != nil {
 				return errors.Wrap(err, "Error pushing Action to GitHub Enterprise Server.")
 			}
 		}
@@ -330,65 +419,69 @@ func (pushService *pushService) uploadReleaseAsset(release *github.RepositoryRel
 	return asset, response, nil
 }
 
-func (pushService *pushService) uploadAsset(release *github.RepositoryRelease, assetPathStat os.FileInfo) (*github.Response, error) {
-	assetFile, err := os.Open(pushService.cacheDirectory.AssetPath(release.GetTagName(), assetPathStat.Name()))
+func (pushService *pushService) uploadAsset(release *github.RepositoryRelease, assetPath string, assetPathStat os.FileInfo) error {
+	assetFile, err := os.Open(assetPath)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error opening release asset.")
+		return errors.Wrap(err, "Error opening release asset.")
 	}
 	defer assetFile.Close()
 	progressReader := &ioprogress.Reader{
 		Reader:   assetFile,
 		Size:     assetPathStat.Size(),
-		DrawFunc: ioprogress.DrawTerminalf(os.Stderr, ioprogress.DrawTextFormatBytes),
+		DrawFunc: pushService.events.WrapDraw(release.GetTagName(), assetPathStat.Name(), pushService.progress.Asset(release.GetTagName(), assetPathStat.Name())),
 	}
+	_, _, err = pushService.uploadReleaseAsset(release, assetPathStat, progressReader)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error opening release asset.")
+		return err
 	}
-	_, response, err := pushService.uploadReleaseAsset(release, assetPathStat, progressReader)
-	return response, err
+	metrics.UploadedBytes.Add(float64(assetPathStat.Size()))
+	pushService.assetFinished(release, assetPathStat, metrics.AssetUploaded)
+	return nil
 }
 
-func (pushService *pushService) createOrUpdateReleaseAsset(release *github.RepositoryRelease, existingAssets []*github.ReleaseAsset, assetPathStat os.FileInfo) error {
-	attempt := 0
-	for {
-		attempt++
-		for _, existingAsset := range existingAssets {
-			if existingAsset.GetName() == assetPathStat.Name() {
-				actualSize := int64(existingAsset.GetSize())
-				expectedSize := assetPathStat.Size()
-				if actualSize == expectedSize {
-					return nil
-				} else {
-					log.Warnf("Removing existing release asset %s because it was only partially-uploaded (had size %d, but should have been %d)...", existingAsset.GetName(), actualSize, expectedSize)
-					response, err := pushService.githubEnterpriseClient.Repositories.DeleteReleaseAsset(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, existingAsset.GetID())
-					if err != nil {
-						return githubapiutil.EnrichResponseError(response, err, "Error deleting existing release asset.")
-					}
+func (pushService *pushService) assetFinished(release *github.RepositoryRelease, assetPathStat os.FileInfo, status string) {
+	metrics.Assets.Add(1, metrics.OperationPush, status)
+	pushService.events.Emit(event.Event{Type: event.AssetFinished, Release: release.GetTagName(), Asset: assetPathStat.Name(), Status: status, Bytes: assetPathStat.Size(), Total: assetPathStat.Size()})
+}
+
+func (pushService *pushService) createOrUpdateReleaseAsset(release *github.RepositoryRelease, existingAssets []*github.ReleaseAsset, assetPath string, assetPathStat os.FileInfo) error {
+	for _, existingAsset := range existingAssets {
+		if existingAsset.GetName() == assetPathStat.Name() {
+			actualSize := int64(existingAsset.GetSize())
+			expectedSize := assetPathStat.Size()
+			if actualSize == expectedSize {
+				pushService.assetFinished(release, assetPathStat, metrics.AssetExisting)
+				return nil
+			} else {
+				log.Warnf("Removing existing release asset %s because it was only partially-uploaded (had size %d, but should have been %d)...", existingAsset.GetName(), actualSize, expectedSize)
+				response, err := pushService.githubEnterpriseClient.Repositories.DeleteReleaseAsset(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, existingAsset.GetID())
+				if err != nil {
+					return githubapiutil.EnrichResponseError(response, err, "Error deleting existing release asset.")
 				}
 			}
 		}
+	}
+	// The upload request streams the asset from disk, so it is never retried by the transport and is retried here instead.
+	return pushService.retryPolicy.Do(pushService.ctx, "upload release asset "+assetPathStat.Name(), func() error {
 		log.Debugf("Uploading release asset %s...", assetPathStat.Name())
-		response, err := pushService.uploadAsset(release, assetPathStat)
-		if err == nil {
-			return nil
-		} else {
-			if githubErrorResponse := new(github.ErrorResponse); errors.As(err, &githubErrorResponse) {
-				for _, innerError := range githubErrorResponse.Errors {
-					if innerError.Code == "already_exists" {
-						log.Warn("Asset already existed.")
-						return nil
-					}
+		pushService.events.Emit(event.Event{Type: event.AssetStarted, Release: release.GetTagName(), Asset: assetPathStat.Name(), Total: assetPathStat.Size()})
+		err := pushService.uploadAsset(release, assetPath, assetPathStat)
+		if githubErrorResponse := new(github.ErrorResponse); errors.As(err, &githubErrorResponse) {
+			for _, innerError := range githubErrorResponse.Errors {
+				if innerError.Code == "already_exists" {
+					log.Warn("Asset already existed.")
+					pushService.assetFinished(release, assetPathStat, metrics.AssetExisting)
+					return nil
 				}
 			}
-			if response == nil || response.StatusCode < 500 || attempt >= 5 {
-				return err
-			}
-			log.Warnf("Attempt %d failed to upload release asset (%s), retrying...", attempt, err.Error())
 		}
-	}
+		return err
+	})
 }
 
 func (pushService *pushService) pushReleases() error {
+	defer metrics.TimePhase(metrics.PhasePushReleases)()
+	defer pushService.events.StartPhase(metrics.PhasePushReleases)()
 	log.Debugf("Pushing CodeQL bundles...")
 	releasesPath := pushService.cacheDirectory.ReleasesPath()
 
@@ -398,6 +491,10 @@ func (pushService *pushService) pushReleases() error {
 	}
 	for index, releasePathStat := range releasePathStats {
 		releaseName := releasePathStat.Name()
+		if pushService.skippedReferences[plumbing.NewTagReferenceName(releaseName)] {
+			log.Debugf("Skipping CodeQL bundle %s (%d/%d).", releaseName, index+1, len(releasePathStats))
+			continue
+		}
 		log.Debugf("Pushing CodeQL bundle %s (%d/%d)...", releaseName, index+1, len(releasePathStats))
 		release, err := pushService.createOrUpdateRelease(releaseName)
 		if err != nil {
@@ -422,7 +519,23 @@ func (pushService *pushService) pushReleases() error {
 			return errors.Wrap(err, "Error reading release assets.")
 		}
 		for _, assetPathStat := range assetPathStats {
-			err := pushService.createOrUpdateReleaseAsset(release, existingAssets, assetPathStat)
+			err := pushService.createOrUpdateReleaseAsset(release, existingAssets, pushService.cacheDirectory.AssetPath(releaseName, assetPathStat.Name()), assetPathStat)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pushService.uploadSBOM {
+			sbomPath := pushService.cacheDirectory.SBOMPath(releaseName)
+			sbomPathStat, err := os.Stat(sbomPath)
+			if os.IsNotExist(err) {
+				log.Warnf("There is no SBOM for CodeQL bundle %s in the cache, so it was not uploaded. Please re-run the `pull` command with `--sbom`.", releaseName)
+				continue
+			}
+			if err != nil {
+				return errors.Wrap(err, "Error reading SBOM.")
+			}
+			err = pushService.createOrUpdateReleaseAsset(release, existingAssets, sbomPath, sbomPathStat)
 			if err != nil {
 				return err
 			}
@@ -432,70 +545,152 @@ func (pushService *pushService) pushReleases() error {
 	return nil
 }
 
-func Push(ctx context.Context, cacheDirectory cachedirectory.CacheDirectory, destinationURL string, destinationToken string, destinationRepository string, actionsAdminUser string, force bool, pushSSH bool, gitURL string) error {
-	err := cacheDirectory.CheckOrCreateVersionFile(false, version.Version())
+// Options configures a push.
+type Options struct {
+	CacheDirectory cachedirectory.CacheDirectory
+	DestinationURL string
+	// DestinationType is one of `ghes`, `ghae`, `ghe.com` or `github.com`, or `auto` or empty to detect it.
+	DestinationType       string
+	DestinationToken      string
+	DestinationRepository string
+	ActionsAdminUser      string
+	Force                 bool
+	PushSSH               bool
+	// GitURL overrides the Git URL the Action is pushed to.
+	GitURL           string
+	MaxRateLimitWait time.Duration
+	RetryPolicy      retry.Policy
+	// IncompatibleReferences and DriftedReferences default to `warn`.
+	IncompatibleReferences string
+	DriftedReferences      string
+	RepositorySettings     RepositorySettings
+	ProtectRefs            bool
+	// ManifestKeys are the keys that the manifest of the cache must be signed by, if it is to be verified.
+	ManifestKeys        []string
+	AttestationSettings AttestationSettings
+	UploadSBOM          bool
+	Events              event.Handler
+	// Progress defaults to reporting nothing.
+	Progress progress.Reporter
+	// StateDirectory is where the state of the destination before each push is recorded, so that it can be rolled back. It is kept outside the cache, which may be replaced between pushes, and defaults to a `push-state` directory next to the cache directory.
+	StateDirectory string
+}
+
+func newPushService(ctx context.Context, options Options) (*pushService, error) {
+	err := options.RepositorySettings.validate()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = cacheDirectory.CheckLock()
-	if err != nil {
-		return err
+	incompatibleReferences := options.IncompatibleReferences
+	if incompatibleReferences == "" {
+		incompatibleReferences = IncompatibleReferencesWarn
 	}
-
-	destinationURL = strings.TrimRight(destinationURL, "/")
-	token := oauth2.Token{AccessToken: destinationToken}
-	tokenSource := oauth2.StaticTokenSource(
-		&token,
-	)
-	tokenClient := oauth2.NewClient(ctx, tokenSource)
-	client, err := github.NewEnterpriseClient(destinationURL+enterpriseAPIPath, destinationURL+enterpriseUploadsPath, tokenClient)
-	if err != nil {
-		return errors.Wrap(err, "Error creating GitHub Enterprise client.")
+	switch incompatibleReferences {
+	case IncompatibleReferencesWarn, IncompatibleReferencesRefuse, IncompatibleReferencesSkip:
+	default:
+		return nil, fmt.Errorf(errorInvalidIncompatibleReferences, incompatibleReferences)
 	}
-	rootRequest, err := client.NewRequest("GET", enterpriseAPIPath, nil)
+	driftedReferences := options.DriftedReferences
+	if driftedReferences == "" {
+		driftedReferences = DriftedReferencesWarn
+	}
+	err = validateDriftedReferences(driftedReferences)
 	if err != nil {
-		return errors.Wrap(err, "Error constructing request for GitHub Enterprise client.")
+		return nil, err
 	}
-	rootResponse, err := client.Do(ctx, rootRequest, nil)
+
+	token := oauth2.Token{AccessToken: options.DestinationToken}
+	httpClient := githubapiutil.NewHTTPClient(&token, options.MaxRateLimitWait, options.RetryPolicy)
+	client, destinationType, enterpriseVersion, err := newDestinationClient(ctx, options.DestinationType, options.DestinationURL, httpClient)
 	if err != nil {
-		return githubapiutil.EnrichResponseError(rootResponse, err, "Error checking connectivity for GitHub Enterprise client.")
-	}
-	if rootRequest.URL != rootResponse.Request.URL {
-		updatedBaseURL, _ := url.Parse(client.BaseURL.String())
-		updatedBaseURL.Scheme = rootResponse.Request.URL.Scheme
-		updatedBaseURL.Host = rootResponse.Request.URL.Host
-		log.Warnf("%s redirected to %s. The URL %s will be used for all API requests.", rootRequest.URL, rootResponse.Request.URL, updatedBaseURL)
-		updatedUploadsURL, _ := url.Parse(client.UploadURL.String())
-		updatedUploadsURL.Scheme = rootResponse.Request.URL.Scheme
-		updatedUploadsURL.Host = rootResponse.Request.URL.Host
-		client, err = github.NewEnterpriseClient(updatedBaseURL.String(), updatedUploadsURL.String(), tokenClient)
-		if err != nil {
-			return errors.Wrap(err, "Error creating GitHub Enterprise client.")
-		}
+		return nil, err
 	}
-	aegis := rootResponse.Header.Get(enterpriseVersionHeaderKey) == enterpriseAegisVersionHeaderValue
 
-	destinationRepositorySplit := strings.Split(destinationRepository, "/")
+	progressReporter := options.Progress
+	if progressReporter == nil {
+		progressReporter = progress.Silent()
+	}
+
+	destinationRepositorySplit := strings.Split(options.DestinationRepository, "/")
+	if len(destinationRepositorySplit) != 2 {
+		return nil, fmt.Errorf(errorInvalidDestinationRepository, options.DestinationRepository)
+	}
 	destinationRepositoryOwner := destinationRepositorySplit[0]
 	destinationRepositoryName := destinationRepositorySplit[1]
 
-	pushService := pushService{
+	stateDirectory := options.StateDirectory
+	if stateDirectory == "" {
+		stateDirectory = filepath.Join(filepath.Dir(filepath.Clean(options.CacheDirectory.Path())), "push-state")
+	}
+
+	return &pushService{
 		ctx:                        ctx,
-		cacheDirectory:             cacheDirectory,
+		cacheDirectory:             options.CacheDirectory,
 		githubEnterpriseClient:     client,
 		destinationRepositoryOwner: destinationRepositoryOwner,
 		destinationRepositoryName:  destinationRepositoryName,
 		destinationToken:           &token,
-		actionsAdminUser:           actionsAdminUser,
-		aegis:                      aegis,
-		force:                      force,
-		pushSSH:                    pushSSH,
-		gitURL:                     gitURL,
+		actionsAdminUser:           options.ActionsAdminUser,
+		enterpriseVersion:          enterpriseVersion,
+		destinationType:            destinationType,
+		force:                      options.Force,
+		pushSSH:                    options.PushSSH,
+		gitURL:                     options.GitURL,
+		retryPolicy:                options.RetryPolicy,
+		incompatibleReferences:     incompatibleReferences,
+		driftedReferences:          driftedReferences,
+		repositorySettings:         options.RepositorySettings,
+		protectRefs:                options.ProtectRefs,
+		uploadSBOM:                 options.UploadSBOM,
+		events:                     event.Combine(progressReporter.Event, options.Events),
+		progress:                   progressReporter,
+		stateDirectory:             stateDirectory,
+	}, nil
+}
+
+func Push(ctx context.Context, options Options) (*Result, error) {
+	cacheDirectory := options.CacheDirectory
+	err := cacheDirectory.CheckOrCreateVersionFile(false, version.Version())
+	if err != nil {
+		return nil, err
+	}
+	err = cacheDirectory.CheckLock()
+	if err != nil {
+		return nil, err
+	}
+	if len(options.ManifestKeys) != 0 {
+		keyring, err := signature.LoadKeyring(options.ManifestKeys)
+		if err != nil {
+			return nil, err
+		}
+		err = manifest.Verify(cacheDirectory, keyring)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = verifyAttestations(cacheDirectory, options.AttestationSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	pushService, err := newPushService(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pushService.checkCompatibility()
+	if err != nil {
+		return nil, err
 	}
 
 	repository, err := pushService.createRepository()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = pushService.recordPushState()
+	if err != nil {
+		return nil, err
 	}
 
 	// "He was going to live forever, or die in the attempt." - Catch-22, Joseph Heller
@@ -505,16 +700,28 @@ func Push(ctx context.Context, cacheDirectory cachedirectory.CacheDirectory, des
 	// This should work so long as no one uses a tag both to reference a specific version of the CodeQL Action and as a storage mechanism for a CodeQL bundle.
 	err = pushService.pushGit(repository, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = pushService.pushReleases()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = pushService.pushGit(repository, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.Infof("Finished pushing CodeQL Action to %s!", destinationRepository)
-	return nil
+	err = pushService.finishPushState()
+	if err != nil {
+		return nil, err
+	}
+	err = pushService.protectReferences()
+	if err != nil {
+		return nil, err
+	}
+	err = pushService.recordReferenceMetrics()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Finished pushing CodeQL Action to %s!", options.DestinationRepository)
+	return pushService.result()
 }
@@ -8,12 +8,19 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/github/codeql-action-sync/internal/progress"
+	"github.com/github/codeql-action-sync/internal/retry"
 	"github.com/github/codeql-action-sync/test"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -41,6 +48,8 @@ func getTestPushService(t *testing.T, cacheDirectoryString string, githubEnterpr
 		destinationRepositoryOwner: "destination-repository-owner",
 		destinationRepositoryName:  "destination-repository-name",
 		destinationToken:           &token,
+		progress:                   progress.Silent(),
+		stateDirectory:             test.CreateTemporaryDirectory(t),
 	}
 }
 
@@ -61,6 +70,25 @@ func TestCreateRepositoryWhenUserIsOwner(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestCreateRepositoryWithoutRepositoryScope(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("destination-repository-owner")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/user/repos", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("X-OAuth-Scopes", "read:org")
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("POST")
+	_, err := pushService.createRepository()
+	require.EqualError(t, err, "The destination token you have provided does not have the `public_repo` scope.")
+	require.ErrorIs(t, err, errorcategory.ErrPermission)
+}
+
 func TestUpdateRepositoryWhenUserIsOwner(t *testing.T) {
 	temporaryDirectory := test.CreateTemporaryDirectory(t)
 	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
@@ -93,6 +121,7 @@ func TestUpdateRepositoryWhenUserIsOwnerForced(t *testing.T) {
 	}).Methods("PATCH")
 	_, err := pushService.createRepository()
 	require.EqualError(t, err, errorAlreadyExists)
+	require.ErrorIs(t, err, errorcategory.ErrConflict)
 	pushService.force = true
 	_, err = pushService.createRepository()
 	require.NoError(t, err)
@@ -236,3 +265,154 @@ func TestPushReleases(t *testing.T) {
 	err := pushService.pushReleases()
 	require.NoError(t, err)
 }
+
+func TestCreateOrUpdateReleaseAssetRetriesUpload(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.retryPolicy = retry.DefaultPolicy()
+	pushService.retryPolicy.InitialBackoff = time.Millisecond
+	pushService.retryPolicy.MaxBackoff = time.Millisecond
+	assetPath := path.Join(temporaryDirectory, "codeql-bundle.tar.gz")
+	require.NoError(t, ioutil.WriteFile(assetPath, []byte("bundle"), 0644))
+	assetPathStat, err := os.Stat(assetPath)
+	require.NoError(t, err)
+	deletions := 0
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/releases/assets/1", func(response http.ResponseWriter, request *http.Request) {
+		deletions++
+		response.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	uploads := 0
+	githubTestServer.HandleFunc("/api/uploads/repos/destination-repository-owner/destination-repository-name/releases/2/assets", func(response http.ResponseWriter, request *http.Request) {
+		uploads++
+		if uploads == 1 {
+			response.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		test.ServeHTTPResponseFromObject(t, github.ReleaseAsset{Name: github.String("codeql-bundle.tar.gz")}, response)
+	}).Methods("POST")
+	release := &github.RepositoryRelease{ID: github.Int64(2), TagName: github.String("codeql-bundle-20200630")}
+	existingAssets := []*github.ReleaseAsset{{ID: github.Int64(1), Name: github.String("codeql-bundle.tar.gz"), Size: github.Int(3)}}
+	err = pushService.createOrUpdateReleaseAsset(release, existingAssets, assetPath, assetPathStat)
+	require.NoError(t, err)
+	require.Equal(t, 1, deletions)
+	require.Equal(t, 2, uploads)
+}
+
+func TestPushGitSkipsIncompatibleReferences(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	destinationPath := path.Join(temporaryDirectory, "target")
+	_, err := git.PlainInit(destinationPath, true)
+	require.NoError(t, err)
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", "")
+	pushService.enterpriseVersion = "3.4.0"
+	pushService.incompatibleReferences = IncompatibleReferencesRefuse
+	err = pushService.checkCompatibility()
+	require.EqualError(t, err, "The destination GitHub Enterprise Server version 3.4 cannot run the CodeQL Action at refs/heads/v3. Re-run this command with `--incompatible-refs skip` to push everything else.")
+
+	pushService.incompatibleReferences = IncompatibleReferencesSkip
+	err = pushService.checkCompatibility()
+	require.NoError(t, err)
+	repository := github.Repository{
+		CloneURL: github.String(destinationPath),
+	}
+	err = pushService.pushGit(&repository, true)
+	require.NoError(t, err)
+	err = pushService.pushGit(&repository, false)
+	require.NoError(t, err)
+	test.CheckExpectedReferencesInRepository(t, destinationPath, []string{
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/codeql-bundle-20200101",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/codeql-bundle-20200630",
+		"b9f01aa2c50f49898d4c7845a66be8824499fe9d refs/heads/main",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/v1",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/heads/very-ignored-branch",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/tags/an-ignored-tag-too",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/v2",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/a-ref-that-will-need-pruning",
+	})
+
+	err = pushService.recordReferenceMetrics()
+	require.NoError(t, err)
+	require.Equal(t, float64(1), metrics.ReferenceBehindUpstream.Value("refs/heads/v3"))
+	require.Equal(t, float64(0), metrics.ReferenceBehindUpstream.Value("refs/heads/main"))
+	require.Equal(t, float64(1), metrics.DestinationReference.Value("refs/heads/main", "b9f01aa2c50f49898d4c7845a66be8824499fe9d"))
+	require.Equal(t, float64(0), metrics.DestinationReference.Value("refs/heads/v3", "e529a54fad10a936308b2220e05f7f00757f8e7c"))
+	mainCommitTime := float64(time.Date(2020, 8, 18, 10, 46, 40, 0, time.UTC).Unix())
+	require.Equal(t, mainCommitTime, metrics.UpstreamCommitTime.Value("refs/heads/main"))
+	require.Equal(t, mainCommitTime, metrics.DestinationCommitTime.Value("refs/heads/main"))
+	require.NotZero(t, metrics.UpstreamCommitTime.Value("refs/heads/v3"))
+	require.Zero(t, metrics.DestinationCommitTime.Value("refs/heads/v3"))
+}
+
+func copyTestCache(t *testing.T, source string) string {
+	destination := path.Join(test.CreateTemporaryDirectory(t), "cache")
+	err := filepath.Walk(source, func(sourcePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(source, sourcePath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(destination, relativePath), 0755)
+		}
+		content, err := ioutil.ReadFile(sourcePath)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(destination, relativePath), content, 0644)
+	})
+	require.NoError(t, err)
+	return destination
+}
+
+func TestCheckZstdBundles(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	destinationPath := path.Join(temporaryDirectory, "target")
+	_, err := git.PlainInit(destinationPath, true)
+	require.NoError(t, err)
+	pushService := getTestPushService(t, copyTestCache(t, "./push_test/action-cache-initial/"), "")
+	for release, assets := range map[string][]string{
+		"codeql-bundle-20200630":           {"codeql-bundle.tar.gz", "codeql-bundle.tar.zst"},
+		"some-codeql-version-on-v1-and-v2": {"codeql-bundle.tar.zst"},
+	} {
+		require.NoError(t, os.MkdirAll(pushService.cacheDirectory.AssetsPath(release), 0755))
+		for _, asset := range assets {
+			require.NoError(t, ioutil.WriteFile(pushService.cacheDirectory.AssetPath(release, asset), []byte("Not really a bundle."), 0644))
+		}
+	}
+	pushService.enterpriseVersion = "3.12.0"
+
+	pushService.incompatibleReferences = IncompatibleReferencesWarn
+	require.NoError(t, pushService.checkCompatibility())
+	require.Empty(t, pushService.skippedReferences)
+
+	pushService.incompatibleReferences = IncompatibleReferencesRefuse
+	err = pushService.checkCompatibility()
+	require.EqualError(t, err, "Runners on the destination GitHub Enterprise Server version 3.12 may not be able to extract the CodeQL bundles in some-codeql-version-on-v1-and-v2, which are only available as `.tar.zst` files. Re-run this command with `--incompatible-refs skip` to push everything else.")
+	require.ErrorIs(t, err, errorcategory.ErrConflict)
+
+	pushService.incompatibleReferences = IncompatibleReferencesSkip
+	require.NoError(t, pushService.checkCompatibility())
+	// The versions of the Action that use the skipped bundle are skipped along with it.
+	require.Equal(t, map[plumbing.ReferenceName]bool{
+		"refs/tags/some-codeql-version-on-v1-and-v2": true,
+		"refs/heads/v1": true,
+		"refs/tags/v2":  true,
+	}, pushService.skippedReferences)
+	repository := github.Repository{
+		CloneURL: github.String(destinationPath),
+	}
+	require.NoError(t, pushService.pushGit(&repository, true))
+	require.NoError(t, pushService.pushGit(&repository, false))
+	test.CheckExpectedReferencesInRepository(t, destinationPath, []string{
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/codeql-bundle-20200101",
+		"26936381e619a01122ea33993e3cebc474496805 refs/tags/codeql-bundle-20200630",
+		"b9f01aa2c50f49898d4c7845a66be8824499fe9d refs/heads/main",
+		"e529a54fad10a936308b2220e05f7f00757f8e7c refs/heads/v3",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/heads/very-ignored-branch",
+		"bd82b85707bc13904e3526517677039d4da4a9bb refs/tags/an-ignored-tag-too",
+		"26936381e619a01122ea33993e3cebc474496805 refs/heads/a-ref-that-will-need-pruning",
+	})
+}
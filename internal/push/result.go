@@ -0,0 +1,83 @@
+package push
+
+import (
+	"io/ioutil"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+)
+
+// MovedReference is an Action branch or tag that a push created or moved. From is empty if the reference did not exist on the destination.
+type MovedReference struct {
+	Reference string `json:"ref"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+}
+
+// Result describes what a push changed on the destination.
+type Result struct {
+	BundleVersions    []string         `json:"bundle_versions"`
+	NewBundleVersions []string         `json:"new_bundle_versions"`
+	MovedReferences   []MovedReference `json:"moved_references"`
+}
+
+// result compares the cache with the state of the destination recorded before the push.
+func (pushService *pushService) result() (*Result, error) {
+	result := Result{
+		BundleVersions:    []string{},
+		NewBundleVersions: []string{},
+		MovedReferences:   []MovedReference{},
+	}
+	previousState := pushService.previousState
+	if previousState == nil {
+		previousState = &pushState{}
+	}
+
+	releasePathStats, err := ioutil.ReadDir(pushService.cacheDirectory.ReleasesPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading releases.")
+	}
+	for _, releasePathStat := range releasePathStats {
+		releaseName := releasePathStat.Name()
+		if pushService.skippedReferences[plumbing.NewTagReferenceName(releaseName)] {
+			continue
+		}
+		result.BundleVersions = append(result.BundleVersions, releaseName)
+		if _, existed := previousState.Releases[releaseName]; !existed {
+			result.NewBundleVersions = append(result.NewBundleVersions, releaseName)
+		}
+	}
+
+	gitRepository, err := git.PlainOpen(pushService.cacheDirectory.GitPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading Git repository from cache.")
+	}
+	references, err := gitRepository.References()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing local references.")
+	}
+	defer references.Close()
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		referenceName := reference.Name().String()
+		if !actionReferences.MatchString(referenceName) || pushService.skippedReferences[reference.Name()] {
+			return nil
+		}
+		if previousState.References[referenceName] != reference.Hash().String() {
+			result.MovedReferences = append(result.MovedReferences, MovedReference{
+				Reference: referenceName,
+				From:      previousState.References[referenceName],
+				To:        reference.Hash().String(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result.MovedReferences, func(i, j int) bool {
+		return result.MovedReferences[i].Reference < result.MovedReferences[j].Reference
+	})
+	return &result, nil
+}
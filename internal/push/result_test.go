@@ -0,0 +1,31 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResult(t *testing.T) {
+	pushService := getTestPushService(t, "./push_test/action-cache-initial/", "")
+	pushService.previousState = &pushState{
+		References: map[string]string{
+			"refs/heads/main": "b9f01aa2c50f49898d4c7845a66be8824499fe9d",
+			"refs/heads/v1":   "bd82b85707bc13904e3526517677039d4da4a9bb",
+		},
+		Releases: map[string][]recordedAsset{
+			"codeql-bundle-20200101": {{ID: 1, Name: "codeql-bundle.tar.gz", Size: 1}},
+		},
+	}
+	result, err := pushService.result()
+	require.NoError(t, err)
+	require.Equal(t, &Result{
+		BundleVersions:    []string{"codeql-bundle-20200101", "codeql-bundle-20200630"},
+		NewBundleVersions: []string{"codeql-bundle-20200630"},
+		MovedReferences: []MovedReference{
+			{Reference: "refs/heads/v1", From: "bd82b85707bc13904e3526517677039d4da4a9bb", To: "26936381e619a01122ea33993e3cebc474496805"},
+			{Reference: "refs/heads/v3", To: "e529a54fad10a936308b2220e05f7f00757f8e7c"},
+			{Reference: "refs/tags/v2", To: "26936381e619a01122ea33993e3cebc474496805"},
+		},
+	}, result)
+}
@@ -0,0 +1,407 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const errorNoPushState = "There is no record of a previous push to %s/%s in the state directory %s, so there is nothing to roll back. Check that `--state-dir` is the same as it was for the push."
+const errorRollbackCreatedRepository = "The repository %s/%s was created by the last push, so there is no earlier state to roll back to. If you want to undo the push, delete the repository instead."
+const errorAssetsNotRestorable = "The rest of the push was rolled back, but these release assets were replaced or deleted by the push and cannot be restored, because the destination does not keep their earlier versions: %s. Push them again from a cache that has the earlier versions if they are still needed."
+
+// pushState records what the destination repository looked like before a push, so that the push can be rolled back.
+type pushState struct {
+	RecordedAt        time.Time                  `json:"recorded_at"`
+	RepositoryCreated bool                       `json:"repository_created"`
+	References        map[string]string          `json:"references"`
+	Releases          map[string][]recordedAsset `json:"releases"`
+}
+
+// recordedAsset identifies a release asset, so that rollback can tell an asset that was replaced under the same name apart from the original.
+type recordedAsset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	// Digest is only set if the destination reports the digests of release assets.
+	Digest string `json:"digest,omitempty"`
+}
+
+func (pushService *pushService) pushStateName() string {
+	host := strings.ReplaceAll(pushService.githubEnterpriseClient.BaseURL.Host, ":", "_")
+	return fmt.Sprintf("%s_%s_%s", host, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+}
+
+func (pushService *pushService) pushStatePath() string {
+	return filepath.Join(pushService.stateDirectory, pushService.pushStateName()+".json")
+}
+
+// The state is kept in the pending file until the push has finished, so that a push which fails partway does not replace the state from before it.
+func (pushService *pushService) pendingPushStatePath() string {
+	return filepath.Join(pushService.stateDirectory, pushService.pushStateName()+".pending.json")
+}
+
+func (pushService *pushService) listDestinationReferences() (map[string]string, error) {
+	references := map[string]string{}
+	for page := 1; ; page++ {
+		pageReferences, response, err := pushService.githubEnterpriseClient.Git.ListMatchingRefs(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, &github.ReferenceListOptions{ListOptions: github.ListOptions{Page: page, PerPage: 100}})
+		if err != nil {
+			if response != nil && response.StatusCode == http.StatusConflict {
+				// The repository is empty.
+				return references, nil
+			}
+			return nil, githubapiutil.EnrichResponseError(response, err, "Error listing destination references.")
+		}
+		for _, reference := range pageReferences {
+			if !strings.HasPrefix(reference.GetRef(), backupReferencePrefix) {
+				references[reference.GetRef()] = reference.GetObject().GetSHA()
+			}
+		}
+		if response.NextPage == 0 {
+			return references, nil
+		}
+	}
+}
+
+func (pushService *pushService) listDestinationReleases() ([]*github.RepositoryRelease, error) {
+	releases := []*github.RepositoryRelease{}
+	for page := 1; ; page++ {
+		pageReleases, response, err := pushService.githubEnterpriseClient.Repositories.ListReleases(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, &github.ListOptions{Page: page, PerPage: 100})
+		if err != nil {
+			return nil, githubapiutil.EnrichResponseError(response, err, "Error listing destination releases.")
+		}
+		releases = append(releases, pageReleases...)
+		if response.NextPage == 0 {
+			return releases, nil
+		}
+	}
+}
+
+func (pushService *pushService) listDestinationReleaseAssets(release *github.RepositoryRelease) ([]recordedAsset, error) {
+	assets := []recordedAsset{}
+	for page := 1; ; page++ {
+		// The assets are decoded directly, since this version of go-github does not know about their digests.
+		url := fmt.Sprintf("repos/%s/%s/releases/%d/assets?page=%d&per_page=100", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, release.GetID(), page)
+		request, err := pushService.githubEnterpriseClient.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error constructing request to list destination release assets.")
+		}
+		pageAssets := []recordedAsset{}
+		response, err := pushService.githubEnterpriseClient.Do(pushService.ctx, request, &pageAssets)
+		if err != nil {
+			return nil, githubapiutil.EnrichResponseError(response, err, "Error listing destination release assets.")
+		}
+		assets = append(assets, pageAssets...)
+		if response.NextPage == 0 {
+			sort.Slice(assets, func(i, j int) bool {
+				return assets[i].ID < assets[j].ID
+			})
+			return assets, nil
+		}
+	}
+}
+
+func (pushService *pushService) snapshotDestination() (*pushState, error) {
+	state := pushState{
+		RecordedAt: time.Now().UTC(),
+		References: map[string]string{},
+		Releases:   map[string][]recordedAsset{},
+	}
+	references, err := pushService.listDestinationReferences()
+	if err != nil {
+		return nil, err
+	}
+	state.References = references
+	releases, err := pushService.listDestinationReleases()
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		assets, err := pushService.listDestinationReleaseAssets(release)
+		if err != nil {
+			return nil, err
+		}
+		state.Releases[release.GetTagName()] = assets
+	}
+	return &state, nil
+}
+
+func writePushState(path string, state *pushState) error {
+	stateBytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error serializing push state.")
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return errors.Wrap(err, "Error creating push state directory.")
+	}
+	err = ioutil.WriteFile(path, stateBytes, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing push state.")
+	}
+	return nil
+}
+
+func readPushState(path string) (*pushState, error) {
+	stateBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := pushState{}
+	err = json.Unmarshal(stateBytes, &state)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing push state.")
+	}
+	return &state, nil
+}
+
+func (pushService *pushService) recordPushState() error {
+	pendingState, err := readPushState(pushService.pendingPushStatePath())
+	if err == nil {
+		log.Warnf("The push started at %s did not finish, so the state of the destination repository from before it is kept for rolling back.", pendingState.RecordedAt.Format(time.RFC3339))
+		pushService.previousState = pendingState
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrap(err, "Error reading pending push state.")
+	}
+	log.Debug("Recording the state of the destination repository before pushing...")
+	state := &pushState{
+		RecordedAt:        time.Now().UTC(),
+		RepositoryCreated: true,
+		References:        map[string]string{},
+		Releases:          map[string][]recordedAsset{},
+	}
+	if !pushService.repositoryCreated {
+		state, err = pushService.snapshotDestination()
+		if err != nil {
+			return err
+		}
+	}
+	err = writePushState(pushService.pendingPushStatePath(), state)
+	if err != nil {
+		return err
+	}
+	pushService.previousState = state
+	return nil
+}
+
+// finishPushState replaces the state recorded by the last push with the one recorded before this push, unless this push did not change anything, in which case rolling back should still undo the last push that did.
+func (pushService *pushService) finishPushState() error {
+	state, err := pushService.snapshotDestination()
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(state.References, pushService.previousState.References) && reflect.DeepEqual(state.Releases, pushService.previousState.Releases) {
+		log.Debug("The push did not change the destination repository, so the state from before the last push is kept for rolling back.")
+		err = os.Remove(pushService.pendingPushStatePath())
+		if err != nil {
+			return errors.Wrap(err, "Error removing pending push state.")
+		}
+		return nil
+	}
+	err = os.Rename(pushService.pendingPushStatePath(), pushService.pushStatePath())
+	if err != nil {
+		return errors.Wrap(err, "Error recording push state.")
+	}
+	return nil
+}
+
+// readRollbackState returns the state from before the most recent push, which is the pending state if that push did not finish.
+func (pushService *pushService) readRollbackState() (*pushState, error) {
+	for _, path := range []string{pushService.pendingPushStatePath(), pushService.pushStatePath()} {
+		state, err := readPushState(path)
+		if err == nil {
+			return state, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "Error reading push state.")
+		}
+	}
+	return nil, fmt.Errorf(errorNoPushState, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, pushService.stateDirectory)
+}
+
+// rollbackReleases returns the assets that were replaced or deleted by the push, which cannot be restored.
+func (pushService *pushService) rollbackReleases(state *pushState) ([]string, error) {
+	notRestorable := []string{}
+	releases, err := pushService.listDestinationReleases()
+	if err != nil {
+		return nil, err
+	}
+	remainingReleases := map[string]bool{}
+	for _, release := range releases {
+		remainingReleases[release.GetTagName()] = true
+		previousAssets, existed := state.Releases[release.GetTagName()]
+		if !existed {
+			log.Infof("Deleting release %s...", release.GetTagName())
+			response, err := pushService.githubEnterpriseClient.Repositories.DeleteRelease(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, release.GetID())
+			if err != nil {
+				return nil, githubapiutil.EnrichResponseError(response, err, "Error deleting release.")
+			}
+			continue
+		}
+		previousAssetsByName := map[string]recordedAsset{}
+		for _, previousAsset := range previousAssets {
+			previousAssetsByName[previousAsset.Name] = previousAsset
+		}
+		assets, err := pushService.listDestinationReleaseAssets(release)
+		if err != nil {
+			return nil, err
+		}
+		remainingAssets := map[string]bool{}
+		for _, asset := range assets {
+			remainingAssets[asset.Name] = true
+			previousAsset, existed := previousAssetsByName[asset.Name]
+			switch {
+			case !existed:
+				log.Infof("Deleting release asset %s from release %s...", asset.Name, release.GetTagName())
+				response, err := pushService.githubEnterpriseClient.Repositories.DeleteReleaseAsset(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, asset.ID)
+				if err != nil {
+					return nil, githubapiutil.EnrichResponseError(response, err, "Error deleting release asset.")
+				}
+			case asset.ID != previousAsset.ID && (asset.Digest == "" || asset.Digest != previousAsset.Digest):
+				log.Warnf("Release asset %s of release %s was replaced by the push, so the earlier version cannot be restored.", asset.Name, release.GetTagName())
+				notRestorable = append(notRestorable, release.GetTagName()+"/"+asset.Name)
+			}
+		}
+		for _, previousAsset := range previousAssets {
+			if !remainingAssets[previousAsset.Name] {
+				log.Warnf("Release asset %s of release %s is no longer on the destination, so it cannot be restored.", previousAsset.Name, release.GetTagName())
+				notRestorable = append(notRestorable, release.GetTagName()+"/"+previousAsset.Name)
+			}
+		}
+	}
+	for releaseName, previousAssets := range state.Releases {
+		if !remainingReleases[releaseName] {
+			for _, previousAsset := range previousAssets {
+				log.Warnf("Release %s is no longer on the destination, so its asset %s cannot be restored.", releaseName, previousAsset.Name)
+				notRestorable = append(notRestorable, releaseName+"/"+previousAsset.Name)
+			}
+		}
+	}
+	sort.Strings(notRestorable)
+	return notRestorable, nil
+}
+
+func (pushService *pushService) rollbackReferences(state *pushState) error {
+	references, err := pushService.listDestinationReferences()
+	if err != nil {
+		return err
+	}
+	referenceNames := []string{}
+	for referenceName := range references {
+		referenceNames = append(referenceNames, referenceName)
+	}
+	for referenceName := range state.References {
+		if _, exists := references[referenceName]; !exists {
+			referenceNames = append(referenceNames, referenceName)
+		}
+	}
+	sort.Strings(referenceNames)
+
+	for _, referenceName := range referenceNames {
+		currentHash, exists := references[referenceName]
+		previousHash, existed := state.References[referenceName]
+		switch {
+		case exists && !existed:
+			log.Infof("Deleting %s...", referenceName)
+			response, err := pushService.githubEnterpriseClient.Git.DeleteRef(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, referenceName)
+			if err != nil {
+				return githubapiutil.EnrichResponseError(response, err, fmt.Sprintf("Error deleting %s.", referenceName))
+			}
+		case !exists && existed:
+			log.Infof("Restoring %s to %s...", referenceName, previousHash)
+			_, response, err := pushService.githubEnterpriseClient.Git.CreateRef(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, &github.Reference{
+				Ref:    github.String(referenceName),
+				Object: &github.GitObject{SHA: github.String(previousHash)},
+			})
+			if err != nil {
+				return githubapiutil.EnrichResponseError(response, err, fmt.Sprintf("Error restoring %s.", referenceName))
+			}
+		case currentHash != previousHash:
+			log.Infof("Moving %s back from %s to %s...", referenceName, currentHash, previousHash)
+			_, response, err := pushService.githubEnterpriseClient.Git.UpdateRef(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, &github.Reference{
+				Ref:    github.String(referenceName),
+				Object: &github.GitObject{SHA: github.String(previousHash)},
+			}, true)
+			if err != nil {
+				return githubapiutil.EnrichResponseError(response, err, fmt.Sprintf("Error moving %s.", referenceName))
+			}
+		}
+	}
+	return nil
+}
+
+func (pushService *pushService) rollback() error {
+	state, err := pushService.readRollbackState()
+	if err != nil {
+		return err
+	}
+	if state.RepositoryCreated {
+		return fmt.Errorf(errorRollbackCreatedRepository, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+	}
+	log.Infof("Rolling back %s/%s to its state before the push at %s...", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, state.RecordedAt.Format(time.RFC3339))
+	// Releases are removed first, because deleting a tag that a release points to would turn the release into a draft.
+	notRestorable, err := pushService.rollbackReleases(state)
+	if err != nil {
+		return err
+	}
+	err = pushService.rollbackReferences(state)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{pushService.pendingPushStatePath(), pushService.pushStatePath()} {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "Error removing push state.")
+		}
+	}
+	if len(notRestorable) != 0 {
+		return fmt.Errorf(errorAssetsNotRestorable, strings.Join(notRestorable, ", "))
+	}
+	return nil
+}
+
+// authenticate switches to the Actions admin user in the same cases as a push does, so that rollback has the same access to the destination repository. Unlike a push, it never creates anything.
+func (pushService *pushService) authenticate() error {
+	user, err := pushService.currentUser()
+	if err != nil {
+		return err
+	}
+	if pushService.destinationRepositoryOwner == user.GetLogin() || !pushService.supportsSiteAdministration() {
+		return nil
+	}
+	minimumRepositoryScope, _ := pushService.repositoryScopes()
+	return pushService.impersonateActionsAdminUserIfRequired(user, minimumRepositoryScope)
+}
+
+// Rollback only uses the state directory, destination settings and Actions admin user of the options.
+func Rollback(ctx context.Context, options Options) error {
+	pushService, err := newPushService(ctx, options)
+	if err != nil {
+		return err
+	}
+	err = pushService.authenticate()
+	if err != nil {
+		return err
+	}
+	err = pushService.rollback()
+	if err != nil {
+		return err
+	}
+	log.Infof("Finished rolling back %s!", options.DestinationRepository)
+	return nil
+}
@@ -0,0 +1,235 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type fakeDestination struct {
+	references map[string]string
+	releases   map[int64]string
+	assets     map[int64]map[int64]string
+}
+
+func serveFakeDestination(t *testing.T, githubTestServer *mux.Router, destination *fakeDestination) {
+	repositoryPath := "/api/v3/repos/destination-repository-owner/destination-repository-name"
+	githubTestServer.HandleFunc(repositoryPath+"/git/matching-refs/", func(response http.ResponseWriter, request *http.Request) {
+		references := []github.Reference{}
+		for name, sha := range destination.references {
+			references = append(references, github.Reference{Ref: github.String(name), Object: &github.GitObject{SHA: github.String(sha)}})
+		}
+		test.ServeHTTPResponseFromObject(t, references, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc(repositoryPath+"/git/refs", func(response http.ResponseWriter, request *http.Request) {
+		body := struct{ Ref, SHA string }{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		destination.references[body.Ref] = body.SHA
+		test.ServeHTTPResponseFromObject(t, github.Reference{}, response)
+	}).Methods("POST")
+	githubTestServer.HandleFunc(repositoryPath+"/git/refs/{ref:.+}", func(response http.ResponseWriter, request *http.Request) {
+		body := struct {
+			SHA   string
+			Force bool
+		}{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		require.True(t, body.Force)
+		destination.references["refs/"+mux.Vars(request)["ref"]] = body.SHA
+		test.ServeHTTPResponseFromObject(t, github.Reference{}, response)
+	}).Methods("PATCH")
+	githubTestServer.HandleFunc(repositoryPath+"/git/refs/{ref:.+}", func(response http.ResponseWriter, request *http.Request) {
+		delete(destination.references, "refs/"+mux.Vars(request)["ref"])
+		response.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	githubTestServer.HandleFunc(repositoryPath+"/releases", func(response http.ResponseWriter, request *http.Request) {
+		releases := []github.RepositoryRelease{}
+		for id, tagName := range destination.releases {
+			releases = append(releases, github.RepositoryRelease{ID: github.Int64(id), TagName: github.String(tagName)})
+		}
+		test.ServeHTTPResponseFromObject(t, releases, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc(repositoryPath+"/releases/{id:[0-9]+}", func(response http.ResponseWriter, request *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+		require.NoError(t, err)
+		delete(destination.releases, id)
+		response.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	githubTestServer.HandleFunc(repositoryPath+"/releases/{id:[0-9]+}/assets", func(response http.ResponseWriter, request *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+		require.NoError(t, err)
+		assets := []github.ReleaseAsset{}
+		for assetID, name := range destination.assets[id] {
+			assets = append(assets, github.ReleaseAsset{ID: github.Int64(assetID), Name: github.String(name)})
+		}
+		test.ServeHTTPResponseFromObject(t, assets, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc(repositoryPath+"/releases/assets/{id:[0-9]+}", func(response http.ResponseWriter, request *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+		require.NoError(t, err)
+		for _, assets := range destination.assets {
+			delete(assets, id)
+		}
+		response.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+}
+
+func TestRollback(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	destination := &fakeDestination{
+		references: map[string]string{
+			"refs/heads/main":                  "1111111111111111111111111111111111111111",
+			"refs/heads/v2":                    "2222222222222222222222222222222222222222",
+			"refs/heads/removed-upstream":      "3333333333333333333333333333333333333333",
+			"refs/tags/codeql-bundle-20200101": "4444444444444444444444444444444444444444",
+		},
+		releases: map[int64]string{1: "codeql-bundle-20200101"},
+		assets:   map[int64]map[int64]string{1: {10: "codeql-bundle.tar.gz"}},
+	}
+	serveFakeDestination(t, githubTestServer, destination)
+	require.NoError(t, pushService.recordPushState())
+
+	// Simulate a push.
+	destination.references["refs/heads/main"] = "5555555555555555555555555555555555555555"
+	destination.references["refs/heads/v2"] = "6666666666666666666666666666666666666666"
+	destination.references["refs/heads/v3"] = "7777777777777777777777777777777777777777"
+	destination.references["refs/tags/codeql-bundle-20200630"] = "8888888888888888888888888888888888888888"
+	delete(destination.references, "refs/heads/removed-upstream")
+	destination.releases[2] = "codeql-bundle-20200630"
+	destination.assets[1][11] = "codeql-bundle.tar.zst"
+	destination.assets[2] = map[int64]string{12: "codeql-bundle.tar.gz"}
+
+	require.NoError(t, pushService.rollback())
+	require.Equal(t, map[string]string{
+		"refs/heads/main":                  "1111111111111111111111111111111111111111",
+		"refs/heads/v2":                    "2222222222222222222222222222222222222222",
+		"refs/heads/removed-upstream":      "3333333333333333333333333333333333333333",
+		"refs/tags/codeql-bundle-20200101": "4444444444444444444444444444444444444444",
+	}, destination.references)
+	require.Equal(t, map[int64]string{1: "codeql-bundle-20200101"}, destination.releases)
+	require.Equal(t, map[int64]string{10: "codeql-bundle.tar.gz"}, destination.assets[1])
+
+	err := pushService.rollback()
+	require.EqualError(t, err, fmt.Sprintf("There is no record of a previous push to destination-repository-owner/destination-repository-name in the state directory %s, so there is nothing to roll back. Check that `--state-dir` is the same as it was for the push.", pushService.stateDirectory))
+}
+
+func TestRollbackImpersonatesActionsAdminUser(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.actionsAdminUser = "actions-admin"
+	client, err := github.NewEnterpriseClient(githubEnterpriseURL+"/api/v3", githubEnterpriseURL+"/api/uploads", oauth2.NewClient(pushService.ctx, oauth2.StaticTokenSource(pushService.destinationToken)))
+	require.NoError(t, err)
+	pushService.githubEnterpriseClient = client
+	destination := &fakeDestination{
+		references: map[string]string{"refs/heads/main": "5555555555555555555555555555555555555555"},
+		releases:   map[int64]string{},
+		assets:     map[int64]map[int64]string{},
+	}
+	serveFakeDestination(t, githubTestServer, destination)
+	// The site administrator is not a member of the organization, so only the Actions admin user can see the repository.
+	githubTestServer.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if strings.HasPrefix(request.URL.Path, "/api/v3/repos/") && request.Header.Get("Authorization") != "Bearer impersonation-token" {
+				response.WriteHeader(http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(response, request)
+		})
+	})
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("site-admin")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/orgs/destination-repository-owner/members/site-admin", func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("X-OAuth-Scopes", "repo, workflow, site_admin")
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/admin/users/actions-admin/authorizations", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.UserAuthorization{Token: github.String("impersonation-token")}, response)
+	}).Methods("POST")
+	require.NoError(t, writePushState(pushService.pushStatePath(), &pushState{
+		References: map[string]string{"refs/heads/main": "1111111111111111111111111111111111111111"},
+		Releases:   map[string][]recordedAsset{},
+	}))
+
+	require.Error(t, pushService.rollback())
+	require.NoError(t, pushService.authenticate())
+	require.NoError(t, pushService.rollback())
+	require.Equal(t, map[string]string{"refs/heads/main": "1111111111111111111111111111111111111111"}, destination.references)
+}
+
+func TestRollbackCreatedRepository(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	_, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.repositoryCreated = true
+	require.NoError(t, pushService.recordPushState())
+	err := pushService.rollback()
+	require.EqualError(t, err, "The repository destination-repository-owner/destination-repository-name was created by the last push, so there is no earlier state to roll back to. If you want to undo the push, delete the repository instead.")
+}
+
+func TestPushStateIsKeptUntilPushFinishes(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	destination := &fakeDestination{
+		references: map[string]string{"refs/heads/main": "1111111111111111111111111111111111111111"},
+		releases:   map[int64]string{},
+		assets:     map[int64]map[int64]string{},
+	}
+	serveFakeDestination(t, githubTestServer, destination)
+	stateDirectory := test.CreateTemporaryDirectory(t)
+
+	// The first push fails partway.
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.stateDirectory = stateDirectory
+	require.NoError(t, pushService.recordPushState())
+	destination.references["refs/heads/main"] = "2222222222222222222222222222222222222222"
+
+	// Running it again keeps the state from before the first push, and then finishes.
+	pushService = getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.stateDirectory = stateDirectory
+	require.NoError(t, pushService.recordPushState())
+	require.Equal(t, map[string]string{"refs/heads/main": "1111111111111111111111111111111111111111"}, pushService.previousState.References)
+	destination.references["refs/heads/v2"] = "3333333333333333333333333333333333333333"
+	require.NoError(t, pushService.finishPushState())
+
+	// A push that changes nothing does not replace the state either.
+	pushService = getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.stateDirectory = stateDirectory
+	require.NoError(t, pushService.recordPushState())
+	require.NoError(t, pushService.finishPushState())
+
+	require.NoError(t, pushService.rollback())
+	require.Equal(t, map[string]string{"refs/heads/main": "1111111111111111111111111111111111111111"}, destination.references)
+}
+
+func TestRollbackReportsReplacedAssets(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	destination := &fakeDestination{
+		references: map[string]string{"refs/tags/codeql-bundle-20200101": "1111111111111111111111111111111111111111"},
+		releases:   map[int64]string{1: "codeql-bundle-20200101"},
+		assets:     map[int64]map[int64]string{1: {10: "codeql-bundle.tar.gz", 11: "codeql-bundle.tar.zst"}},
+	}
+	serveFakeDestination(t, githubTestServer, destination)
+	require.NoError(t, pushService.recordPushState())
+
+	// Simulate a push that replaced an asset with a new upload under the same name.
+	delete(destination.assets[1], 10)
+	destination.assets[1][12] = "codeql-bundle.tar.gz"
+
+	err := pushService.rollback()
+	require.EqualError(t, err, "The rest of the push was rolled back, but these release assets were replaced or deleted by the push and cannot be restored, because the destination does not keep their earlier versions: codeql-bundle-20200101/codeql-bundle.tar.gz. Push them again from a cache that has the earlier versions if they are still needed.")
+	require.Equal(t, map[int64]string{11: "codeql-bundle.tar.zst", 12: "codeql-bundle.tar.gz"}, destination.assets[1])
+}
@@ -0,0 +1,79 @@
+package push
+
+import (
+	"fmt"
+
+	"github.com/github/codeql-action-sync/internal/githubapiutil"
+	"github.com/google/go-github/v32/github"
+	log "github.com/sirupsen/logrus"
+)
+
+const VisibilityPublic = "public"
+const VisibilityInternal = "internal"
+const VisibilityPrivate = "private"
+
+const ActionsAccessNone = "none"
+const ActionsAccessOrganization = "organization"
+const ActionsAccessEnterprise = "enterprise"
+
+const errorInvalidVisibility = "The repository visibility %s is not valid. It should be one of `public`, `internal` or `private`."
+const errorInvalidActionsAccess = "The Actions access level %s is not valid. It should be one of `none`, `organization` or `enterprise`."
+
+// RepositorySettings are applied to the destination repository each time it is pushed to. Empty values leave the defaults (for a new repository) or the existing settings unchanged.
+type RepositorySettings struct {
+	Visibility    string
+	Description   string
+	Topics        []string
+	ActionsAccess string
+}
+
+func (settings RepositorySettings) validate() error {
+	switch settings.Visibility {
+	case "", VisibilityPublic, VisibilityInternal, VisibilityPrivate:
+	default:
+		return fmt.Errorf(errorInvalidVisibility, settings.Visibility)
+	}
+	switch settings.ActionsAccess {
+	case "", ActionsAccessNone, ActionsAccessOrganization, ActionsAccessEnterprise:
+	default:
+		return fmt.Errorf(errorInvalidActionsAccess, settings.ActionsAccess)
+	}
+	return nil
+}
+
+type actionsAccessLevel struct {
+	AccessLevel string `json:"access_level"`
+}
+
+func (pushService *pushService) applyRepositorySettings() error {
+	settings := pushService.repositorySettings
+	if settings.Topics != nil {
+		log.Debug("Updating repository topics...")
+		_, response, err := pushService.githubEnterpriseClient.Repositories.ReplaceAllTopics(pushService.ctx, pushService.destinationRepositoryOwner, pushService.destinationRepositoryName, settings.Topics)
+		if err != nil {
+			return githubapiutil.EnrichResponseError(response, err, "Error updating repository topics.")
+		}
+	}
+	if settings.ActionsAccess != "" {
+		log.Debugf("Setting Actions access level to %s...", settings.ActionsAccess)
+		// This is not yet part of the go-github library, so we make the request ourselves.
+		url := fmt.Sprintf("repos/%s/%s/actions/permissions/access", pushService.destinationRepositoryOwner, pushService.destinationRepositoryName)
+		request, err := pushService.githubEnterpriseClient.NewRequest("PUT", url, &actionsAccessLevel{AccessLevel: settings.ActionsAccess})
+		if err != nil {
+			return githubapiutil.EnrichResponseError(nil, err, "Error constructing Actions access level request.")
+		}
+		response, err := pushService.githubEnterpriseClient.Do(pushService.ctx, request, nil)
+		if err != nil {
+			return githubapiutil.EnrichResponseError(response, err, "Error setting Actions access level.")
+		}
+	} else if pushService.repositoryVisibility() != VisibilityPublic {
+		log.Warnf("The repository is %s, so workflows in other repositories may not be able to use the CodeQL Action unless its Actions access level allows it (see `--actions-access`).", pushService.repositoryVisibility())
+	}
+	return nil
+}
+
+func (pushService *pushService) applyRepositoryProperties(properties *github.Repository) {
+	if pushService.repositorySettings.Description != "" {
+		properties.Description = github.String(pushService.repositorySettings.Description)
+	}
+}
@@ -0,0 +1,57 @@
+package push
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRepositoryAppliesRepositorySettings(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	githubTestServer, githubEnterpriseURL := test.GetTestHTTPServer(t)
+	pushService := getTestPushService(t, temporaryDirectory, githubEnterpriseURL)
+	pushService.repositorySettings = RepositorySettings{
+		Visibility:    VisibilityInternal,
+		Description:   "The CodeQL Action.",
+		Topics:        []string{"codeql", "security"},
+		ActionsAccess: ActionsAccessOrganization,
+	}
+	createdRepository := github.Repository{}
+	topics := struct{ Names []string }{}
+	accessLevel := actionsAccessLevel{}
+	githubTestServer.HandleFunc("/api/v3/user", func(response http.ResponseWriter, request *http.Request) {
+		test.ServeHTTPResponseFromObject(t, github.User{Login: github.String("destination-repository-owner")}, response)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name", func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	githubTestServer.HandleFunc("/api/v3/user/repos", func(response http.ResponseWriter, request *http.Request) {
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&createdRepository))
+		test.ServeHTTPResponseFromObject(t, github.Repository{}, response)
+	}).Methods("POST")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/topics", func(response http.ResponseWriter, request *http.Request) {
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&topics))
+		test.ServeHTTPResponseFromObject(t, topics, response)
+	}).Methods("PUT")
+	githubTestServer.HandleFunc("/api/v3/repos/destination-repository-owner/destination-repository-name/actions/permissions/access", func(response http.ResponseWriter, request *http.Request) {
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&accessLevel))
+		response.WriteHeader(http.StatusNoContent)
+	}).Methods("PUT")
+	_, err := pushService.createRepository()
+	require.NoError(t, err)
+	require.Equal(t, VisibilityInternal, createdRepository.GetVisibility())
+	require.Equal(t, "The CodeQL Action.", createdRepository.GetDescription())
+	require.Equal(t, []string{"codeql", "security"}, topics.Names)
+	require.Equal(t, ActionsAccessOrganization, accessLevel.AccessLevel)
+}
+
+func TestRepositorySettingsValidation(t *testing.T) {
+	require.NoError(t, RepositorySettings{}.validate())
+	require.NoError(t, RepositorySettings{Visibility: VisibilityPrivate, ActionsAccess: ActionsAccessEnterprise}.validate())
+	require.EqualError(t, RepositorySettings{Visibility: "secret"}.validate(), "The repository visibility secret is not valid. It should be one of `public`, `internal` or `private`.")
+	require.EqualError(t, RepositorySettings{ActionsAccess: "everyone"}.validate(), "The Actions access level everyone is not valid. It should be one of `none`, `organization` or `enterprise`.")
+}
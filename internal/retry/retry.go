@@ -0,0 +1,129 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/metrics"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type Policy struct {
+	MaxAttempts          int
+	InitialBackoff       time.Duration
+	MaxBackoff           time.Duration
+	Jitter               float64
+	RetryableStatusCodes []int
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// StatusError reports an unexpected HTTP status code from a request not made through go-github, so that the policy can decide whether it is worth retrying.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("%s (status code %d)", err.Message, err.StatusCode)
+}
+
+func (policy Policy) IsRetryableStatusCode(statusCode int) bool {
+	for _, retryableStatusCode := range policy.RetryableStatusCodes {
+		if statusCode == retryableStatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy Policy) IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// go-git does not allow unwrapping its unexpected errors, which is where it puts unexpected HTTP status codes.
+	if unexpectedError := new(plumbing.UnexpectedError); errors.As(err, &unexpectedError) {
+		err = unexpectedError.Err
+	}
+	if githubErrorResponse := new(github.ErrorResponse); errors.As(err, &githubErrorResponse) {
+		return githubErrorResponse.Response != nil && policy.IsRetryableStatusCode(githubErrorResponse.Response.StatusCode)
+	}
+	if statusError := new(StatusError); errors.As(err, &statusError) {
+		return policy.IsRetryableStatusCode(statusError.StatusCode)
+	}
+	var statusCodeError interface{ StatusCode() int }
+	if errors.As(err, &statusCodeError) {
+		return policy.IsRetryableStatusCode(statusCodeError.StatusCode())
+	}
+	if opError := new(net.OpError); errors.As(err, &opError) {
+		return true
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Backoff returns how long to wait after the given (1-based) failed attempt.
+func (policy Policy) Backoff(attempt int) time.Duration {
+	backoff := float64(policy.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+	backoff = backoff * (1 + policy.Jitter*(2*rand.Float64()-1))
+	if backoff < 0 {
+		return 0
+	}
+	return time.Duration(backoff)
+}
+
+func (policy Policy) Do(ctx context.Context, description string, operation func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.IsRetryable(err) {
+			return err
+		}
+		backoff := policy.Backoff(attempt)
+		log.Warnf("Attempt %d of %d to %s failed (%s), retrying in %s...", attempt, policy.MaxAttempts, description, err.Error(), backoff.Round(time.Millisecond))
+		metrics.Retries.Add(1)
+		err = Sleep(ctx, backoff)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
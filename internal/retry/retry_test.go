@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/github/codeql-action-sync/test"
+	"github.com/google/go-github/v32/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestPolicy() Policy {
+	policy := DefaultPolicy()
+	policy.MaxAttempts = 3
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+	return policy
+}
+
+func TestIsRetryable(t *testing.T) {
+	policy := getTestPolicy()
+	require.False(t, policy.IsRetryable(nil))
+	require.False(t, policy.IsRetryable(errors.New("Something went wrong.")))
+	require.False(t, policy.IsRetryable(errors.Wrap(context.Canceled, "Cancelled.")))
+	require.True(t, policy.IsRetryable(errors.Wrap(&StatusError{StatusCode: http.StatusBadGateway, Message: "Bad gateway"}, "Error downloading asset.")))
+	require.False(t, policy.IsRetryable(&StatusError{StatusCode: http.StatusNotFound, Message: "Not found"}))
+	require.True(t, policy.IsRetryable(errors.Wrap(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}, "Error creating release.")))
+	require.False(t, policy.IsRetryable(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}}))
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, time.Second, policy.Backoff(1))
+	require.Equal(t, 2*time.Second, policy.Backoff(2))
+	require.Equal(t, 4*time.Second, policy.Backoff(3))
+	require.Equal(t, 5*time.Second, policy.Backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		require.GreaterOrEqual(t, int64(policy.Backoff(2)), int64(time.Second))
+		require.LessOrEqual(t, int64(policy.Backoff(2)), int64(3*time.Second))
+	}
+}
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	attempts := 0
+	err := getTestPolicy().Do(context.Background(), "do something", func() error {
+		attempts++
+		if attempts < 3 {
+			return &StatusError{StatusCode: http.StatusBadGateway, Message: "Bad gateway"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	attempts := 0
+	err := getTestPolicy().Do(context.Background(), "do something", func() error {
+		attempts++
+		return &StatusError{StatusCode: http.StatusBadGateway, Message: "Bad gateway"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 3, attempts)
+}
+
+func TestDoDoesNotRetryPermanentErrors(t *testing.T) {
+	attempts := 0
+	err := getTestPolicy().Do(context.Background(), "do something", func() error {
+		attempts++
+		return errors.New("Something went wrong.")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+}
+
+func TestTransportRetriesRetryableStatusCodes(t *testing.T) {
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	attempts := 0
+	githubTestServer.HandleFunc("/resource", func(response http.ResponseWriter, request *http.Request) {
+		attempts++
+		if attempts == 1 {
+			response.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		test.ServeHTTPResponseFromString(t, "{}", response)
+	}).Methods("GET")
+
+	client := &http.Client{Transport: NewTransport(nil, getTestPolicy())}
+	response, err := client.Get(githubURL + "/resource")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, 2, attempts)
+}
+
+func TestTransportDoesNotRetryWithoutRetries(t *testing.T) {
+	githubTestServer, githubURL := test.GetTestHTTPServer(t)
+	attempts := 0
+	githubTestServer.HandleFunc("/resource", func(response http.ResponseWriter, request *http.Request) {
+		attempts++
+		response.WriteHeader(http.StatusBadGateway)
+	}).Methods("GET")
+
+	request, err := http.NewRequestWithContext(WithoutRetries(context.Background()), "GET", githubURL+"/resource", nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: NewTransport(nil, getTestPolicy())}
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, response.StatusCode)
+	require.Equal(t, 1, attempts)
+}
@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/github/codeql-action-sync/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+type withoutRetriesKey struct{}
+
+// WithoutRetries returns a context whose requests are only attempted once by the transport, for requests made by an operation that is already retried as a whole with Do.
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutRetriesKey{}, true)
+}
+
+type transport struct {
+	base   http.RoundTripper
+	policy Policy
+}
+
+// NewTransport wraps an HTTP transport so that requests are retried according to the policy. Requests with a body that cannot be rewound are only attempted once.
+func NewTransport(base http.RoundTripper, policy Policy) http.RoundTripper {
+	return &transport{
+		base:   base,
+		policy: policy,
+	}
+}
+
+func (transport *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for attempt := 1; ; attempt++ {
+		response, err := base.RoundTrip(request)
+		canRetry := attempt < transport.policy.MaxAttempts && (request.Body == nil || request.GetBody != nil) && request.Context().Value(withoutRetriesKey{}) == nil
+		if err != nil {
+			if !canRetry || !transport.policy.IsRetryable(err) {
+				return response, err
+			}
+		} else {
+			if !canRetry || !transport.policy.IsRetryableStatusCode(response.StatusCode) {
+				return response, nil
+			}
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+			err = &StatusError{StatusCode: response.StatusCode, Message: "Unexpected response"}
+		}
+		backoff := transport.policy.Backoff(attempt)
+		log.Warnf("Attempt %d of %d to request %s %s failed (%s), retrying in %s...", attempt, transport.policy.MaxAttempts, request.Method, request.URL, err.Error(), backoff.Round(time.Millisecond))
+		metrics.Retries.Add(1)
+		err = Sleep(request.Context(), backoff)
+		if err != nil {
+			return nil, err
+		}
+		request, err = RewindRequest(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RewindRequest makes a copy of a request that can be sent again, including a fresh copy of its body.
+func RewindRequest(request *http.Request) (*http.Request, error) {
+	rewoundRequest := request.Clone(request.Context())
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		rewoundRequest.Body = body
+	}
+	return rewoundRequest, nil
+}
@@ -0,0 +1,202 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	usererrors "errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const pgpPublicKeyBlockHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+const pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+const sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+const sshSignatureFooter = "-----END SSH SIGNATURE-----"
+
+// The magic preamble of SSH signatures (see https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig), and the namespace Git uses for them.
+const sshSignatureMagic = "SSHSIG"
+const gitNamespace = "git"
+
+var ErrUnsigned = usererrors.New("it is not signed")
+
+// Keyring holds the keys that signatures on the source repository are trusted from.
+type Keyring struct {
+	pgpKeys openpgp.EntityList
+	sshKeys []ssh.PublicKey
+}
+
+// LoadKeyring reads trusted keys from files that contain either an armored PGP public key block (e.g. from https://github.com/web-flow.gpg) or SSH public keys, one per line, in `authorized_keys` or `allowed_signers` format.
+func LoadKeyring(paths []string) (*Keyring, error) {
+	keyring := Keyring{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error reading trusted keys from %s.", path)
+		}
+		if strings.Contains(string(content), pgpPublicKeyBlockHeader) {
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error parsing PGP keys from %s.", path)
+			}
+			keyring.pgpKeys = append(keyring.pgpKeys, entities...)
+			continue
+		}
+		rest := content
+		for len(bytes.TrimSpace(rest)) != 0 {
+			publicKey, _, _, remaining, err := ssh.ParseAuthorizedKey(rest)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error parsing SSH keys from %s.", path)
+			}
+			keyring.sshKeys = append(keyring.sshKeys, publicKey)
+			rest = remaining
+		}
+	}
+	return &keyring, nil
+}
+
+func (keyring *Keyring) IsEmpty() bool {
+	return len(keyring.pgpKeys) == 0 && len(keyring.sshKeys) == 0
+}
+
+func encodedPayload(encode func(plumbing.EncodedObject) error) ([]byte, error) {
+	payload := &plumbing.MemoryObject{}
+	err := encode(payload)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := payload.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// VerifyCommit checks the signature on a commit and returns a description of the key that made it.
+func (keyring *Keyring) VerifyCommit(commit *object.Commit) (string, error) {
+	payload, err := encodedPayload(commit.EncodeWithoutSignature)
+	if err != nil {
+		return "", errors.Wrap(err, "Error encoding commit.")
+	}
+	return keyring.Verify(payload, commit.PGPSignature, gitNamespace)
+}
+
+// VerifyTag checks the signature on an annotated tag and returns a description of the key that made it.
+func (keyring *Keyring) VerifyTag(tag *object.Tag) (string, error) {
+	payload, err := encodedPayload(tag.EncodeWithoutSignature)
+	if err != nil {
+		return "", errors.Wrap(err, "Error encoding tag.")
+	}
+	return keyring.Verify(payload, tag.PGPSignature, gitNamespace)
+}
+
+// Verify checks an armored PGP or SSH signature over a payload and returns a description of the key that made it. The namespace is only used by SSH signatures.
+func (keyring *Keyring) Verify(payload []byte, signature string, namespace string) (string, error) {
+	signature = strings.TrimSpace(signature)
+	switch {
+	case signature == "":
+		return "", ErrUnsigned
+	case strings.HasPrefix(signature, pgpSignatureHeader):
+		entity, err := openpgp.CheckArmoredDetachedSignature(keyring.pgpKeys, bytes.NewReader(payload), strings.NewReader(signature), nil)
+		if err != nil {
+			return "", errors.Wrap(err, "its PGP signature is not valid or is not from a trusted key")
+		}
+		for name := range entity.Identities {
+			return fmt.Sprintf("%s (%s)", name, entity.PrimaryKey.KeyIdString()), nil
+		}
+		return entity.PrimaryKey.KeyIdString(), nil
+	case strings.HasPrefix(signature, sshSignatureHeader):
+		publicKey, err := keyring.verifySSH(payload, signature, namespace)
+		if err != nil {
+			return "", errors.Wrap(err, "its SSH signature is not valid or is not from a trusted key")
+		}
+		return ssh.FingerprintSHA256(publicKey), nil
+	default:
+		return "", usererrors.New("it has a signature of an unsupported type")
+	}
+}
+
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sshSignedData struct {
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func (keyring *Keyring) verifySSH(payload []byte, armoredSignature string, namespace string) (ssh.PublicKey, error) {
+	encoded := strings.TrimSuffix(strings.TrimPrefix(armoredSignature, sshSignatureHeader), sshSignatureFooter)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid encoding")
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSignatureMagic)) {
+		return nil, usererrors.New("invalid preamble")
+	}
+	signature := sshSignature{}
+	err = ssh.Unmarshal(blob[len(sshSignatureMagic):], &signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid format")
+	}
+	if signature.Version != 1 || signature.Namespace != namespace {
+		return nil, fmt.Errorf("unsupported version %d or namespace %s", signature.Version, signature.Namespace)
+	}
+	publicKey, err := ssh.ParsePublicKey(signature.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+	trusted := false
+	for _, trustedKey := range keyring.sshKeys {
+		if bytes.Equal(trustedKey.Marshal(), publicKey.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return nil, fmt.Errorf("untrusted key %s", ssh.FingerprintSHA256(publicKey))
+	}
+	var hasher hash.Hash
+	switch signature.HashAlgorithm {
+	case "sha256":
+		hasher = sha256.New()
+	case "sha512":
+		hasher = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %s", signature.HashAlgorithm)
+	}
+	hasher.Write(payload)
+	signedData := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     signature.Namespace,
+		Reserved:      signature.Reserved,
+		HashAlgorithm: signature.HashAlgorithm,
+		Hash:          hasher.Sum(nil),
+	})...)
+	sshSignatureValue := ssh.Signature{}
+	err = ssh.Unmarshal(signature.Signature, &sshSignatureValue)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+	err = publicKey.Verify(signedData, &sshSignatureValue)
+	if err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
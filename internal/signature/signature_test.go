@@ -0,0 +1,170 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func getTestCommit() *object.Commit {
+	signature := object.Signature{Name: "Someone", Email: "someone@example.com", When: time.Unix(1600000000, 0)}
+	return &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   "A commit.",
+		TreeHash:  plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+	}
+}
+
+func commitPayload(t *testing.T, commit *object.Commit) []byte {
+	payload := &plumbing.MemoryObject{}
+	require.NoError(t, commit.EncodeWithoutSignature(payload))
+	reader, err := payload.Reader()
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return content
+}
+
+func writePGPKey(t *testing.T, directory string, entity *openpgp.Entity) string {
+	buffer := &bytes.Buffer{}
+	writer, err := armor.Encode(buffer, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(writer))
+	require.NoError(t, writer.Close())
+	keyPath := path.Join(directory, "key.asc")
+	require.NoError(t, ioutil.WriteFile(keyPath, buffer.Bytes(), 0644))
+	return keyPath
+}
+
+func signSSH(t *testing.T, signer ssh.Signer, payload []byte) string {
+	signature, err := (&Signer{sshKey: signer}).Sign(payload, gitNamespace)
+	require.NoError(t, err)
+	return signature
+}
+
+func TestVerifyCommitWithPGP(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	entity, err := openpgp.NewEntity("Trusted", "", "trusted@example.com", nil)
+	require.NoError(t, err)
+	keyring, err := LoadKeyring([]string{writePGPKey(t, temporaryDirectory, entity)})
+	require.NoError(t, err)
+
+	commit := getTestCommit()
+	_, err = keyring.VerifyCommit(commit)
+	require.Equal(t, ErrUnsigned, err)
+
+	signature := &bytes.Buffer{}
+	require.NoError(t, openpgp.ArmoredDetachSign(signature, entity, bytes.NewReader(commitPayload(t, commit)), nil))
+	commit.PGPSignature = signature.String()
+	signer, err := keyring.VerifyCommit(commit)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(signer, "Trusted <trusted@example.com>"))
+
+	commit.Message = "A tampered commit."
+	_, err = keyring.VerifyCommit(commit)
+	require.Error(t, err)
+
+	untrustedEntity, err := openpgp.NewEntity("Untrusted", "", "untrusted@example.com", nil)
+	require.NoError(t, err)
+	commit = getTestCommit()
+	signature = &bytes.Buffer{}
+	require.NoError(t, openpgp.ArmoredDetachSign(signature, untrustedEntity, bytes.NewReader(commitPayload(t, commit)), nil))
+	commit.PGPSignature = signature.String()
+	_, err = keyring.VerifyCommit(commit)
+	require.Error(t, err)
+}
+
+func TestVerifyCommitWithSSH(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	require.NoError(t, err)
+	keyPath := path.Join(temporaryDirectory, "allowed_signers")
+	require.NoError(t, ioutil.WriteFile(keyPath, []byte("trusted@example.com "+string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), 0644))
+	keyring, err := LoadKeyring([]string{keyPath})
+	require.NoError(t, err)
+
+	commit := getTestCommit()
+	commit.PGPSignature = signSSH(t, signer, commitPayload(t, commit))
+	fingerprint, err := keyring.VerifyCommit(commit)
+	require.NoError(t, err)
+	require.Equal(t, ssh.FingerprintSHA256(signer.PublicKey()), fingerprint)
+
+	commit.Message = "A tampered commit."
+	_, err = keyring.VerifyCommit(commit)
+	require.Error(t, err)
+
+	_, untrustedPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	untrustedSigner, err := ssh.NewSignerFromKey(untrustedPrivateKey)
+	require.NoError(t, err)
+	commit = getTestCommit()
+	commit.PGPSignature = signSSH(t, untrustedSigner, commitPayload(t, commit))
+	_, err = keyring.VerifyCommit(commit)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "untrusted key")
+}
+
+func TestSignAndVerifyWithLoadedKeys(t *testing.T) {
+	temporaryDirectory := test.CreateTemporaryDirectory(t)
+	payload := []byte("Some content.")
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateKeyBlock, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	privateKeyPath := path.Join(temporaryDirectory, "id_ed25519")
+	require.NoError(t, ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(privateKeyBlock), 0600))
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	publicKeyPath := path.Join(temporaryDirectory, "id_ed25519.pub")
+	require.NoError(t, ioutil.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(sshPublicKey), 0644))
+
+	signer, err := LoadSigner(privateKeyPath)
+	require.NoError(t, err)
+	signature, err := signer.Sign(payload, "some-namespace")
+	require.NoError(t, err)
+	keyring, err := LoadKeyring([]string{publicKeyPath})
+	require.NoError(t, err)
+	_, err = keyring.Verify(payload, signature, "some-namespace")
+	require.NoError(t, err)
+	_, err = keyring.Verify(payload, signature, "another-namespace")
+	require.Error(t, err)
+
+	entity, err := openpgp.NewEntity("Signer", "", "signer@example.com", nil)
+	require.NoError(t, err)
+	buffer := &bytes.Buffer{}
+	writer, err := armor.Encode(buffer, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(writer, nil))
+	require.NoError(t, writer.Close())
+	pgpPrivateKeyPath := path.Join(temporaryDirectory, "private.asc")
+	require.NoError(t, ioutil.WriteFile(pgpPrivateKeyPath, buffer.Bytes(), 0600))
+
+	signer, err = LoadSigner(pgpPrivateKeyPath)
+	require.NoError(t, err)
+	signature, err = signer.Sign(payload, "some-namespace")
+	require.NoError(t, err)
+	keyring, err = LoadKeyring([]string{writePGPKey(t, temporaryDirectory, entity)})
+	require.NoError(t, err)
+	_, err = keyring.Verify(payload, signature, "some-namespace")
+	require.NoError(t, err)
+	_, err = keyring.Verify([]byte("Some other content."), signature, "some-namespace")
+	require.Error(t, err)
+}
@@ -0,0 +1,428 @@
+package transfer
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const indexVersion = 1
+const indexFileName = "codeql-action-sync-cache.json"
+const volumeFileNameFormat = "codeql-action-sync-cache.tar.%03d"
+
+const errorInvalidVolumeSize = "The volume size %s is not valid. It should be a number of bytes, optionally followed by a unit such as `M`, `G`, `MiB` or `GiB`."
+const errorOutputNotEmpty = "The output directory %s already contains an exported cache. Please choose an empty directory."
+const errorImportIntoExistingCache = "The cache directory %s is not empty. Please choose an empty or non-existent cache directory to import into."
+const errorIndexMissing = "The directory %s does not contain an exported cache. The file " + indexFileName + " is missing."
+const errorVolumesMissing = "Some volumes of the exported cache are missing: %s."
+const errorVolumeWrongSize = "Volume %s is %d bytes, but should be %d bytes. It may have been truncated or corrupted."
+const errorVolumeReordered = "Volume %s contains the data for volume %s. The volumes may have been renamed or reordered."
+const errorVolumeCorrupt = "The checksum of volume %s does not match. It may have been corrupted."
+const errorUnsupportedEntry = "The exported cache contains an unsupported entry %s."
+const errorOutputInsideCache = "The output directory %s is inside the cache directory %s. Please choose a directory outside the cache."
+
+var unitMultipliers = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1000,
+	"KB":  1000,
+	"KiB": 1 << 10,
+	"M":   1000 * 1000,
+	"MB":  1000 * 1000,
+	"MiB": 1 << 20,
+	"G":   1000 * 1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"GiB": 1 << 30,
+}
+
+// ParseVolumeSize parses a size such as `4G` (4,000,000,000 bytes) or `512MiB`.
+func ParseVolumeSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	numberEnd := strings.IndexFunc(size, func(character rune) bool {
+		return character < '0' || character > '9'
+	})
+	if numberEnd == -1 {
+		numberEnd = len(size)
+	}
+	number, err := strconv.ParseInt(size[:numberEnd], 10, 64)
+	multiplier, known := unitMultipliers[strings.TrimSpace(size[numberEnd:])]
+	if err != nil || !known || number <= 0 {
+		return 0, fmt.Errorf(errorInvalidVolumeSize, size)
+	}
+	return number * multiplier, nil
+}
+
+// Index describes the volumes of an exported cache, in order.
+type Index struct {
+	Version     int      `json:"version"`
+	ToolVersion string   `json:"tool_version"`
+	VolumeSize  int64    `json:"volume_size"`
+	TotalSize   int64    `json:"total_size"`
+	Volumes     []Volume `json:"volumes"`
+}
+
+type Volume struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// volumeWriter splits everything written to it into files of at most volumeSize bytes, recording the size and checksum of each.
+type volumeWriter struct {
+	outputDirectory string
+	volumeSize      int64
+	volumes         []Volume
+	file            *os.File
+	hash            hash.Hash
+}
+
+func (writer *volumeWriter) closeVolume() error {
+	if writer.file == nil {
+		return nil
+	}
+	err := writer.file.Close()
+	writer.file = nil
+	if err != nil {
+		return errors.Wrap(err, "Error closing volume.")
+	}
+	volume := &writer.volumes[len(writer.volumes)-1]
+	volume.SHA256 = hex.EncodeToString(writer.hash.Sum(nil))
+	log.Infof("Wrote volume %s (%d bytes).", volume.Name, volume.Size)
+	return nil
+}
+
+func (writer *volumeWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) != 0 {
+		if writer.file == nil || writer.volumes[len(writer.volumes)-1].Size == writer.volumeSize {
+			err := writer.closeVolume()
+			if err != nil {
+				return written, err
+			}
+			name := fmt.Sprintf(volumeFileNameFormat, len(writer.volumes)+1)
+			file, err := os.Create(filepath.Join(writer.outputDirectory, name))
+			if err != nil {
+				return written, errors.Wrap(err, "Error creating volume.")
+			}
+			writer.file = file
+			writer.hash = sha256.New()
+			writer.volumes = append(writer.volumes, Volume{Name: name})
+		}
+		volume := &writer.volumes[len(writer.volumes)-1]
+		chunk := data
+		if remaining := writer.volumeSize - volume.Size; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := writer.file.Write(chunk)
+		writer.hash.Write(chunk[:n])
+		volume.Size += int64(n)
+		written += n
+		if err != nil {
+			return written, errors.Wrap(err, "Error writing volume.")
+		}
+		data = data[n:]
+	}
+	return written, nil
+}
+
+func addToArchive(archive *tar.Writer, root string, path string, info os.FileInfo) error {
+	relativePath, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if relativePath == "." {
+		return nil
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return fmt.Errorf(errorUnsupportedEntry, relativePath)
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return errors.Wrap(err, "Error creating archive header.")
+	}
+	header.Name = filepath.ToSlash(relativePath)
+	err = archive.WriteHeader(header)
+	if err != nil {
+		return errors.Wrap(err, "Error writing archive header.")
+	}
+	if info.IsDir() {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Error opening %s.", relativePath)
+	}
+	defer file.Close()
+	_, err = io.Copy(archive, file)
+	if err != nil {
+		return errors.Wrapf(err, "Error archiving %s.", relativePath)
+	}
+	return nil
+}
+
+func isInside(path string, directory string) (bool, error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return false, errors.Wrap(err, "Error resolving path.")
+	}
+	absoluteDirectory, err := filepath.Abs(directory)
+	if err != nil {
+		return false, errors.Wrap(err, "Error resolving path.")
+	}
+	relativePath, err := filepath.Rel(absoluteDirectory, absolutePath)
+	if err != nil {
+		return false, nil
+	}
+	return relativePath == "." || (relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(os.PathSeparator))), nil
+}
+
+// Export writes the cache directory to a tar archive split into numbered volumes of at most volumeSize bytes, along with an index of their checksums.
+func Export(cacheDirectory cachedirectory.CacheDirectory, outputDirectory string, volumeSize int64) error {
+	err := cacheDirectory.CheckOrCreateVersionFile(false, version.Version())
+	if err != nil {
+		return err
+	}
+	err = cacheDirectory.CheckLock()
+	if err != nil {
+		return err
+	}
+	root := cacheDirectory.Path()
+	inside, err := isInside(outputDirectory, root)
+	if err != nil {
+		return err
+	}
+	if inside {
+		return fmt.Errorf(errorOutputInsideCache, outputDirectory, root)
+	}
+	err = os.MkdirAll(outputDirectory, 0755)
+	if err != nil {
+		return errors.Wrap(err, "Error creating output directory.")
+	}
+	_, err = os.Stat(filepath.Join(outputDirectory, indexFileName))
+	if err == nil {
+		return fmt.Errorf(errorOutputNotEmpty, outputDirectory)
+	}
+
+	writer := &volumeWriter{outputDirectory: outputDirectory, volumeSize: volumeSize}
+	archive := tar.NewWriter(writer)
+	// Partial downloads are useless without the network, so they don't cross the gap.
+	excludedPaths := map[string]bool{
+		filepath.Clean(cacheDirectory.PartialDownloadsPath()): true,
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if excludedPaths[path] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return addToArchive(archive, root, path, info)
+	})
+	if err != nil {
+		return err
+	}
+	err = archive.Close()
+	if err != nil {
+		return errors.Wrap(err, "Error finishing archive.")
+	}
+	err = writer.closeVolume()
+	if err != nil {
+		return err
+	}
+
+	index := Index{
+		Version:     indexVersion,
+		ToolVersion: version.Version(),
+		VolumeSize:  volumeSize,
+		Volumes:     writer.volumes,
+	}
+	for _, volume := range writer.volumes {
+		index.TotalSize += volume.Size
+	}
+	indexJSON, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error converting index to JSON.")
+	}
+	// The index is written last, so that an interrupted export can't be mistaken for a complete one.
+	err = ioutil.WriteFile(filepath.Join(outputDirectory, indexFileName), indexJSON, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Error writing index.")
+	}
+	log.Infof("Exported the cache to %d volumes in %s.", len(index.Volumes), outputDirectory)
+	return nil
+}
+
+func digestVolume(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "Error opening volume.")
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "Error reading volume.")
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func readIndex(inputDirectory string) (*Index, error) {
+	indexJSON, err := ioutil.ReadFile(filepath.Join(inputDirectory, indexFileName))
+	if os.IsNotExist(err) {
+		return nil, errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorIndexMissing, inputDirectory)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading index.")
+	}
+	index := Index{}
+	err = json.Unmarshal(indexJSON, &index)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing index.")
+	}
+	if index.Version != indexVersion {
+		return nil, fmt.Errorf("The exported cache has an unsupported index version %d.", index.Version)
+	}
+	return &index, nil
+}
+
+// VerifyVolumes checks that every volume listed in the index is present and has the expected checksum.
+func VerifyVolumes(inputDirectory string) (*Index, error) {
+	index, err := readIndex(inputDirectory)
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for _, volume := range index.Volumes {
+		_, err := os.Stat(filepath.Join(inputDirectory, volume.Name))
+		if os.IsNotExist(err) {
+			missing = append(missing, volume.Name)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Error checking volume.")
+		}
+	}
+	if len(missing) != 0 {
+		return nil, errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorVolumesMissing, strings.Join(missing, ", "))
+	}
+	for position, volume := range index.Volumes {
+		log.Debugf("Verifying volume %s (%d/%d)...", volume.Name, position+1, len(index.Volumes))
+		size, digest, err := digestVolume(filepath.Join(inputDirectory, volume.Name))
+		if err != nil {
+			return nil, err
+		}
+		if digest == volume.SHA256 {
+			continue
+		}
+		for _, otherVolume := range index.Volumes {
+			if otherVolume.SHA256 == digest {
+				return nil, errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorVolumeReordered, volume.Name, otherVolume.Name)
+			}
+		}
+		if size != volume.Size {
+			return nil, errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorVolumeWrongSize, volume.Name, size, volume.Size)
+		}
+		return nil, errorcategory.Errorf(errorcategory.ErrCacheInvalid, errorVolumeCorrupt, volume.Name)
+	}
+	return index, nil
+}
+
+// Import verifies the volumes of an exported cache and then reassembles and extracts them into an empty cache directory.
+func Import(cacheDirectory cachedirectory.CacheDirectory, inputDirectory string) error {
+	root := cacheDirectory.Path()
+	entries, err := ioutil.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Error reading cache directory.")
+	}
+	if len(entries) != 0 {
+		return fmt.Errorf(errorImportIntoExistingCache, root)
+	}
+
+	index, err := VerifyVolumes(inputDirectory)
+	if err != nil {
+		return err
+	}
+	readers := []io.Reader{}
+	for _, volume := range index.Volumes {
+		file, err := os.Open(filepath.Join(inputDirectory, volume.Name))
+		if err != nil {
+			return errors.Wrap(err, "Error opening volume.")
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return errors.Wrap(err, "Error creating cache directory.")
+	}
+	archive := tar.NewReader(io.MultiReader(readers...))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "Error reading archive.")
+		}
+		err = extractEntry(archive, root, header)
+		if err != nil {
+			return err
+		}
+	}
+	log.Infof("Imported the cache from %d volumes into %s.", len(index.Volumes), root)
+	return nil
+}
+
+func extractEntry(archive *tar.Reader, root string, header *tar.Header) error {
+	path := filepath.Join(root, filepath.FromSlash(header.Name))
+	// Refuse anything that would be extracted outside the cache directory.
+	if !strings.HasPrefix(path, filepath.Clean(root)+string(os.PathSeparator)) {
+		return fmt.Errorf(errorUnsupportedEntry, header.Name)
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		err := os.MkdirAll(path, 0755)
+		if err != nil {
+			return errors.Wrap(err, "Error creating directory.")
+		}
+	case tar.TypeReg:
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return errors.Wrap(err, "Error creating directory.")
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return errors.Wrapf(err, "Error creating %s.", header.Name)
+		}
+		_, err = io.Copy(file, archive)
+		if err != nil {
+			file.Close()
+			return errors.Wrapf(err, "Error extracting %s.", header.Name)
+		}
+		// Closing can report a failed write that was buffered, for example on removable media.
+		err = file.Close()
+		if err != nil {
+			return errors.Wrapf(err, "Error extracting %s.", header.Name)
+		}
+	default:
+		return fmt.Errorf(errorUnsupportedEntry, header.Name)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package transfer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/github/codeql-action-sync/internal/cachedirectory"
+	"github.com/github/codeql-action-sync/internal/version"
+	"github.com/github/codeql-action-sync/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVolumeSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"1024":   1024,
+		"4G":     4000000000,
+		"4GB":    4000000000,
+		"512MiB": 512 * 1024 * 1024,
+		"10 K":   10000,
+	} {
+		actual, err := ParseVolumeSize(size)
+		require.NoError(t, err, size)
+		require.Equal(t, expected, actual, size)
+	}
+	for _, size := range []string{"", "G", "0", "-1G", "4X"} {
+		_, err := ParseVolumeSize(size)
+		require.EqualError(t, err, fmt.Sprintf(errorInvalidVolumeSize, size))
+	}
+}
+
+func createTestCache(t *testing.T) cachedirectory.CacheDirectory {
+	cacheDirectory := cachedirectory.NewCacheDirectory(filepath.Join(test.CreateTemporaryDirectory(t), "cache"))
+	require.NoError(t, cacheDirectory.CheckOrCreateVersionFile(true, version.Version()))
+	require.NoError(t, os.MkdirAll(cacheDirectory.AssetsPath("codeql-bundle-20200101"), 0755))
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.AssetPath("codeql-bundle-20200101", "codeql-bundle.tar.gz"), []byte(strings.Repeat("Not really a bundle. ", 500)), 0644))
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.MetadataPath("codeql-bundle-20200101"), []byte(`{"tag_name": "codeql-bundle-20200101"}`), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDirectory.GitPath(), "objects"), 0755))
+	return cacheDirectory
+}
+
+func exportTestCache(t *testing.T) (cachedirectory.CacheDirectory, string, *Index) {
+	cacheDirectory := createTestCache(t)
+	outputDirectory := filepath.Join(test.CreateTemporaryDirectory(t), "export")
+	require.NoError(t, Export(cacheDirectory, outputDirectory, 4096))
+	index, err := readIndex(outputDirectory)
+	require.NoError(t, err)
+	return cacheDirectory, outputDirectory, index
+}
+
+func TestExportAndImport(t *testing.T) {
+	cacheDirectory, outputDirectory, index := exportTestCache(t)
+	require.Len(t, index.Volumes, 5)
+	for position, volume := range index.Volumes {
+		require.Equal(t, fmt.Sprintf("codeql-action-sync-cache.tar.%03d", position+1), volume.Name)
+		if position != len(index.Volumes)-1 {
+			require.Equal(t, int64(4096), volume.Size)
+		}
+	}
+
+	err := Export(cacheDirectory, outputDirectory, 4096)
+	require.EqualError(t, err, fmt.Sprintf(errorOutputNotEmpty, outputDirectory))
+
+	importedCacheDirectory := cachedirectory.NewCacheDirectory(filepath.Join(test.CreateTemporaryDirectory(t), "imported"))
+	require.NoError(t, Import(importedCacheDirectory, outputDirectory))
+	require.NoError(t, importedCacheDirectory.CheckOrCreateVersionFile(false, version.Version()))
+	test.RequireFileHasContent(t, strings.Repeat("Not really a bundle. ", 500), importedCacheDirectory.AssetPath("codeql-bundle-20200101", "codeql-bundle.tar.gz"))
+	test.RequireFileHasContent(t, `{"tag_name": "codeql-bundle-20200101"}`, importedCacheDirectory.MetadataPath("codeql-bundle-20200101"))
+	require.DirExists(t, filepath.Join(importedCacheDirectory.GitPath(), "objects"))
+
+	err = Import(importedCacheDirectory, outputDirectory)
+	require.EqualError(t, err, fmt.Sprintf(errorImportIntoExistingCache, importedCacheDirectory.Path()))
+}
+
+func TestExportExcludesPartialDownloads(t *testing.T) {
+	cacheDirectory := createTestCache(t)
+	require.NoError(t, os.MkdirAll(filepath.Dir(cacheDirectory.PartialAssetPath("codeql-bundle-20200101", 1, "codeql-bundle.tar.gz")), 0755))
+	require.NoError(t, ioutil.WriteFile(cacheDirectory.PartialAssetPath("codeql-bundle-20200101", 1, "codeql-bundle.tar.gz"), []byte("Not really"), 0644))
+	outputDirectory := filepath.Join(test.CreateTemporaryDirectory(t), "export")
+	require.NoError(t, Export(cacheDirectory, outputDirectory, 4096))
+
+	importedCacheDirectory := cachedirectory.NewCacheDirectory(filepath.Join(test.CreateTemporaryDirectory(t), "imported"))
+	require.NoError(t, Import(importedCacheDirectory, outputDirectory))
+	require.FileExists(t, importedCacheDirectory.AssetPath("codeql-bundle-20200101", "codeql-bundle.tar.gz"))
+	require.NoDirExists(t, importedCacheDirectory.PartialDownloadsPath())
+}
+
+func TestExportIntoCache(t *testing.T) {
+	cacheDirectory := createTestCache(t)
+	for _, outputDirectory := range []string{cacheDirectory.Path(), filepath.Join(cacheDirectory.Path(), "export")} {
+		err := Export(cacheDirectory, outputDirectory, 4096)
+		require.EqualError(t, err, fmt.Sprintf(errorOutputInsideCache, outputDirectory, cacheDirectory.Path()))
+	}
+	require.NoDirExists(t, filepath.Join(cacheDirectory.Path(), "export"))
+	require.NoError(t, Export(cacheDirectory, cacheDirectory.Path()+"-export", 4096))
+}
+
+func TestExportLockedCache(t *testing.T) {
+	cacheDirectory := createTestCache(t)
+	require.NoError(t, cacheDirectory.Lock())
+	err := Export(cacheDirectory, test.CreateTemporaryDirectory(t), 4096)
+	require.Error(t, err)
+}
+
+func TestImportMissingVolumes(t *testing.T) {
+	_, outputDirectory, _ := exportTestCache(t)
+	require.NoError(t, os.Remove(filepath.Join(outputDirectory, "codeql-action-sync-cache.tar.002")))
+	require.NoError(t, os.Remove(filepath.Join(outputDirectory, "codeql-action-sync-cache.tar.004")))
+	_, err := VerifyVolumes(outputDirectory)
+	require.EqualError(t, err, "Some volumes of the exported cache are missing: codeql-action-sync-cache.tar.002, codeql-action-sync-cache.tar.004.")
+
+	_, err = VerifyVolumes(test.CreateTemporaryDirectory(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not contain an exported cache")
+}
+
+func TestImportReorderedVolumes(t *testing.T) {
+	_, outputDirectory, _ := exportTestCache(t)
+	second := filepath.Join(outputDirectory, "codeql-action-sync-cache.tar.002")
+	third := filepath.Join(outputDirectory, "codeql-action-sync-cache.tar.003")
+	require.NoError(t, os.Rename(second, second+".tmp"))
+	require.NoError(t, os.Rename(third, second))
+	require.NoError(t, os.Rename(second+".tmp", third))
+	_, err := VerifyVolumes(outputDirectory)
+	require.EqualError(t, err, "Volume codeql-action-sync-cache.tar.002 contains the data for volume codeql-action-sync-cache.tar.003. The volumes may have been renamed or reordered.")
+}
+
+func TestImportCorruptVolumes(t *testing.T) {
+	_, outputDirectory, _ := exportTestCache(t)
+	volumePath := filepath.Join(outputDirectory, "codeql-action-sync-cache.tar.003")
+	content, err := ioutil.ReadFile(volumePath)
+	require.NoError(t, err)
+	content[100] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(volumePath, content, 0644))
+	_, err = VerifyVolumes(outputDirectory)
+	require.EqualError(t, err, "The checksum of volume codeql-action-sync-cache.tar.003 does not match. It may have been corrupted.")
+
+	require.NoError(t, ioutil.WriteFile(volumePath, content[:1000], 0644))
+	_, err = VerifyVolumes(outputDirectory)
+	require.EqualError(t, err, "Volume codeql-action-sync-cache.tar.003 is 1000 bytes, but should be 4096 bytes. It may have been truncated or corrupted.")
+}
@@ -3,19 +3,48 @@ package main
 import (
 	"context"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/github/codeql-action-sync/cmd"
+	"github.com/github/codeql-action-sync/internal/errorcategory"
 )
 
+// stopOnSignal cancels the context on SIGINT or SIGTERM, so that in-flight transfers can stop cleanly. A second signal stops the process immediately. The returned function reports which signal was received, if any.
+func stopOnSignal(cancel context.CancelFunc) func() syscall.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var received atomic.Value
+	go func() {
+		receivedSignal := <-signals
+		received.Store(receivedSignal)
+		signal.Stop(signals)
+		log.Warnf("Received %s, stopping. Send it again to stop immediately.", receivedSignal)
+		cancel()
+	}()
+	return func() syscall.Signal {
+		receivedSignal, _ := received.Load().(syscall.Signal)
+		return receivedSignal
+	}
+}
+
 func main() {
 	log.SetLevel(log.DebugLevel)
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receivedSignal := stopOnSignal(cancel)
 	if err := cmd.Execute(ctx); err != nil {
-		if err == cmd.SilentErr {
-			os.Exit(1)
+		if receivedSignal() != 0 {
+			// By convention, a process stopped by a signal exits with 128 plus the signal number.
+			log.Error(err.Error())
+			os.Exit(128 + int(receivedSignal()))
+		}
+		if err != cmd.SilentErr {
+			log.Errorf("%+v", err)
 		}
-		log.Fatalf("%+v", err)
+		os.Exit(errorcategory.ExitCode(err))
 	}
 }